@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Auth is how the crawler identifies itself to the sites it crawls, to
+// reach the pages behind a login.
+type Auth struct {
+	// Headers are added to the requests to the host of the crawled
+	// domain, on any port if it has none.
+	Headers http.Header
+	// Credentials are sent to the hosts they're for.
+	Credentials []Credential
+	// Cookies are set for the crawled domain before crawling. The cookies
+	// the sites set are kept for the whole crawl.
+	Cookies []*http.Cookie
+	// Login is a form to submit before crawling, nothing is submitted if
+	// nil.
+	Login *FormLogin
+	// Logout matches the URLs not to crawl for they'd end the session,
+	// with their path and query. The default matches logout, log-off,
+	// sign_out, end-session and the like.
+	Logout *regexp.Regexp
+}
+
+// Credential authenticates to a host, with HTTP basic auth or a bearer
+// token.
+type Credential struct {
+	// Host is where the credential is sent, with its port if it's not
+	// the default one. A host without port matches any port.
+	Host string
+	// Username and Password are sent with HTTP basic auth.
+	Username, Password string
+	// Token, if set, is sent as a bearer token instead.
+	Token string
+}
+
+// FormLogin is a login form, filled and submitted before crawling to open
+// a session.
+type FormLogin struct {
+	// URL is the page with the form, relative to the crawled domain.
+	URL string
+	// Form selects the form in the page, with CSS. The first form with a
+	// password field is submitted if empty.
+	Form string
+	// Fields are the values to fill in, like the user name and the
+	// password. The other fields are sent as the page has them, hidden
+	// ones like CSRF tokens included.
+	Fields url.Values
+}
+
+// defaultLogout matches logout URLs, logout and sign_out but not
+// blog/outdoors.
+var defaultLogout = regexp.MustCompile(`(?i)(^|[^a-z])((log|sign)[-_]?(out|off)|end[-_]?session)([^a-z]|$)`)
+
+// isLogout tells if following u would end the session.
+func (a *Auth) isLogout(u *url.URL) bool {
+	if a == nil {
+		return false
+	}
+	logout := a.Logout
+	if logout == nil {
+		logout = defaultLogout
+	}
+	target := u.Path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return logout.MatchString(target)
+}
+
+// client is a copy of client sending the headers and credentials of the
+// auth, and keeping cookies, with those of the auth set for domain.
+func (a *Auth) client(client *http.Client, domain *url.URL) (*http.Client, error) {
+	authed := *client
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	authed.Transport = &authTransport{auth: a, domain: domain, next: next}
+	if authed.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		authed.Jar = jar
+	}
+	if len(a.Cookies) > 0 {
+		authed.Jar.SetCookies(domain, a.Cookies)
+	}
+	return &authed, nil
+}
+
+// authTransport adds the headers and credentials of an auth to the
+// requests, redirects included. They're marked secret, for the WARC
+// recorder not to write them down.
+type authTransport struct {
+	auth   *Auth
+	domain *url.URL
+	next   http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = cloneRequest(req)
+	if hostMatches(t.domain.Host, req.URL) && len(t.auth.Headers) > 0 {
+		var names []string
+		for name, values := range t.auth.Headers {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+			names = append(names, name)
+		}
+		req = withSecrets(req, requestSecrets{headers: names})
+	}
+	if cred, ok := t.auth.credentialFor(req.URL); ok {
+		if cred.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+cred.Token)
+		} else {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (a *Auth) credentialFor(u *url.URL) (Credential, bool) {
+	for _, cred := range a.Credentials {
+		if hostMatches(cred.Host, u) {
+			return cred, true
+		}
+	}
+	return Credential{}, false
+}
+
+// hostMatches tells if u is on host, on any port if host has none.
+func hostMatches(host string, u *url.URL) bool {
+	hostname := u.Host
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		hostname = h
+	}
+	return strings.EqualFold(host, u.Host) || strings.EqualFold(host, hostname)
+}
+
+// login fills the form of the login page and submits it, with the
+// session cookies kept by client.
+func (l *FormLogin) login(client *http.Client, agent string, domain *url.URL) error {
+	page, err := domain.Parse(l.URL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", page.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("User-Agent", agent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login page %q answered %d", page, resp.StatusCode)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	form := l.findForm(doc)
+	if form.Length() == 0 {
+		return fmt.Errorf("no login form in %q", page)
+	}
+	// the page may be the end of redirects
+	page = resp.Request.URL
+	action, err := documentBase(page, doc).Parse(attrOr(form, "action", ""))
+	if err != nil {
+		return fmt.Errorf("invalid login form action, %v", err)
+	}
+	values := formValues(form)
+	for name, fill := range l.Fields {
+		values[name] = fill
+	}
+
+	method := strings.ToUpper(attrOr(form, "method", "GET"))
+	if method == "POST" {
+		req, err = http.NewRequest("POST", action.String(), strings.NewReader(values.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		action.RawQuery = values.Encode()
+		if req, err = http.NewRequest("GET", action.String(), nil); err != nil {
+			return err
+		}
+	}
+	var fields []string
+	for name := range l.Fields {
+		fields = append(fields, name)
+	}
+	req = withSecrets(req, requestSecrets{fields: fields})
+	req.Header.Add("User-Agent", agent)
+	req.Header.Set("Referer", page.String())
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login form answered %d", resp.StatusCode)
+	}
+
+	// landing on the login form again is a failed login
+	if resp.Request.URL.Path == page.Path {
+		doc, err := goquery.NewDocumentFromReader(resp.Body)
+		if err == nil && l.findForm(doc).Length() > 0 {
+			return fmt.Errorf("login form shown again after submitting it")
+		}
+	}
+	return nil
+}
+
+func (l *FormLogin) findForm(doc *goquery.Document) *goquery.Selection {
+	var forms *goquery.Selection
+	if l.Form != "" {
+		forms = doc.Find(l.Form)
+	} else {
+		forms = doc.Find("form").FilterFunction(func(_ int, s *goquery.Selection) bool {
+			return s.Find("input[type=password]").Length() > 0
+		})
+	}
+	if forms.Length() == 0 {
+		return forms
+	}
+	return forms.First()
+}
+
+// formValues are the values a browser would submit for a form, without
+// clicking any button.
+func formValues(form *goquery.Selection) url.Values {
+	values := make(url.Values)
+	form.Find("input[name]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		switch strings.ToLower(attrOr(s, "type", "text")) {
+		case "submit", "button", "image", "reset", "file":
+			return
+		case "checkbox", "radio":
+			if _, checked := s.Attr("checked"); !checked {
+				return
+			}
+			values.Add(name, attrOr(s, "value", "on"))
+			return
+		}
+		values.Add(name, attrOr(s, "value", ""))
+	})
+	form.Find("textarea[name]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		values.Add(name, s.Text())
+	})
+	form.Find("select[name]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		option := s.Find("option[selected]")
+		if option.Length() == 0 {
+			option = s.Find("option")
+		}
+		if option.Length() > 0 {
+			option = option.First()
+			values.Add(name, attrOr(option, "value", option.Text()))
+		}
+	})
+	return values
+}
+
+func attrOr(s *goquery.Selection, name, fallback string) string {
+	if v, ok := s.Attr(name); ok {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,267 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// loginSite serves pages only to the sessions opened by its login form,
+// and closes them on /logout.
+type loginSite struct {
+	pages    map[string]string
+	sessions map[string]bool
+}
+
+func (s *loginSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/robots.txt":
+		http.NotFound(w, r)
+		return
+	case "/login":
+		if r.Method == "POST" {
+			if r.FormValue("user") != "bob" || r.FormValue("password") != "secret" || r.FormValue("csrf") != "t0k3n" {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			s.sessions["s3ss10n"] = true
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3ss10n", Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, `<form method="post" action="/login">
+			<input type="hidden" name="csrf" value="t0k3n">
+			<input name="user"><input type="password" name="password">
+			<input type="submit" name="go" value="Log in">
+		</form>`)
+		return
+	}
+
+	cookie, err := r.Cookie("session")
+	if err != nil || !s.sessions[cookie.Value] {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if r.URL.Path == "/logout" {
+		delete(s.sessions, cookie.Value)
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	htmlPages(s.pages)(w, r)
+}
+
+func TestCrawlBehindLogin(t *testing.T) {
+	site := &loginSite{
+		pages: map[string]string{
+			"/":              `<a href="/logout"></a><a href="/a"></a><a href="/account/sign_out?next=/"></a>`,
+			"/a":             `<a href="/blog/outdoors"></a>`,
+			"/blog/outdoors": `<p>still logged in</p>`,
+		},
+		sessions: make(map[string]bool),
+	}
+	withHandler(t, site, func(domain *url.URL) {
+		opts := DefaultOptions()
+		opts.Auth = &Auth{Login: &FormLogin{
+			URL:    "/login",
+			Fields: url.Values{"user": {"bob"}, "password": {"secret"}},
+		}}
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		d := domain.String()
+		want := []string{
+			fmt.Sprintf("%s 200 [%s/a]", d, d),
+			fmt.Sprintf("%s/a 200 [%s/blog/outdoors]", d, d),
+			fmt.Sprintf("%s/account/sign_out?next=/ rejected: logout: would end the session", d),
+			fmt.Sprintf("%s/blog/outdoors 200 []", d),
+			fmt.Sprintf("%s/logout rejected: logout: would end the session", d),
+		}
+		got := graphSummary(g)
+		check(t, reflect.DeepEqual(want, got), "want the graph\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+		check(t, len(site.sessions) == 1, "want the session still open")
+	})
+}
+
+func TestLoginFails(t *testing.T) {
+	site := &loginSite{sessions: make(map[string]bool)}
+	withHandler(t, site, func(domain *url.URL) {
+		tests := []struct {
+			login *FormLogin
+			err   string
+		}{
+			{&FormLogin{URL: "/login", Fields: url.Values{"user": {"bob"}, "password": {"wrong"}}}, "login form shown again"},
+			{&FormLogin{URL: "/login", Form: "form#nope"}, "no login form"},
+			{&FormLogin{URL: "/robots.txt"}, "answered 404"},
+		}
+		for _, tt := range tests {
+			opts := DefaultOptions()
+			opts.Auth = &Auth{Login: tt.login}
+			_, err := NewCrawlerWithOptions(domain, testAgent, opts)
+			check(t, err != nil && strings.Contains(err.Error(), tt.err), "%+v: want error %q, got %v", tt.login, tt.err, err)
+		}
+	})
+}
+
+// roundTripperFunc answers requests with a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestAuthTransport(t *testing.T) {
+	auth := &Auth{
+		Headers: http.Header{"X-Env": {"staging"}},
+		Credentials: []Credential{
+			{Host: "example.com", Username: "bob", Password: "secret"},
+			{Host: "api.example.com:8080", Token: "t0k3n"},
+		},
+		Cookies: []*http.Cookie{{Name: "consent", Value: "yes"}},
+	}
+	var sent *http.Request
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return cacheMiss(req), nil
+	})
+	client, err := auth.client(&http.Client{Transport: next}, must(url.Parse("http://example.com")))
+	check(t, err == nil, "couldn't create the client, %v", err)
+
+	tests := []struct {
+		url, authorization, cookie, env string
+	}{
+		{"http://example.com/a", "Basic Ym9iOnNlY3JldA==", "consent=yes", "staging"},
+		{"http://example.com:8000/a", "Basic Ym9iOnNlY3JldA==", "consent=yes", "staging"},
+		{"http://api.example.com:8080/v1", "Bearer t0k3n", "", ""},
+		{"http://api.example.com/v1", "", "", ""},
+		{"http://other.com/", "", "", ""},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		check(t, err == nil, "%s: couldn't get, %v", tt.url, err)
+		resp.Body.Close()
+		got := sent.Header.Get("Authorization")
+		check(t, got == tt.authorization, "%s: want authorization %q, got %q", tt.url, tt.authorization, got)
+		got = sent.Header.Get("X-Env")
+		check(t, got == tt.env, "%s: want the extra header %q, got %q", tt.url, tt.env, got)
+		got = sent.Header.Get("Cookie")
+		check(t, got == tt.cookie, "%s: want cookie %q, got %q", tt.url, tt.cookie, got)
+	}
+}
+
+func TestCrawlKeepsSecretsOutOfWARC(t *testing.T) {
+	site := &loginSite{
+		pages:    map[string]string{"/": `<a href="/a"></a>`, "/a": `<p>A</p>`},
+		sessions: make(map[string]bool),
+	}
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, site, func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "crawl", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		opts := DefaultOptions()
+		opts.Client = &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+		opts.Auth = &Auth{
+			Headers:     http.Header{"X-Api-Key": {"k3y-k3y"}},
+			Credentials: []Credential{{Host: domain.Host, Username: "bob", Password: "hunter2"}},
+			Cookies:     []*http.Cookie{{Name: "consent", Value: "c00kie"}},
+			Login: &FormLogin{
+				URL:    "/login",
+				Fields: url.Values{"user": {"bob"}, "password": {"secret"}},
+			},
+		}
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		var requests []string
+		setCookie := false
+		for _, rec := range readWARCFile(t, warcFiles(t, dir)[0]) {
+			block := string(rec.block)
+			for _, secret := range []string{"k3y-k3y", "Ym9iOmh1bnRlcjI=", "c00kie", "s3ss10n", "secret"} {
+				check(t, !strings.Contains(block, secret), "want %q kept out of the archive, got %q", secret, block)
+			}
+			switch warcHeader(rec, "WARC-Type") {
+			case "request":
+				requests = append(requests, block)
+			case "response":
+				setCookie = setCookie || strings.Contains(block, "\r\nSet-Cookie: redacted\r\n")
+			}
+		}
+		check(t, setCookie, "want the session cookie of the login redacted")
+		login := ""
+		for _, block := range requests {
+			if strings.HasPrefix(block, "POST /login ") {
+				login = block
+			}
+		}
+		check(t, strings.Contains(login, "password=redacted") && strings.Contains(login, "csrf=t0k3n"), "want the password redacted, the rest kept, got %q", login)
+		check(t, strings.Contains(login, "X-Api-Key: redacted\r\n"), "want the header redacted, got %q", login)
+	})
+}
+
+func TestIsLogout(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/logout", true},
+		{"http://example.com/users/sign_out", true},
+		{"http://example.com/LogOff.aspx", true},
+		{"http://example.com/oauth/end-session", true},
+		{"http://example.com/index.php?action=log-out", true},
+		{"http://example.com/blog/outdoors", false},
+		{"http://example.com/catalog/offers", false},
+		{"http://example.com/login", false},
+	}
+	auth := &Auth{}
+	for _, tt := range tests {
+		got := auth.isLogout(must(url.Parse(tt.url)))
+		check(t, got == tt.want, "%s: want logout %v, got %v", tt.url, tt.want, got)
+	}
+
+	auth.Logout = regexp.MustCompile(`^/bye`)
+	check(t, auth.isLogout(must(url.Parse("http://example.com/bye"))), "want the custom pattern used")
+	check(t, !auth.isLogout(must(url.Parse("http://example.com/logout"))), "want only the custom pattern used")
+	check(t, !(*Auth)(nil).isLogout(must(url.Parse("http://example.com/logout"))), "want no logout without auth")
+}
+
+func TestFormValues(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<form>
+		<input name="user" value="anon">
+		<input type="hidden" name="csrf" value="t0k3n">
+		<input type="checkbox" name="remember" checked>
+		<input type="checkbox" name="spam" value="yes">
+		<input type="radio" name="lang" value="en">
+		<input type="radio" name="lang" value="fr" checked>
+		<input type="submit" name="go" value="Log in">
+		<textarea name="note">hi</textarea>
+		<select name="tz"><option>UTC</option><option value="cet" selected>CET</option></select>
+		<select name="unit"><option value="m">meters</option></select>
+		<input value="unnamed">
+	</form>`))
+	check(t, err == nil, "couldn't parse, %v", err)
+
+	want := url.Values{
+		"user":     {"anon"},
+		"csrf":     {"t0k3n"},
+		"remember": {"on"},
+		"lang":     {"fr"},
+		"note":     {"hi"},
+		"tz":       {"cet"},
+		"unit":     {"m"},
+	}
+	got := formValues(doc.Find("form"))
+	check(t, reflect.DeepEqual(want, got), "want values %v, got %v", want, got)
+}
@@ -0,0 +1,533 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiskCache is an http.RoundTripper that keeps the responses it gets on
+// disk, and answers with them for as long as they're fresh. It follows
+// the rules of RFC 9111 for a private cache: responses are stored unless
+// they say no-store, stay fresh for their max-age, until they expire,
+// or for a tenth of the time since they were last modified, and are
+// revalidated with their ETag or Last-Modified date once stale. HEAD
+// requests are answered by the stored GET response, or by a stored HEAD
+// response when there's none.
+//
+// Given as the transport of the crawler's client, the same site can be
+// crawled again and again without asking the server for every page.
+//
+// see https://www.rfc-editor.org/rfc/rfc9111
+type DiskCache struct {
+	// Offline answers only from the cache, stale responses included, and
+	// never asks the server. What isn't cached is answered 504 Gateway
+	// Timeout, like requests that are only-if-cached.
+	Offline bool
+	// TTL, if not zero, is how long every response stays fresh, whatever
+	// it says. Responses that would otherwise not be stored are, but for
+	// those saying no-store.
+	TTL time.Duration
+
+	dir  string
+	next http.RoundTripper
+	now  func() time.Time
+}
+
+// NewDiskCache keeps the responses in dir, and asks next for what it
+// can't answer, http.DefaultTransport if nil.
+func NewDiskCache(dir string, next http.RoundTripper) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &DiskCache{dir: dir, next: next, now: time.Now}, nil
+}
+
+// cacheEntry is a stored response, and what the cache needs to know about
+// it.
+type cacheEntry struct {
+	url string
+	// method is the method of the request, HEAD responses have no body
+	// and can't answer GET requests
+	method string
+	status string
+	code   int
+	proto  string
+	header http.Header
+	body   []byte
+	// when the request was sent and its response received
+	requestTime, responseTime time.Time
+	// the request headers the response varies on, as they were sent
+	vary http.Header
+}
+
+func (c *DiskCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		resp, err := c.next.RoundTrip(req)
+		// unsafe methods invalidate what's stored for the URL
+		if err == nil && resp.StatusCode < 400 {
+			_ = os.Remove(c.filename("GET", req.URL))
+			_ = os.Remove(c.filename("HEAD", req.URL))
+		}
+		return resp, err
+	}
+	if req.Header.Get("Range") != "" {
+		// partial content isn't stored
+		return c.next.RoundTrip(req)
+	}
+
+	reqCC := parseCacheControl(req.Header["Cache-Control"])
+	entry := c.load(req)
+
+	if c.Offline || reqCC.has("only-if-cached") {
+		if entry == nil {
+			return cacheMiss(req), nil
+		}
+		return c.serve(req, entry), nil
+	}
+
+	if entry != nil && c.usable(req, reqCC, entry) {
+		return c.serve(req, entry), nil
+	}
+
+	// stale: asked for again, only if it changed when it can be
+	// validated, unless the request has validators of its own
+	out := req
+	if entry != nil && !isConditional(req) {
+		out = cloneRequest(req)
+		if etag := entry.header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.header.Get("Last-Modified"); lastModified != "" {
+			out.Header.Set("If-Modified-Since", lastModified)
+		}
+		if !isConditional(out) {
+			out = req
+		}
+	}
+
+	requestTime := c.now()
+	resp, err := c.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := c.now()
+
+	if out != req && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+		entry.refresh(resp.Header, requestTime, responseTime)
+		_ = c.save(entry)
+		return c.serve(req, entry), nil
+	}
+	if !c.storable(req, reqCC, resp) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry = &cacheEntry{
+		url:          req.URL.String(),
+		method:       req.Method,
+		status:       resp.Status,
+		code:         resp.StatusCode,
+		proto:        resp.Proto,
+		header:       cloneHeader(resp.Header),
+		body:         body,
+		requestTime:  requestTime,
+		responseTime: responseTime,
+		vary:         make(http.Header),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		entry.vary[name] = req.Header[name]
+	}
+	// the response is given back all the same if it can't be stored
+	_ = c.save(entry)
+	return resp, nil
+}
+
+// usable tells if a stored response can answer a request without asking
+// the server.
+func (c *DiskCache) usable(req *http.Request, reqCC cacheControl, e *cacheEntry) bool {
+	if reqCC.has("no-cache") || (len(req.Header["Cache-Control"]) == 0 && req.Header.Get("Pragma") == "no-cache") {
+		return false
+	}
+	if c.TTL == 0 && parseCacheControl(e.header["Cache-Control"]).has("no-cache") {
+		return false
+	}
+	lifetime, age := c.freshness(e)
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	return lifetime > age
+}
+
+// storable tells if a response can be stored, RFC 9111 section 3.
+func (c *DiskCache) storable(req *http.Request, reqCC cacheControl, resp *http.Response) bool {
+	if (req.Method != "GET" && req.Method != "HEAD") || resp.StatusCode < 200 || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	cc := parseCacheControl(resp.Header["Cache-Control"])
+	if reqCC.has("no-store") || cc.has("no-store") {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if c.TTL > 0 {
+		return true
+	}
+	_, hasMaxAge := cc.seconds("max-age")
+	return hasMaxAge || cc.has("public") || cc.has("private") ||
+		resp.Header.Get("Expires") != "" || heuristicallyCacheable(resp.StatusCode)
+}
+
+// freshness is how long a stored response is fresh for, and how old it
+// is, RFC 9111 section 4.2.
+func (c *DiskCache) freshness(e *cacheEntry) (lifetime, age time.Duration) {
+	date, err := http.ParseTime(e.header.Get("Date"))
+	if err != nil {
+		date = e.responseTime
+	}
+
+	apparentAge := e.responseTime.Sub(date)
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	ageValue, _ := strconv.ParseInt(e.header.Get("Age"), 10, 64)
+	correctedAge := time.Duration(ageValue)*time.Second + e.responseTime.Sub(e.requestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	age = correctedAge + c.now().Sub(e.responseTime)
+
+	cc := parseCacheControl(e.header["Cache-Control"])
+	switch maxAge, hasMaxAge := cc.seconds("max-age"); {
+	case c.TTL > 0:
+		lifetime = c.TTL
+	case hasMaxAge:
+		lifetime = maxAge
+	case e.header.Get("Expires") != "":
+		// invalid dates are in the past
+		if expires, err := http.ParseTime(e.header.Get("Expires")); err == nil {
+			lifetime = expires.Sub(date)
+		}
+	case heuristicallyCacheable(e.code):
+		if lastModified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+			lifetime = date.Sub(lastModified) / 10
+		}
+	}
+	return lifetime, age
+}
+
+// refresh updates a stored response with the headers of the 304 that
+// validated it.
+func (e *cacheEntry) refresh(header http.Header, requestTime, responseTime time.Time) {
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Transfer-Encoding", "Content-Encoding":
+			continue
+		}
+		e.header[name] = values
+	}
+	e.requestTime, e.responseTime = requestTime, responseTime
+}
+
+// serve answers a request with a stored response. A conditional request
+// whose validators match is answered 304.
+func (c *DiskCache) serve(req *http.Request, e *cacheEntry) *http.Response {
+	_, age := c.freshness(e)
+	resp := &http.Response{
+		Status:        e.status,
+		StatusCode:    e.code,
+		Proto:         e.proto,
+		Header:        cloneHeader(e.header),
+		ContentLength: int64(len(e.body)),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(e.proto)
+	resp.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	if e.method == "HEAD" {
+		// the length of what the GET would have been
+		resp.ContentLength = -1
+		if n, err := strconv.ParseInt(e.header.Get("Content-Length"), 10, 64); err == nil {
+			resp.ContentLength = n
+		}
+	}
+
+	if e.code == http.StatusOK && notModified(req, e.header) {
+		resp.Status, resp.StatusCode = "304 Not Modified", http.StatusNotModified
+		resp.ContentLength = 0
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	if req.Method == "HEAD" {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	// stored gzipped when a recorder asked for it
+	decodeResponse(req, resp)
+	return resp
+}
+
+// cacheMiss is the answer to the requests that must be answered by the
+// cache, and can't be.
+func cacheMiss(req *http.Request) *http.Response {
+	body := []byte("not cached\n")
+	resp := &http.Response{
+		Status:        "504 Gateway Timeout",
+		StatusCode:    http.StatusGatewayTimeout,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		Request:       req,
+	}
+	if req.Method == "HEAD" {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	// stored gzipped when a recorder asked for it
+	decodeResponse(req, resp)
+	return resp
+}
+
+// notModified tells if the validators of a conditional request match
+// those of a response.
+func notModified(req *http.Request, header http.Header) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || (etag != "" && candidate == etag) {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(since)
+}
+
+func isConditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// heuristicallyCacheable are the status codes whose responses can be
+// stored without being told so, RFC 9110 section 15.1.
+func heuristicallyCacheable(code int) bool {
+	switch code {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cacheControl are the directives of Cache-Control headers, by name.
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		// invalid durations are stale
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// filename is where the response to a request for a URL is stored, one
+// file per URL and method.
+func (c *DiskCache) filename(method string, u *url.URL) string {
+	id := u.String()
+	if method != "GET" {
+		id = method + " " + id
+	}
+	sum := sha256.Sum256([]byte(id))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// load reads the stored response that can answer a request, nil if
+// there's none. HEAD requests are answered by the latest of the GET and
+// HEAD responses.
+func (c *DiskCache) load(req *http.Request) *cacheEntry {
+	e := c.loadFor("GET", req)
+	if req.Method != "HEAD" {
+		return e
+	}
+	if head := c.loadFor("HEAD", req); head != nil && (e == nil || head.responseTime.After(e.responseTime)) {
+		return head
+	}
+	return e
+}
+
+// loadFor reads the response stored for a request with a method.
+func (c *DiskCache) loadFor(method string, req *http.Request) *cacheEntry {
+	data, err := ioutil.ReadFile(c.filename(method, req.URL))
+	if err != nil {
+		return nil
+	}
+	e, err := decodeCacheEntry(data)
+	if err != nil || e.url != req.URL.String() || e.method != method {
+		return nil
+	}
+	for name, values := range e.vary {
+		if strings.Join(values, ", ") != strings.Join(req.Header[name], ", ") {
+			return nil
+		}
+	}
+	return e
+}
+
+// save writes a stored response, replacing the previous one at once.
+func (c *DiskCache) save(e *cacheEntry) error {
+	u, err := url.Parse(e.url)
+	if err != nil {
+		return err
+	}
+	filename := c.filename(e.method, u)
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(e.encode())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// encode writes a stored response as what the cache knows of it, then
+// the response as it was received.
+func (e *cacheEntry) encode() []byte {
+	var buf bytes.Buffer
+	meta := http.Header{
+		"Url":           {e.url},
+		"Method":        {e.method},
+		"Request-Time":  {e.requestTime.UTC().Format(time.RFC3339Nano)},
+		"Response-Time": {e.responseTime.UTC().Format(time.RFC3339Nano)},
+	}
+	for name, values := range e.vary {
+		meta["Vary-"+name] = values
+	}
+	_ = meta.Write(&buf)
+	buf.WriteString("\r\n")
+
+	header := cloneHeader(e.header)
+	header.Del("Transfer-Encoding")
+	if e.method != "HEAD" {
+		header.Set("Content-Length", strconv.Itoa(len(e.body)))
+	}
+	fmt.Fprintf(&buf, "%s %s\r\n", e.proto, e.status)
+	_ = header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(e.body)
+	return buf.Bytes()
+}
+
+func decodeCacheEntry(data []byte) (*cacheEntry, error) {
+	br := bufio.NewReader(bytes.NewReader(data))
+	meta, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{url: meta.Get("Url"), method: meta.Get("Method"), vary: make(http.Header)}
+	if e.method == "" {
+		e.method = "GET"
+	}
+	if e.requestTime, err = time.Parse(time.RFC3339Nano, meta.Get("Request-Time")); err != nil {
+		return nil, err
+	}
+	if e.responseTime, err = time.Parse(time.RFC3339Nano, meta.Get("Response-Time")); err != nil {
+		return nil, err
+	}
+	for name, values := range meta {
+		if strings.HasPrefix(name, "Vary-") {
+			e.vary[strings.TrimPrefix(name, "Vary-")] = values
+		}
+	}
+
+	// the Content-Length of a HEAD response is that of the GET
+	resp, err := http.ReadResponse(br, &http.Request{Method: e.method})
+	if err != nil {
+		return nil, err
+	}
+	if e.body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return nil, err
+	}
+	e.status, e.code, e.proto, e.header = resp.Status, resp.StatusCode, resp.Proto, resp.Header
+	if e.method != "HEAD" {
+		e.header.Del("Content-Length")
+	}
+	return e, nil
+}
@@ -0,0 +1,356 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedSite serves pages with the headers given for them, answers 304
+// when their ETag matches, and counts the requests and the pages sent
+// whole. Responses are dated by now, if set.
+type cachedSite struct {
+	headers    map[string]http.Header
+	now        func() time.Time
+	requests   int
+	downloaded int
+}
+
+func (s *cachedSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	header, ok := s.headers[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	if s.now != nil {
+		w.Header().Set("Date", s.now().UTC().Format(http.TimeFormat))
+	}
+	if etag := header.Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.downloaded++
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "page %s, %s", r.URL.Path, r.Header.Get("Accept-Language"))
+}
+
+func TestDiskCache(t *testing.T) {
+	lastModified := time.Now().Add(-100 * time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header http.Header
+		// the request headers, and how long after the first request
+		// they're sent, each request
+		requests []http.Header
+		after    []time.Duration
+		ttl      time.Duration
+		// what the server sees
+		requested, downloaded int
+	}{
+		{"max-age", http.Header{"Cache-Control": {"max-age=60"}},
+			[]http.Header{nil, nil}, []time.Duration{0, 30 * time.Second}, 0, 1, 1},
+		{"max-age stale", http.Header{"Cache-Control": {"max-age=60"}},
+			[]http.Header{nil, nil}, []time.Duration{0, 90 * time.Second}, 0, 2, 2},
+		{"revalidated", http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}},
+			[]http.Header{nil, nil, nil}, []time.Duration{0, 90 * time.Second, 120 * time.Second}, 0, 2, 1},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}},
+			[]http.Header{nil, nil}, []time.Duration{0, time.Second}, 0, 2, 1},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=60"}},
+			[]http.Header{nil, nil}, []time.Duration{0, time.Second}, 0, 2, 2},
+		{"expires", http.Header{"Expires": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}},
+			[]http.Header{nil, nil}, []time.Duration{0, 30 * time.Second}, 0, 1, 1},
+		{"heuristic", http.Header{"Last-Modified": {lastModified}},
+			[]http.Header{nil, nil, nil}, []time.Duration{0, 9 * time.Hour, 11 * time.Hour}, 0, 2, 2},
+		{"no freshness", http.Header{},
+			[]http.Header{nil, nil}, []time.Duration{0, time.Second}, 0, 2, 2},
+		{"ttl", http.Header{"Cache-Control": {"no-cache"}},
+			[]http.Header{nil, nil, nil}, []time.Duration{0, 50 * time.Minute, 2 * time.Hour}, time.Hour, 2, 2},
+		{"ttl no-store", http.Header{"Cache-Control": {"no-store"}},
+			[]http.Header{nil, nil}, []time.Duration{0, time.Second}, time.Hour, 2, 2},
+		{"request no-cache", http.Header{"Cache-Control": {"max-age=60"}},
+			[]http.Header{nil, {"Cache-Control": {"no-cache"}}}, []time.Duration{0, time.Second}, 0, 2, 2},
+		{"request max-age", http.Header{"Cache-Control": {"max-age=60"}},
+			[]http.Header{nil, {"Cache-Control": {"max-age=10"}}}, []time.Duration{0, 30 * time.Second}, 0, 2, 2},
+		{"vary", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}},
+			[]http.Header{{"Accept-Language": {"fr"}}, {"Accept-Language": {"fr"}}, {"Accept-Language": {"en"}}},
+			[]time.Duration{0, time.Second, 2 * time.Second}, 0, 2, 2},
+		{"vary *", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}},
+			[]http.Header{nil, nil}, []time.Duration{0, time.Second}, 0, 2, 2},
+	}
+	for _, tt := range tests {
+		site := &cachedSite{headers: map[string]http.Header{"/page": tt.header}}
+		withHandler(t, site, func(domain *url.URL) {
+			dir, err := ioutil.TempDir("", "cache")
+			check(t, err == nil, "couldn't create the cache directory, %v", err)
+			defer os.RemoveAll(dir)
+
+			cache, err := NewDiskCache(dir, nil)
+			check(t, err == nil, "couldn't create the cache, %v", err)
+			cache.TTL = tt.ttl
+			start := time.Now()
+			client := &http.Client{Transport: cache}
+
+			for i, header := range tt.requests {
+				cache.now = func() time.Time { return start.Add(tt.after[i]) }
+				site.now = cache.now
+				req, _ := http.NewRequest("GET", domain.String()+"/page", nil)
+				for name, values := range header {
+					req.Header[name] = values
+				}
+				resp, err := client.Do(req)
+				check(t, err == nil, "%s: couldn't get the page, %v", tt.name, err)
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				check(t, resp.StatusCode == 200, "%s: want a 200, got %d", tt.name, resp.StatusCode)
+				want := "page /page, " + req.Header.Get("Accept-Language")
+				check(t, string(body) == want, "%s: want body %q, got %q", tt.name, want, body)
+			}
+			check(t, site.requests == tt.requested, "%s: want %d requests, got %d", tt.name, tt.requested, site.requests)
+			check(t, site.downloaded == tt.downloaded, "%s: want %d downloads, got %d", tt.name, tt.downloaded, site.downloaded)
+		})
+	}
+}
+
+func TestDiskCacheAnswers(t *testing.T) {
+	site := &cachedSite{headers: map[string]http.Header{
+		"/page": {"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}},
+	}}
+	withHandler(t, site, func(domain *url.URL) {
+		dir, err := ioutil.TempDir("", "cache")
+		check(t, err == nil, "couldn't create the cache directory, %v", err)
+		defer os.RemoveAll(dir)
+
+		cache, err := NewDiskCache(dir, nil)
+		check(t, err == nil, "couldn't create the cache, %v", err)
+		start := time.Now()
+		cache.now = func() time.Time { return start }
+		client := &http.Client{Transport: cache}
+		page := domain.String() + "/page"
+
+		resp, err := client.Get(page)
+		check(t, err == nil, "couldn't get the page, %v", err)
+		resp.Body.Close()
+
+		// kept on disk, for the next cache of the same directory
+		cache, err = NewDiskCache(dir, nil)
+		check(t, err == nil, "couldn't create the cache, %v", err)
+		cache.now = func() time.Time { return start.Add(20 * time.Second) }
+		client = &http.Client{Transport: cache}
+
+		tests := []struct {
+			method string
+			header http.Header
+			status int
+			body   string
+		}{
+			{"GET", nil, 200, "page /page, "},
+			{"HEAD", nil, 200, ""},
+			{"GET", http.Header{"If-None-Match": {`"v1"`}}, 304, ""},
+			{"GET", http.Header{"If-None-Match": {`"v2"`}}, 200, "page /page, "},
+		}
+		for _, tt := range tests {
+			req, _ := http.NewRequest(tt.method, page, nil)
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			resp, err := client.Do(req)
+			check(t, err == nil, "%s %v: couldn't get the page, %v", tt.method, tt.header, err)
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			check(t, resp.StatusCode == tt.status, "%s %v: want status %d, got %d", tt.method, tt.header, tt.status, resp.StatusCode)
+			check(t, string(body) == tt.body, "%s %v: want body %q, got %q", tt.method, tt.header, tt.body, body)
+			check(t, resp.Header.Get("Age") == "20", "%s %v: want an age of 20, got %q", tt.method, tt.header, resp.Header.Get("Age"))
+			check(t, resp.Header.Get("Etag") == `"v1"`, "%s %v: want the etag, got %q", tt.method, tt.header, resp.Header.Get("Etag"))
+		}
+		check(t, site.requests == 1, "want 1 request, got %d", site.requests)
+
+		// unsafe methods invalidate
+		resp, err = client.Post(page, "text/plain", strings.NewReader("changed"))
+		check(t, err == nil, "couldn't post, %v", err)
+		resp.Body.Close()
+		resp, err = client.Get(page)
+		check(t, err == nil, "couldn't get the page, %v", err)
+		resp.Body.Close()
+		check(t, site.requests == 3, "want the page asked for again, got %d requests", site.requests)
+	})
+}
+
+func TestDiskCacheOffline(t *testing.T) {
+	site := &cachedSite{headers: map[string]http.Header{
+		"/page":  {"Cache-Control": {"max-age=60"}},
+		"/image": {"Cache-Control": {"max-age=60"}},
+	}}
+	withHandler(t, site, func(domain *url.URL) {
+		dir, err := ioutil.TempDir("", "cache")
+		check(t, err == nil, "couldn't create the cache directory, %v", err)
+		defer os.RemoveAll(dir)
+
+		cache, err := NewDiskCache(dir, nil)
+		check(t, err == nil, "couldn't create the cache, %v", err)
+		client := &http.Client{Transport: cache}
+		resp, err := client.Get(domain.String() + "/page")
+		check(t, err == nil, "couldn't get the page, %v", err)
+		resp.Body.Close()
+		resp, err = client.Head(domain.String() + "/image")
+		check(t, err == nil, "couldn't check the image, %v", err)
+		resp.Body.Close()
+
+		// long stale, served all the same
+		cache.Offline = true
+		cache.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+		tests := []struct {
+			method, path string
+			status       int
+			body         string
+			length       int64
+		}{
+			{"GET", "/page", 200, "page /page, ", 12},
+			// answered by the GET
+			{"HEAD", "/page", 200, "", 12},
+			{"HEAD", "/image", 200, "", 13},
+			// a HEAD can't answer a GET
+			{"GET", "/image", 504, "not cached\n", -1},
+			{"GET", "/other", 504, "not cached\n", -1},
+			{"HEAD", "/other", 504, "", -1},
+		}
+		for _, tt := range tests {
+			req, _ := http.NewRequest(tt.method, domain.String()+tt.path, nil)
+			resp, err := client.Do(req)
+			check(t, err == nil, "%s %s: couldn't get, %v", tt.method, tt.path, err)
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			check(t, resp.StatusCode == tt.status, "%s %s: want status %d, got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+			check(t, string(body) == tt.body, "%s %s: want body %q, got %q", tt.method, tt.path, tt.body, body)
+			if tt.length >= 0 {
+				check(t, resp.ContentLength == tt.length, "%s %s: want a length of %d, got %d", tt.method, tt.path, tt.length, resp.ContentLength)
+			}
+		}
+		check(t, site.requests == 2, "want 2 requests, got %d", site.requests)
+	})
+}
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   cacheControl
+	}{
+		{nil, cacheControl{}},
+		{[]string{"no-cache"}, cacheControl{"no-cache": ""}},
+		{[]string{`Max-Age=60, private="Set-Cookie"`, "no-store"}, cacheControl{"max-age": "60", "private": "Set-Cookie", "no-store": ""}},
+		{[]string{" , max-age = 5 ,"}, cacheControl{"max-age": "5"}},
+	}
+	for _, tt := range tests {
+		got := parseCacheControl(tt.values)
+		check(t, reflect.DeepEqual(got, tt.want), "%q: want %v, got %v", tt.values, tt.want, got)
+	}
+
+	cc := parseCacheControl([]string{"max-age=-1, s-maxage=ten"})
+	for _, name := range []string{"max-age", "s-maxage"} {
+		d, ok := cc.seconds(name)
+		check(t, ok && d == 0, "%s: want invalid durations stale, got %v %v", name, d, ok)
+	}
+}
+
+func TestCrawlFromTheCache(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a"></a><a href="/b"></a>`,
+		"/a": `<a href="/"></a><a href="/missing"></a>`,
+		"/b": `<p>b</p>`,
+	}
+	dir, err := ioutil.TempDir("", "cache")
+	check(t, err == nil, "couldn't create the cache directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	var domain *url.URL
+	var live ResourceGraph
+	withHandler(t, htmlPages(pages), func(d *url.URL) {
+		domain = d
+		cache, err := NewDiskCache(dir, nil)
+		check(t, err == nil, "couldn't create the cache, %v", err)
+		cache.TTL = time.Hour
+		opts := DefaultOptions()
+		opts.Client = &http.Client{Transport: cache}
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		live, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+	})
+
+	// the server is gone, the crawl is answered by the cache
+	cache, err := NewDiskCache(dir, nil)
+	check(t, err == nil, "couldn't create the cache, %v", err)
+	cache.Offline = true
+	opts := DefaultOptions()
+	opts.Client = &http.Client{Transport: cache}
+	c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+	check(t, err == nil, "couldn't create crawler, %v", err)
+	cached, err := c.Crawl()
+	check(t, err == nil, "couldn't crawl, %v", err)
+
+	want, got := graphSummary(live), graphSummary(cached)
+	check(t, reflect.DeepEqual(want, got), "want the graph\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+}
+
+func TestDiskCacheUnderARecorder(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			fmt.Fprint(w, "hello")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, "hello")
+		_ = gz.Close()
+	}
+	dir, err := ioutil.TempDir("", "cache")
+	check(t, err == nil, "couldn't create the cache directory, %v", err)
+	defer os.RemoveAll(dir)
+	warcDir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(warcDir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		cache, err := NewDiskCache(dir, nil)
+		check(t, err == nil, "couldn't create the cache, %v", err)
+		w, err := NewWARCWriter(warcDir, "test", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		// the recorder asks for gzip, those without it get it decoded
+		clients := []*http.Client{
+			{Transport: NewWARCRecorder(cache, w, 0)},
+			{Transport: NewWARCRecorder(cache, w, 0)},
+			{Transport: cache},
+		}
+		for i, client := range clients {
+			resp, err := client.Get(domain.String())
+			check(t, err == nil, "%d: couldn't get, %v", i, err)
+			body, _ := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			check(t, string(body) == "hello", "%d: want the body decoded, got %q", i, body)
+		}
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		responses := 0
+		for _, rec := range readWARCFile(t, warcFiles(t, warcDir)[0]) {
+			if warcHeader(rec, "WARC-Type") == "response" {
+				responses++
+				check(t, strings.Contains(string(rec.block), "\r\nContent-Encoding: gzip\r\n"), "want the response recorded gzipped, got %q", rec.block)
+			}
+		}
+		check(t, responses == 2, "want the cache hit recorded too, got %d responses", responses)
+	})
+}
@@ -0,0 +1,250 @@
+package crawler
+
+import (
+	"sort"
+	"strings"
+)
+
+// parseLinkHeader returns the targets of the Link header values that have
+// the link type rel.
+//
+//	`<http://example.com/a>; rel="canonical"` => ["http://example.com/a"]
+//
+// see https://www.rfc-editor.org/rfc/rfc8288#section-3
+func parseLinkHeader(values []string, rel string) []string {
+	var targets []string
+	for _, v := range values {
+		for {
+			start := strings.Index(v, "<")
+			end := strings.Index(v, ">")
+			if start < 0 || end < start {
+				break
+			}
+			target := strings.TrimSpace(v[start+1 : end])
+			v = v[end+1:]
+
+			// parameters go up to the next link, quoted commas aside
+			params, rest := v, ""
+			quoted := false
+			for i, r := range v {
+				if r == '"' {
+					quoted = !quoted
+				}
+				if r == ',' && !quoted {
+					params, rest = v[:i], v[i+1:]
+					break
+				}
+			}
+			v = rest
+
+			if hasLinkParam(params, "rel", rel) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// hasLinkParam tells if the parameter name of a link has the token among
+// its values.
+func hasLinkParam(params, name, token string) bool {
+	for _, param := range strings.Split(params, ";") {
+		i := strings.Index(param, "=")
+		if i < 0 || !strings.EqualFold(strings.TrimSpace(param[:i]), name) {
+			continue
+		}
+		for _, t := range strings.Fields(strings.Trim(strings.TrimSpace(param[i+1:]), `"`)) {
+			if strings.EqualFold(t, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanonicalReport lists the canonical declarations of a crawl that
+// search engines are likely to ignore.
+type CanonicalReport struct {
+	// Chains are pages whose canonical declares another canonical, from
+	// the first page to the last canonical.
+	Chains [][]string `json:"chains"`
+	// Loops are canonicals that lead back to a page already seen, from
+	// the smallest URL of the loop.
+	Loops [][]string `json:"loops"`
+	// Broken are canonicals pointing at pages that didn't answer 200,
+	// or weren't crawled.
+	Broken []BrokenCanonical `json:"broken"`
+}
+
+// BrokenCanonical is a page whose canonical doesn't work.
+type BrokenCanonical struct {
+	URL       string `json:"url"`
+	Canonical string `json:"canonical"`
+	// Status is -1 when the canonical wasn't crawled.
+	Status int `json:"status_code"`
+}
+
+// ReportCanonicals finds the canonical chains, loops and broken
+// canonicals of a graph.
+func ReportCanonicals(g ResourceGraph) CanonicalReport {
+	canonicals := canonicalsOf(g)
+
+	var pages []string
+	isTarget := make(map[string]bool)
+	for page, canonical := range canonicals {
+		pages = append(pages, page)
+		isTarget[canonical] = true
+	}
+	sort.Strings(pages)
+
+	report := CanonicalReport{}
+	loops := newStringSet()
+	for _, page := range pages {
+		path := []string{page}
+		seen := map[string]int{page: 0}
+		for cur := page; ; {
+			next, ok := canonicals[cur]
+			if !ok {
+				break
+			}
+			if i, ok := seen[next]; ok {
+				loop := rotateSmallestFirst(path[i:])
+				if key := strings.Join(loop, " "); !loops.Contains(key) {
+					loops.Add(key)
+					report.Loops = append(report.Loops, loop)
+				}
+				path = nil
+				break
+			}
+			seen[next] = len(path)
+			path = append(path, next)
+			cur = next
+		}
+		if len(path) > 2 && !isTarget[page] {
+			report.Chains = append(report.Chains, path)
+		}
+
+		canonical := canonicals[page]
+		info, ok := g.Info(canonical)
+		status := -1
+		if ok {
+			status = info.Status
+		}
+		if status != 200 {
+			report.Broken = append(report.Broken, BrokenCanonical{URL: page, Canonical: canonical, Status: status})
+		}
+	}
+	return report
+}
+
+// MergeCanonicals returns a copy of the graph where the pages declaring a
+// canonical are merged into it, when the canonical answered 200. Merged
+// pages are listed as aliases of their canonical, and links to them
+// point to the canonical instead.
+func MergeCanonicals(g ResourceGraph) ResourceGraph {
+	canonicals := canonicalsOf(g)
+
+	// follows valid canonicals as far as they go, stopping at loops
+	rep := func(link string) string {
+		seen := map[string]bool{link: true}
+		for {
+			next, ok := canonicals[link]
+			if !ok || seen[next] {
+				return link
+			}
+			if info, ok := g.Info(next); !ok || info.Status != 200 {
+				return link
+			}
+			seen[next] = true
+			link = next
+		}
+	}
+
+	merged := newDigraph()
+	links := graphLinks(g)
+
+	for _, link := range links {
+		info, _ := g.Info(link)
+		to := rep(link)
+		node, ok := merged.nodes[to]
+		if !ok {
+			node = newResource(to)
+			merged.nodes[to] = node
+		}
+		if to == link {
+			node.setInfo(info)
+		} else {
+			node.aliases.Add(link)
+		}
+		for _, href := range info.Hrefs {
+			node.hrefs.Add(href)
+		}
+	}
+
+	for _, link := range links {
+		info, _ := g.Info(link)
+		from := rep(link)
+		for _, target := range info.Guessed {
+			if to := rep(target); to != from {
+				merged.nodes[from].guessed.Add(to)
+			}
+		}
+		for _, target := range info.Leaves {
+			if to := rep(target); to != from {
+				merged.nodes[from].leaves.Add(to)
+			}
+		}
+		for _, target := range info.RefersTo {
+			to := rep(target)
+			if to == from || merged.nodes[from].refersTo.Contains(to) {
+				continue
+			}
+			merged.nodes[from].refersTo.Add(to)
+			merged.nodes[to].referedBy.Add(from)
+			merged.e++
+		}
+	}
+
+	g.WalkRejected(func(link, reason string, referedBy []string) bool {
+		for _, from := range referedBy {
+			merged.addRejected(rep(from), link, reason)
+		}
+		return true
+	})
+	return merged
+}
+
+// canonicalsOf maps the pages of a graph to the canonical they declare,
+// when it's not themselves.
+func canonicalsOf(g ResourceGraph) map[string]string {
+	canonicals := make(map[string]string)
+	for _, link := range graphLinks(g) {
+		info, _ := g.Info(link)
+		if info.Canonical != "" && info.Canonical != link {
+			canonicals[link] = info.Canonical
+		}
+	}
+	return canonicals
+}
+
+// graphLinks are the resources of a graph, sorted.
+func graphLinks(g ResourceGraph) []string {
+	var links []string
+	g.Walk(func(link string, _ int, _, _ []string) bool {
+		links = append(links, link)
+		return true
+	})
+	sort.Strings(links)
+	return links
+}
+
+func rotateSmallestFirst(loop []string) []string {
+	smallest := 0
+	for i, link := range loop {
+		if link < loop[smallest] {
+			smallest = i
+		}
+	}
+	rotated := append([]string{}, loop[smallest:]...)
+	return append(rotated, loop[:smallest]...)
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tt := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"none", nil, nil},
+		{"canonical", []string{`<http://example.com/a>; rel="canonical"`}, []string{"http://example.com/a"}},
+		{"unquoted", []string{`<http://example.com/a>; rel=canonical`}, []string{"http://example.com/a"}},
+		{"among others", []string{`</b>; rel="alternate"; hreflang="fr", </a>; rel="canonical"`}, []string{"/a"}},
+		{"many types", []string{`</a>; rel="prev Canonical"`}, []string{"/a"}},
+		{"quoted comma", []string{`</b>; title="a, b"; rel="alternate", </a>; rel="canonical"`}, []string{"/a"}},
+		{"many headers", []string{`</b>; rel="next"`, `</a>; rel="canonical"`}, []string{"/a"}},
+		{"other type", []string{`</a>; rel="canonicalish"`}, nil},
+	}
+	for _, tt := range tt {
+		got := parseLinkHeader(tt.values, "canonical")
+		check(t, reflect.DeepEqual(got, tt.want), "%s: want %q, got %q", tt.name, tt.want, got)
+	}
+}
+
+// canonicalGraph links every page from "root", and declares canonicals.
+func canonicalGraph(statuses map[string]int, canonicals map[string]string) *digraph {
+	dig := newDigraph()
+	for page, status := range statuses {
+		dig.AddEdge("root", page)
+		dig.MarkStatus(page, status)
+	}
+	dig.MarkStatus("root", 200)
+	for page, canonical := range canonicals {
+		dig.MarkCanonical(page, canonical)
+	}
+	return dig
+}
+
+func TestReportCanonicals(t *testing.T) {
+	dig := canonicalGraph(
+		map[string]int{"a": 200, "b": 200, "c": 200, "d": 200, "e": 200, "f": 200, "g": 404, "h": 200},
+		map[string]string{
+			"a": "b", "b": "c", "c": "c", // chain a, b, c
+			"d": "e", "e": "d", // loop
+			"f": "g", // broken
+			"h": "missing",
+		},
+	)
+
+	got := ReportCanonicals(dig)
+	want := CanonicalReport{
+		Chains: [][]string{{"a", "b", "c"}},
+		Loops:  [][]string{{"d", "e"}},
+		Broken: []BrokenCanonical{
+			{URL: "f", Canonical: "g", Status: 404},
+			{URL: "h", Canonical: "missing", Status: -1},
+		},
+	}
+	check(t, reflect.DeepEqual(got, want), "want report %+v, got %+v", want, got)
+}
+
+func TestMergeCanonicals(t *testing.T) {
+	dig := canonicalGraph(
+		map[string]int{"a": 200, "a?print": 200, "a/": 200, "b": 200, "b?x": 200, "c": 404},
+		map[string]string{"a?print": "a", "a/": "a?print", "b?x": "c"},
+	)
+	dig.AddEdge("a?print", "b?x")
+	dig.AddEdge("a/", "a")
+	dig.AddHref("a/", "/a/")
+
+	g := MergeCanonicals(dig)
+
+	check(t, g.ResourceCount() == 5, "want 5 resources, got %d", g.ResourceCount())
+	for _, link := range []string{"a?print", "a/"} {
+		check(t, !g.Contains(link), "want %q merged into its canonical", link)
+	}
+	check(t, g.Contains("b?x"), "want broken canonical not merged")
+
+	a, _ := g.Info("a")
+	check(t, reflect.DeepEqual(a.Aliases, []string{"a/", "a?print"}), "want aliases of a, got %q", a.Aliases)
+	check(t, reflect.DeepEqual(a.RefersTo, []string{"b?x"}), "want links of aliases, without self links, got %q", a.RefersTo)
+	check(t, reflect.DeepEqual(a.Hrefs, []string{"/a/"}), "want hrefs of aliases, got %q", a.Hrefs)
+	check(t, a.Status == 200, "want status of the canonical, got %d", a.Status)
+
+	root, _ := g.Info("root")
+	check(t, len(root.RefersTo) == 4, "want root links merged, got %q", root.RefersTo)
+
+	bx, _ := g.Info("b?x")
+	check(t, reflect.DeepEqual(bx.ReferedBy, []string{"a", "root"}), "want b?x refered by a and root, got %q", bx.ReferedBy)
+}
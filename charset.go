@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.net/html"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a document is looked at to find its encoding,
+// as much as browsers do.
+const sniffLen = 1024
+
+// encodings are the character encodings of the web, by their name, and
+// the labels they're known by. UTF-8 is left as is.
+//
+// see https://encoding.spec.whatwg.org/#names-and-labels
+var encodings = map[string]struct {
+	e      encoding.Encoding
+	labels []string
+}{
+	"utf-8":          {nil, []string{"unicode-1-1-utf-8", "unicode11utf8", "unicode20utf8", "utf-8", "utf8", "x-unicode20utf8"}},
+	"ibm866":         {charmap.CodePage866, []string{"866", "cp866", "csibm866", "ibm866"}},
+	"iso-8859-2":     {charmap.ISO8859_2, []string{"csisolatin2", "iso-8859-2", "iso-ir-101", "iso8859-2", "iso88592", "iso_8859-2", "iso_8859-2:1987", "l2", "latin2"}},
+	"iso-8859-3":     {charmap.ISO8859_3, []string{"csisolatin3", "iso-8859-3", "iso-ir-109", "iso8859-3", "iso88593", "iso_8859-3", "iso_8859-3:1988", "l3", "latin3"}},
+	"iso-8859-4":     {charmap.ISO8859_4, []string{"csisolatin4", "iso-8859-4", "iso-ir-110", "iso8859-4", "iso88594", "iso_8859-4", "iso_8859-4:1988", "l4", "latin4"}},
+	"iso-8859-5":     {charmap.ISO8859_5, []string{"csisolatincyrillic", "cyrillic", "iso-8859-5", "iso-ir-144", "iso8859-5", "iso88595", "iso_8859-5", "iso_8859-5:1988"}},
+	"iso-8859-6":     {charmap.ISO8859_6, []string{"arabic", "asmo-708", "csiso88596e", "csiso88596i", "csisolatinarabic", "ecma-114", "iso-8859-6", "iso-8859-6-e", "iso-8859-6-i", "iso-ir-127", "iso8859-6", "iso88596", "iso_8859-6", "iso_8859-6:1987"}},
+	"iso-8859-7":     {charmap.ISO8859_7, []string{"csisolatingreek", "ecma-118", "elot_928", "greek", "greek8", "iso-8859-7", "iso-ir-126", "iso8859-7", "iso88597", "iso_8859-7", "iso_8859-7:1987", "sun_eu_greek"}},
+	"iso-8859-8":     {charmap.ISO8859_8, []string{"csiso88598e", "csisolatinhebrew", "hebrew", "iso-8859-8", "iso-8859-8-e", "iso-ir-138", "iso8859-8", "iso88598", "iso_8859-8", "iso_8859-8:1988", "visual"}},
+	"iso-8859-8-i":   {charmap.ISO8859_8, []string{"csiso88598i", "iso-8859-8-i", "logical"}},
+	"iso-8859-10":    {charmap.ISO8859_10, []string{"csisolatin6", "iso-8859-10", "iso-ir-157", "iso8859-10", "iso885910", "l6", "latin6"}},
+	"iso-8859-13":    {charmap.ISO8859_13, []string{"iso-8859-13", "iso8859-13", "iso885913"}},
+	"iso-8859-14":    {charmap.ISO8859_14, []string{"iso-8859-14", "iso8859-14", "iso885914"}},
+	"iso-8859-15":    {charmap.ISO8859_15, []string{"csisolatin9", "iso-8859-15", "iso8859-15", "iso885915", "iso_8859-15", "l9"}},
+	"iso-8859-16":    {charmap.ISO8859_16, []string{"iso-8859-16"}},
+	"koi8-r":         {charmap.KOI8R, []string{"cskoi8r", "koi", "koi8", "koi8-r", "koi8_r"}},
+	"koi8-u":         {charmap.KOI8U, []string{"koi8-ru", "koi8-u"}},
+	"macintosh":      {charmap.Macintosh, []string{"csmacintosh", "mac", "macintosh", "x-mac-roman"}},
+	"windows-874":    {charmap.Windows874, []string{"dos-874", "iso-8859-11", "iso8859-11", "iso885911", "tis-620", "windows-874"}},
+	"windows-1250":   {charmap.Windows1250, []string{"cp1250", "windows-1250", "x-cp1250"}},
+	"windows-1251":   {charmap.Windows1251, []string{"cp1251", "windows-1251", "x-cp1251"}},
+	"windows-1252":   {charmap.Windows1252, []string{"ansi_x3.4-1968", "ascii", "cp1252", "cp819", "csisolatin1", "ibm819", "iso-8859-1", "iso-ir-100", "iso8859-1", "iso88591", "iso_8859-1", "iso_8859-1:1987", "l1", "latin1", "us-ascii", "windows-1252", "x-cp1252"}},
+	"windows-1253":   {charmap.Windows1253, []string{"cp1253", "windows-1253", "x-cp1253"}},
+	"windows-1254":   {charmap.Windows1254, []string{"cp1254", "csisolatin5", "iso-8859-9", "iso-ir-148", "iso8859-9", "iso88599", "iso_8859-9", "iso_8859-9:1989", "l5", "latin5", "windows-1254", "x-cp1254"}},
+	"windows-1255":   {charmap.Windows1255, []string{"cp1255", "windows-1255", "x-cp1255"}},
+	"windows-1256":   {charmap.Windows1256, []string{"cp1256", "windows-1256", "x-cp1256"}},
+	"windows-1257":   {charmap.Windows1257, []string{"cp1257", "windows-1257", "x-cp1257"}},
+	"windows-1258":   {charmap.Windows1258, []string{"cp1258", "windows-1258", "x-cp1258"}},
+	"x-mac-cyrillic": {charmap.MacintoshCyrillic, []string{"x-mac-cyrillic", "x-mac-ukrainian"}},
+	"gbk":            {simplifiedchinese.GBK, []string{"chinese", "csgb2312", "csiso58gb231280", "gb2312", "gb_2312", "gb_2312-80", "gbk", "iso-ir-58", "x-gbk"}},
+	"gb18030":        {simplifiedchinese.GB18030, []string{"gb18030"}},
+	"big5":           {traditionalchinese.Big5, []string{"big5", "big5-hkscs", "cn-big5", "csbig5", "x-x-big5"}},
+	"euc-jp":         {japanese.EUCJP, []string{"cseucpkdfmtjapanese", "euc-jp", "x-euc-jp"}},
+	"iso-2022-jp":    {japanese.ISO2022JP, []string{"csiso2022jp", "iso-2022-jp"}},
+	"shift_jis":      {japanese.ShiftJIS, []string{"csshiftjis", "ms932", "ms_kanji", "shift-jis", "shift_jis", "sjis", "windows-31j", "x-sjis"}},
+	"euc-kr":         {korean.EUCKR, []string{"cseuckr", "csksc56011987", "euc-kr", "iso-ir-149", "korean", "ks_c_5601-1987", "ks_c_5601-1989", "ksc5601", "ksc_5601", "windows-949"}},
+	"utf-16be":       {unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), []string{"unicodefffe", "utf-16be"}},
+	"utf-16le":       {unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), []string{"csunicode", "iso-10646-ucs-2", "ucs-2", "unicode", "unicodefeff", "utf-16", "utf-16le"}},
+}
+
+// encodingLabels are the names of the encodings, by label.
+var encodingLabels = func() map[string]string {
+	labels := make(map[string]string)
+	for name, enc := range encodings {
+		for _, label := range enc.labels {
+			labels[label] = name
+		}
+	}
+	return labels
+}()
+
+var boms = []struct {
+	bom      []byte
+	encoding string
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, "utf-8"},
+	{[]byte{0xfe, 0xff}, "utf-16be"},
+	{[]byte{0xff, 0xfe}, "utf-16le"},
+}
+
+// lookupEncoding is the name of the encoding known by label, empty if
+// none is. Labels are matched regardless of case and surrounding spaces.
+func lookupEncoding(label string) string {
+	return encodingLabels[strings.ToLower(strings.Trim(label, "\t\n\f\r "))]
+}
+
+// decodeDocument decodes a document to UTF-8, from the encoding it has
+// and its name. The encoding is told by the byte order mark of the
+// document, the charset of its Content-Type, or its <meta charset>, in
+// that order. Without any, documents that start as valid UTF-8 are taken
+// for UTF-8, and for windows-1252 otherwise.
+//
+// see https://html.spec.whatwg.org/multipage/parsing.html#determining-the-character-encoding
+func decodeDocument(r io.Reader, contentType string) (io.Reader, string) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	// a shorter document is looked at whole
+	start, _ := br.Peek(sniffLen)
+
+	for _, bom := range boms {
+		if bytes.HasPrefix(start, bom.bom) {
+			_, _ = br.Discard(len(bom.bom))
+			return decoded(br, bom.encoding), bom.encoding
+		}
+	}
+
+	name := sniffEncoding(start, contentType)
+	return decoded(br, name), name
+}
+
+func decoded(r io.Reader, name string) io.Reader {
+	enc := encodings[name].e
+	if enc == nil {
+		return r
+	}
+	return transform.NewReader(r, enc.NewDecoder())
+}
+
+// sniffEncoding is the name of the encoding of a document without byte
+// order mark, from the start of the document and its Content-Type.
+func sniffEncoding(start []byte, contentType string) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if name := lookupEncoding(params["charset"]); name != "" {
+			return name
+		}
+	}
+	if name := metaCharset(start); name != "" {
+		return name
+	}
+	if validUTF8Prefix(start) {
+		return "utf-8"
+	}
+	return "windows-1252"
+}
+
+// metaCharset is the name of the encoding declared by the first <meta>
+// tag declaring one, with a charset attribute or a Content-Type
+// http-equiv. A document declaring itself UTF-16 was read as ASCII to
+// find its declaration, so it's UTF-8.
+func metaCharset(start []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(start))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+		tok := z.Token()
+		if tok.Data != "meta" {
+			continue
+		}
+
+		var label, httpEquiv, content string
+		for _, attr := range tok.Attr {
+			switch attr.Key {
+			case "charset":
+				label = attr.Val
+			case "http-equiv":
+				httpEquiv = attr.Val
+			case "content":
+				content = attr.Val
+			}
+		}
+		if label == "" && strings.EqualFold(httpEquiv, "content-type") {
+			label = charsetOfContent(content)
+		}
+		name := lookupEncoding(label)
+		switch name {
+		case "":
+			continue
+		case "utf-16be", "utf-16le":
+			return "utf-8"
+		}
+		return name
+	}
+}
+
+// charsetOfContent extracts the charset of the content of a Content-Type
+// http-equiv, more leniently than a media type is parsed.
+//
+// see https://html.spec.whatwg.org/multipage/urls-and-fetching.html#algorithm-for-extracting-a-character-encoding-from-a-meta-element
+func charsetOfContent(content string) string {
+	i := strings.Index(strings.ToLower(content), "charset")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(content[i+len("charset"):], "\t\n\f\r ")
+	if !strings.HasPrefix(rest, "=") {
+		return charsetOfContent(rest)
+	}
+	rest = strings.TrimLeft(rest[1:], "\t\n\f\r ")
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+			return rest[1 : end+1]
+		}
+		return ""
+	}
+	if end := strings.IndexAny(rest, "\t\n\f\r ;"); end >= 0 {
+		return rest[:end]
+	}
+	return rest
+}
+
+// validUTF8Prefix tells if b is valid UTF-8, but for a rune cut at its
+// end.
+func validUTF8Prefix(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(b)
+		}
+		b = b[size:]
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encode is s in an encoding.
+func encode(e encoding.Encoding, s string) []byte {
+	b, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDecodeDocument(t *testing.T) {
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	// a rune cut by the end of what's sniffed
+	cut := strings.Repeat("a", sniffLen-1) + "é"
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		encoding    string
+		text        string
+	}{
+		{"utf-8", []byte("<p>café</p>"), "text/html", "utf-8", "<p>café</p>"},
+		{"utf-8 bom", []byte("\xef\xbb\xbf<p>café</p>"), "text/html; charset=windows-1252", "utf-8", "<p>café</p>"},
+		{"utf-16 bom", encode(utf16le, "<p>café</p>"), "text/html", "utf-16le", "<p>café</p>"},
+		{"content-type", encode(charmap.Windows1251, "<p>привет</p>"), "text/html; charset=Windows-1251", "windows-1251", "<p>привет</p>"},
+		{"content-type wins", encode(charmap.Windows1251, `<meta charset="utf-8"><p>привет</p>`), "text/html; charset=cp1251", "windows-1251", `<meta charset="utf-8"><p>привет</p>`},
+		{"meta charset", encode(japanese.ShiftJIS, `<meta charset="Shift_JIS"><p>日本語</p>`), "text/html", "shift_jis", `<meta charset="Shift_JIS"><p>日本語</p>`},
+		{"meta http-equiv", encode(charmap.Windows1252, `<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-1"><p>café</p>`), "", "windows-1252",
+			`<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-1"><p>café</p>`},
+		{"meta utf-16", []byte(`<meta charset="utf-16"><p>café</p>`), "text/html", "utf-8", `<meta charset="utf-16"><p>café</p>`},
+		{"unknown charset", []byte("<p>café</p>"), "text/html; charset=klingon", "utf-8", "<p>café</p>"},
+		{"undeclared latin", encode(charmap.Windows1252, "<p>café</p>"), "text/html", "windows-1252", "<p>café</p>"},
+		{"undeclared cut rune", []byte(cut), "text/html", "utf-8", cut},
+		{"empty", nil, "", "utf-8", ""},
+	}
+	for _, tt := range tests {
+		r, name := decodeDocument(bytes.NewReader(tt.body), tt.contentType)
+		check(t, name == tt.encoding, "%s: want encoding %q, got %q", tt.name, tt.encoding, name)
+		text, err := ioutil.ReadAll(r)
+		check(t, err == nil, "%s: couldn't decode, %v", tt.name, err)
+		check(t, string(text) == tt.text, "%s: want text %q, got %q", tt.name, tt.text, text)
+	}
+}
+
+func TestCharsetOfContent(t *testing.T) {
+	tests := []struct {
+		content, want string
+	}{
+		{"text/html; charset=utf-8", "utf-8"},
+		{"text/html;charset = 'koi8-r'", "koi8-r"},
+		{`text/html; CHARSET="euc-jp"; foo`, "euc-jp"},
+		{"text/html; charset=big5 more", "big5"},
+		{"charsetcharset=gbk", "gbk"},
+		{`charset="unterminated`, ""},
+		{"text/html", ""},
+	}
+	for _, tt := range tests {
+		got := charsetOfContent(tt.content)
+		check(t, got == tt.want, "%q: want %q, got %q", tt.content, tt.want, got)
+	}
+}
+
+func TestCrawlDecodesPages(t *testing.T) {
+	pages := map[string][]byte{
+		"/": []byte(`<a href="/sjis"></a><a href="/cp1251"></a><a href="/latin1"></a>`),
+		"/sjis": encode(japanese.ShiftJIS,
+			`<meta charset="shift_jis"><a href="/日本語"></a>`),
+		"/cp1251": encode(charmap.Windows1251,
+			`<a href="/привет"></a>`),
+		"/latin1": encode(charmap.Windows1252,
+			`<meta http-equiv="content-type" content="text/html; charset=iso-8859-1"><a href="/café"></a>`),
+		"/日本語":    []byte(`<p>ok</p>`),
+		"/привет": []byte(`<p>ok</p>`),
+		"/café":   []byte(`<p>ok</p>`),
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		contentType := "text/html"
+		if r.URL.Path == "/cp1251" {
+			contentType += "; charset=windows-1251"
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(page)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		c, err := NewCrawler(domain, testAgent)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		got := make(map[string]string)
+		g.Walk(func(link string, status int, _, _ []string) bool {
+			path := must(url.Parse(link)).Path
+			check(t, status == 200, "%s: want a 200, got %d", path, status)
+			info, _ := g.Info(link)
+			got[path] = info.Encoding
+			return true
+		})
+		want := map[string]string{
+			"":        "utf-8",
+			"/sjis":   "shift_jis",
+			"/cp1251": "windows-1251",
+			"/latin1": "windows-1252",
+			"/日本語":    "utf-8",
+			"/привет": "utf-8",
+			"/café":   "utf-8",
+		}
+		check(t, reflect.DeepEqual(want, got), "want encodings %v, got %v", want, got)
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aybabtme/crawler"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// authRules are the flags authenticating the crawl, as given.
+type authRules struct {
+	headers     []string // Name: value
+	basicAuth   []string // host=user:password
+	bearer      []string // host=token
+	cookies     []string // name=value
+	loginURL    string
+	loginForm   string
+	loginFields []string // name=value
+	logout      string
+}
+
+// buildAuth parses the rules, the crawl is anonymous when there are none.
+func buildAuth(rules authRules) (*crawler.Auth, error) {
+	auth := &crawler.Auth{Headers: make(http.Header)}
+	anonymous := true
+
+	for _, header := range rules.headers {
+		i := strings.Index(header, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q, want Name: value", header)
+		}
+		auth.Headers.Add(strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:]))
+		anonymous = false
+	}
+	for _, basic := range rules.basicAuth {
+		host, userinfo, ok := cut(basic, "=")
+		user, password, hasPassword := cut(userinfo, ":")
+		if !ok || host == "" || !hasPassword {
+			return nil, fmt.Errorf("invalid basic auth %q, want host=user:password", basic)
+		}
+		auth.Credentials = append(auth.Credentials, crawler.Credential{Host: host, Username: user, Password: password})
+		anonymous = false
+	}
+	for _, bearer := range rules.bearer {
+		host, token, ok := cut(bearer, "=")
+		if !ok || host == "" || token == "" {
+			return nil, fmt.Errorf("invalid bearer token %q, want host=token", bearer)
+		}
+		auth.Credentials = append(auth.Credentials, crawler.Credential{Host: host, Token: token})
+		anonymous = false
+	}
+	for _, cookie := range rules.cookies {
+		name, value, ok := cut(cookie, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid cookie %q, want name=value", cookie)
+		}
+		auth.Cookies = append(auth.Cookies, &http.Cookie{Name: name, Value: value})
+		anonymous = false
+	}
+
+	if rules.loginURL != "" {
+		auth.Login = &crawler.FormLogin{URL: rules.loginURL, Form: rules.loginForm, Fields: make(url.Values)}
+		for _, field := range rules.loginFields {
+			name, value, ok := cut(field, "=")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("invalid login field %q, want name=value", field)
+			}
+			auth.Login.Fields.Add(name, value)
+		}
+		anonymous = false
+	} else if rules.loginForm != "" || len(rules.loginFields) != 0 {
+		return nil, fmt.Errorf("login form and fields need a login URL")
+	}
+
+	if rules.logout != "" {
+		logout, err := regexp.Compile(rules.logout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logout pattern, %v", err)
+		}
+		auth.Logout = logout
+	}
+
+	if anonymous {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// cut slices s around the first sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
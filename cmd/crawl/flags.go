@@ -0,0 +1,36 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// stringsFlag is a flag that can be given many times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// regexpsFlag is a flag of regular expressions that can be given many
+// times.
+type regexpsFlag []*regexp.Regexp
+
+func (r *regexpsFlag) String() string {
+	var exprs []string
+	for _, re := range *r {
+		exprs = append(exprs, re.String())
+	}
+	return strings.Join(exprs, ",")
+}
+
+func (r *regexpsFlag) Set(v string) error {
+	re, err := regexp.Compile(v)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, re)
+	return nil
+}
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"github.com/aybabtme/crawler"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -20,6 +21,7 @@ var (
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: %s [opts]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s robots-test [opts] URL...\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -31,8 +33,90 @@ func perror(format string, args ...interface{}) {
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "robots-test" {
+		robotsTest(os.Args[2:])
+		return
+	}
+
 	host := flag.String("h", "", "host to crawl")
 	filename := flag.String("f", defaultFilename, "file where to write sitemap, will truncate if already exists")
+	ignoreMeta := flag.Bool("ignore-meta-robots", false, "ignore the directives of robots meta tags")
+	ignoreHeader := flag.Bool("ignore-robots-header", false, "ignore the directives of X-Robots-Tag headers")
+	robotsRetries := flag.Int("robots-retries", 0, "times to retry fetching robots.txt when the server errors, before disallowing everything")
+	relNoFollow := flag.Bool("rel-nofollow", false, "don't follow links marked rel=\"nofollow\"")
+
+	var (
+		hosts, includePrefixes, excludePrefixes stringsFlag
+		include, exclude                        regexpsFlag
+	)
+	subdomains := flag.Bool("subdomains", false, "crawl the whole registrable domain of the host, with its subdomains")
+	schemeEquivalent := flag.Bool("scheme-equivalent", false, "treat the http and https versions of a URL as the same")
+	flag.Var(&hosts, "allow-host", "other host to crawl along with the main one, can be repeated")
+	flag.Var(&includePrefixes, "include-prefix", "only crawl the paths with this prefix, can be repeated")
+	flag.Var(&excludePrefixes, "exclude-prefix", "don't crawl the paths with this prefix, can be repeated")
+	flag.Var(&include, "include", "only crawl the URLs matching this regexp, can be repeated")
+	flag.Var(&exclude, "exclude", "don't crawl the URLs matching this regexp, can be repeated")
+	checkExternal := flag.Bool("check-external", false, "check that links to other web sites work, without crawling them")
+	externalDelay := flag.Duration("external-delay", time.Second, "minimum time between two requests to an external host")
+	getLeaves := flag.Bool("get-leaves", false, "download images, videos and scripts instead of only asking for their headers")
+	maxBodySize := flag.Int64("max-body-size", 10<<20, "bytes of a response body to read at most, 0 reads it all")
+	textLinks := flag.Bool("text-links", true, "guess links from the URLs written out in plain text documents")
+	jsonLinks := flag.Bool("json-links", false, "guess links from the URL-valued strings of JSON documents")
+	scriptLinks := flag.Bool("script-links", false, "guess links from the same-origin string literals of scripts, which are then downloaded")
+
+	var lowercaseHosts stringsFlag
+	normalizePreset := flag.String("normalize", "default", "how links are normalized: safe, default or aggressive")
+	punycode := flag.Bool("punycode", false, "convert internationalized host names to punycode")
+	stripTracking := flag.Bool("strip-tracking", false, "remove tracking parameters like utm_source and fbclid from links")
+	stripSessions := flag.Bool("strip-sessions", false, "remove session IDs from links")
+	sortQuery := flag.Bool("sort-query", false, "sort the query parameters of links by key")
+	flag.Var(&lowercaseHosts, "lowercase-path", "lowercase the paths on this case-insensitive host, can be repeated")
+	mergeCanonicals := flag.Bool("merge-canonicals", false, "merge the pages into the canonical they declare, in the sitemap")
+	canonicalReport := flag.String("canonical-report", "", "file where to write the canonical chains, loops and broken canonicals")
+	duplicateReport := flag.String("duplicate-report", "", "file where to write the clusters of duplicate and near duplicate pages")
+	similarity := flag.Float64("similarity", 0.9, "how similar, from 0 to 1, the text of pages must be to be near duplicates")
+	mirror := flag.String("mirror", "", "directory where to save every page and asset crawled, in a tree following their URLs")
+	mirrorRewrite := flag.Bool("mirror-rewrite", false, "rewrite the links of the mirrored HTML and CSS to the local copies, to browse it offline")
+	warcDir := flag.String("warc", "", "directory where to write WARC files of every request and response")
+	warcPrefix := flag.String("warc-prefix", "crawl", "prefix of the names of the WARC files")
+	warcMaxSize := flag.Int64("warc-max-size", 1<<30, "bytes after which a new WARC file is started, 0 for one file")
+	previous := flag.String("previous", "", "site map of a previous crawl, to only download again the pages that changed")
+	cacheDir := flag.String("cache", "", "directory where to cache the responses on disk, to crawl the same site again without asking for everything")
+	cacheOffline := flag.Bool("cache-offline", false, "answer only from the cache, never asking the server")
+	cacheTTL := flag.Duration("cache-ttl", 0, "how long the cached responses stay fresh, whatever they say, 0 to follow their headers")
+	var headers, basicAuth, bearer, cookies, loginFields stringsFlag
+	flag.Var(&headers, "header", "header added to the requests to the crawled host, like \"X-Env: staging\", can be repeated")
+	flag.Var(&basicAuth, "basic-auth", "HTTP basic auth credentials for a host, like example.com=user:password, can be repeated")
+	flag.Var(&bearer, "bearer", "bearer token for a host, like api.example.com=token, can be repeated")
+	flag.Var(&cookies, "cookie", "cookie set for the host before crawling, like name=value, can be repeated")
+	loginURL := flag.String("login-url", "", "page with a login form to fill and submit before crawling")
+	loginForm := flag.String("login-form", "", "CSS selector of the login form, the first form with a password field by default")
+	flag.Var(&loginFields, "login-field", "value to fill in the login form, like password=secret, can be repeated")
+	logout := flag.String("logout", "", "regexp matching the paths and queries not to crawl once authenticated, for they'd log out")
+	transportOpts := crawler.DefaultTransportOptions()
+	flag.DurationVar(&transportOpts.ConnectTimeout, "connect-timeout", transportOpts.ConnectTimeout, "how long connecting to a server can take, 0 for no limit")
+	flag.DurationVar(&transportOpts.TLSHandshakeTimeout, "tls-timeout", transportOpts.TLSHandshakeTimeout, "how long the TLS handshake can take, 0 for no limit")
+	flag.DurationVar(&transportOpts.ResponseHeaderTimeout, "header-timeout", transportOpts.ResponseHeaderTimeout, "how long a server can take to send the headers of its response, 0 for no limit")
+	flag.DurationVar(&transportOpts.Timeout, "timeout", transportOpts.Timeout, "how long a whole request can take, body included, 0 for no limit")
+	proxy := flag.String("proxy", "", "URL of the proxy for every request, HTTP_PROXY and HTTPS_PROXY are used by default")
+	flag.BoolVar(&transportOpts.NoProxy, "no-proxy", false, "connect directly to the servers, ignoring the proxy of the environment")
+	var caCerts stringsFlag
+	flag.Var(&caCerts, "ca-cert", "PEM bundle of certificate authorities to trust along with the system ones, can be repeated")
+	flag.StringVar(&transportOpts.ClientCert, "client-cert", "", "PEM file of the client certificate sent to the servers asking for one")
+	flag.StringVar(&transportOpts.ClientKey, "client-key", "", "PEM file of the key of the client certificate, if not in -client-cert")
+	flag.BoolVar(&transportOpts.InsecureSkipVerify, "insecure", false, "accept any TLS certificate, for self-signed test servers only")
+	flag.BoolVar(&transportOpts.HTTP2, "http2", transportOpts.HTTP2, "negotiate HTTP/2 with the servers supporting it")
+	var replays stringsFlag
+	flag.Var(&replays, "replay", "WARC file or HTTP archive (.har) to crawl instead of the site, can be repeated")
+	traps := crawler.DefaultTrapLimits()
+	flag.IntVar(&traps.MaxSegmentRepeats, "max-segment-repeats", traps.MaxSegmentRepeats, "times a segment can appear in a path, 0 for no limit")
+	flag.IntVar(&traps.MaxPathLength, "max-path-length", traps.MaxPathLength, "longest path to crawl, in bytes, 0 for no limit")
+	flag.IntVar(&traps.MaxQueryVariants, "max-query-variants", traps.MaxQueryVariants, "queries to crawl per path, 0 for no limit")
+	flag.IntVar(&traps.MaxPathVariants, "max-path-variants", traps.MaxPathVariants, "paths to crawl per path template, numbers aside, 0 for no limit")
+	flag.IntVar(&traps.MaxPagesPerDirectory, "max-dir-pages", traps.MaxPagesPerDirectory, "pages to crawl per directory, 0 for no limit")
+	logFormat := flag.String("log-format", "logfmt", "format of the log written to standard error: logfmt or json")
+	logLevel := flag.String("log-level", "info", "least important log entries written: debug, info, warn or error")
+	listen := flag.String("listen", "", "address where to serve Prometheus metrics on /metrics and the status on /status, like localhost:9100")
 	flag.Usage = usage
 	flag.Parse()
 
@@ -50,30 +134,256 @@ func main() {
 		perror("invalid host: %v\n", err)
 	}
 
+	logger, err := newLogger(*logFormat, *logLevel)
+	if err != nil {
+		perror("%v\n", err)
+	}
+
 	start := time.Now()
-	log.Printf("starting crawl on %v", hostURL.String())
-	defer func() { log.Printf("done in %v", time.Since(start)) }()
+	logger.Log(crawler.LevelInfo, "starting crawl", "url", hostURL)
+	defer func() { logger.Log(crawler.LevelInfo, "done", "elapsed", time.Since(start)) }()
+
+	opts := crawler.DefaultOptions()
+	opts.Logger = logger
+	if *listen != "" {
+		metrics := crawler.NewMetricsObserver()
+		opts.Observer = crawler.ObserverList{crawler.NewLogObserver(logger), metrics}
+		go serveMetrics(logger, *listen, metrics)
+	}
+	opts.MetaRobots = !*ignoreMeta
+	opts.RobotsHeader = !*ignoreHeader
+	opts.RelNoFollow = *relNoFollow
+
+	if *subdomains {
+		opts.Scope = crawler.DomainScope(hostURL)
+	} else {
+		opts.Scope = crawler.HostScope(hostURL)
+	}
+	opts.Scope.Hosts = append(opts.Scope.Hosts, hosts...)
+	opts.Scope.SchemeEquivalent = opts.Scope.SchemeEquivalent || *schemeEquivalent
+	opts.Scope.IncludePrefixes = includePrefixes
+	opts.Scope.ExcludePrefixes = excludePrefixes
+	opts.Scope.Include = include
+	opts.Scope.Exclude = exclude
+
+	opts.CheckExternal = *checkExternal
+	opts.ExternalDelay = *externalDelay
+	opts.Traps = traps
+	opts.HeadLeaves = !*getLeaves
+	opts.MaxBodySize = *maxBodySize
+	opts.TextLinks = *textLinks
+	opts.JSONLinks = *jsonLinks
+	opts.ScriptLinks = *scriptLinks
+	opts.Mirror = *mirror
+	opts.MirrorRewrite = *mirrorRewrite
+	if *robotsRetries > 0 {
+		opts.RobotsFailure = crawler.RobotsRetry
+		opts.RobotsRetries = *robotsRetries
+	}
+
+	opts.Normalizer, err = buildNormalizer(*normalizePreset, normalizerRules{
+		punycode:       *punycode,
+		stripTracking:  *stripTracking,
+		stripSessions:  *stripSessions,
+		sortQuery:      *sortQuery,
+		lowercaseHosts: lowercaseHosts,
+	})
+	if err != nil {
+		perror("%v\n", err)
+	}
+
+	opts.Auth, err = buildAuth(authRules{
+		headers:     headers,
+		basicAuth:   basicAuth,
+		bearer:      bearer,
+		cookies:     cookies,
+		loginURL:    *loginURL,
+		loginForm:   *loginForm,
+		loginFields: loginFields,
+		logout:      *logout,
+	})
+	if err != nil {
+		perror("%v\n", err)
+	}
+
+	if *previous != "" {
+		opts.Previous, err = readGraph(*previous)
+		if err != nil {
+			fatal(logger, "reading previous crawl", err)
+		}
+	}
+
+	transportOpts.CAFiles = caCerts
+	if *proxy != "" {
+		if transportOpts.Proxy, err = url.Parse(*proxy); err != nil {
+			perror("invalid proxy: %v\n", err)
+		}
+	}
+	client, err := crawler.NewClient(transportOpts)
+	if err != nil {
+		fatal(logger, "creating HTTP client", err)
+	}
+
+	transport := client.Transport
+	if len(replays) > 0 {
+		replay, err := loadReplay(replays)
+		if err != nil {
+			fatal(logger, "loading replay", err)
+		}
+		transport = replay
+	}
+	if *cacheDir != "" {
+		cache, err := crawler.NewDiskCache(*cacheDir, transport)
+		if err != nil {
+			fatal(logger, "creating cache", err)
+		}
+		cache.Offline = *cacheOffline
+		cache.TTL = *cacheTTL
+		transport = cache
+	}
+	// outside the cache, for its hits to be recorded too
+	var warc *crawler.WARCWriter
+	if *warcDir != "" {
+		warc, err = crawler.NewWARCWriter(*warcDir, *warcPrefix, *warcMaxSize, warcInfo())
+		if err != nil {
+			fatal(logger, "creating WARC writer", err)
+		}
+		transport = crawler.NewWARCRecorder(transport, warc, *maxBodySize)
+	}
+	client.Transport = transport
+	opts.Client = client
 
-	c, err := crawler.NewCrawler(hostURL, agent)
+	c, err := crawler.NewCrawlerWithOptions(hostURL, agent, opts)
 	if err != nil {
-		log.Fatalf("[error] creating crawler, %v", err)
+		fatal(logger, "creating crawler", err)
 	}
 
 	dig, err := c.Crawl()
 	if err != nil {
-		log.Fatalf("[error] during crawl, %v", err)
+		fatal(logger, "during crawl", err)
+	}
+
+	if warc != nil {
+		if err := warc.Close(); err != nil {
+			fatal(logger, "closing WARC file", err)
+		}
+	}
+
+	if *canonicalReport != "" {
+		logger.Log(crawler.LevelInfo, "saving canonical report", "file", *canonicalReport)
+		if err := writeJSON(*canonicalReport, crawler.ReportCanonicals(dig)); err != nil {
+			fatal(logger, "writing canonical report", err)
+		}
+	}
+	if *duplicateReport != "" {
+		logger.Log(crawler.LevelInfo, "saving duplicate report", "file", *duplicateReport)
+		if err := writeJSON(*duplicateReport, crawler.ReportDuplicates(dig, *similarity)); err != nil {
+			fatal(logger, "writing duplicate report", err)
+		}
+	}
+	if *mergeCanonicals {
+		dig = crawler.MergeCanonicals(dig)
 	}
 
-	log.Printf("preparing sitemap")
+	logger.Log(crawler.LevelInfo, "saving sitemap", "file", *filename)
+	if err := writeJSON(*filename, dig); err != nil {
+		fatal(logger, "writing sitemap", err)
+	}
+
+}
+
+// newLogger writes to standard error in the format, with entries at least
+// as important as level.
+func newLogger(format, level string) (crawler.Logger, error) {
+	min, err := crawler.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "logfmt":
+		return crawler.NewLogfmtLogger(os.Stderr, min), nil
+	case "json":
+		return crawler.NewJSONLogger(os.Stderr, min), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
 
-	data, err := json.MarshalIndent(dig, "", "    ")
+func readGraph(filename string) (crawler.ResourceGraph, error) {
+	f, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("[error] marshaling sitemap to JSON, %v", err)
+		return nil, err
+	}
+	defer f.Close()
+	return crawler.ReadGraph(f)
+}
+
+// loadReplay reads the WARC files and HTTP archives, told apart by their
+// extension.
+func loadReplay(filenames []string) (*crawler.Replay, error) {
+	replay := crawler.NewReplay()
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(strings.ToLower(filename), ".har") {
+			err = replay.ReadHAR(f)
+		} else {
+			err = replay.ReadWARC(f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %q, %v", filename, err)
+		}
 	}
+	return replay, nil
+}
+
+// secretFlags hold credentials, their values are kept out of the
+// archives.
+var secretFlags = map[string]bool{
+	"header":      true,
+	"basic-auth":  true,
+	"bearer":      true,
+	"cookie":      true,
+	"login-field": true,
+	"proxy":       true,
+}
 
-	log.Printf("saving to %q", *filename)
-	if err := ioutil.WriteFile(*filename, data, 0666); err != nil {
-		log.Fatalf("[error] writing sitemap to file, %v", err)
+// warcInfo describes the crawl in the warcinfo records: the agent, and
+// every option with its value, secrets aside.
+func warcInfo() []crawler.WARCField {
+	info := []crawler.WARCField{{Name: "http-header-user-agent", Value: agent}}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "redacted"
+		}
+		info = append(info, crawler.WARCField{Name: "crawl-option", Value: "-" + f.Name + "=" + value})
+	})
+	return info
+}
+
+// serveMetrics serves the progress of the crawl until the program exits.
+func serveMetrics(logger crawler.Logger, addr string, metrics *crawler.MetricsObserver) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Metrics())
+	mux.Handle("/status", metrics.StatusPage())
+	logger.Log(crawler.LevelInfo, "serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Log(crawler.LevelError, "serving metrics", "err", err)
 	}
+}
 
+func fatal(logger crawler.Logger, msg string, err error) {
+	logger.Log(crawler.LevelError, msg, "err", err)
+	os.Exit(1)
+}
+
+func writeJSON(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
 }
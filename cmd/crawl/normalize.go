@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aybabtme/crawler"
+)
+
+var normalizerPresets = map[string]crawler.Normalizer{
+	"safe":       crawler.SafeNormalizer,
+	"default":    crawler.DefaultNormalizer,
+	"aggressive": crawler.AggressiveNormalizer,
+}
+
+// normalizerRules are the rules that can be added to a preset, in the
+// order they're applied.
+type normalizerRules struct {
+	punycode       bool
+	stripTracking  bool
+	stripSessions  bool
+	sortQuery      bool
+	lowercaseHosts []string
+}
+
+// buildNormalizer chains the rules around a preset. Hosts are converted
+// to punycode first, so that the preset sees them in ASCII.
+func buildNormalizer(preset string, rules normalizerRules) (crawler.Normalizer, error) {
+	base, ok := normalizerPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown normalization preset %q", preset)
+	}
+
+	var chain crawler.NormalizerChain
+	if rules.punycode {
+		chain = append(chain, crawler.PunycodeHost)
+	}
+	chain = append(chain, base)
+	if rules.stripTracking {
+		chain = append(chain, crawler.StripTrackingParams)
+	}
+	if rules.stripSessions {
+		chain = append(chain, crawler.StripSessionIDs)
+	}
+	if rules.sortQuery {
+		chain = append(chain, crawler.SortQueryKeys)
+	}
+	if len(rules.lowercaseHosts) != 0 {
+		chain = append(chain, crawler.LowercasePath(rules.lowercaseHosts...))
+	}
+
+	if len(chain) == 1 {
+		return base, nil
+	}
+	return chain, nil
+}
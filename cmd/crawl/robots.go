@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aybabtme/crawler"
+	"net/url"
+	"os"
+)
+
+// robotsTest explains which robots.txt rule allows or blocks each URL
+// given in args. Exits with status 1 if any URL is blocked.
+func robotsTest(args []string) {
+	fset := flag.NewFlagSet("robots-test", flag.ExitOnError)
+	ua := fset.String("agent", agent, "user agent to test the URLs for")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s robots-test [opts] URL...\n", os.Args[0])
+		fset.PrintDefaults()
+		os.Exit(2)
+	}
+	_ = fset.Parse(args)
+
+	if fset.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "missing URL to test\n")
+		fset.Usage()
+	}
+
+	blocked := false
+	for _, raw := range fset.Args() {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "invalid URL %q\n", raw)
+			os.Exit(2)
+		}
+
+		verdict, err := crawler.ExplainRobots(u, *ua, crawler.DefaultOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[error] reading robots.txt for %q, %v\n", raw, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s\t%v\n", u, verdict)
+		blocked = blocked || !verdict.Allowed
+	}
+
+	if blocked {
+		os.Exit(1)
+	}
+}
@@ -2,14 +2,17 @@ package crawler
 
 import (
 	"code.google.com/p/go.net/html"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"github.com/PuerkitoBio/goquery"
-	"github.com/PuerkitoBio/purell"
-	"github.com/temoto/robotstxt-go"
-	"log"
+	"io"
+	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // Crawler produces a ResourceGraph from within a single domain.
@@ -21,102 +24,278 @@ type Crawler interface {
 // starting with domain, plus the links provided in the sitemap. The
 // sitemap is reported by robots.txt.
 //
-// Crawler will write to standard log as it progresses.
+// Crawler is quiet, give a Logger or an Observer in the options of
+// NewCrawlerWithOptions to follow its progress.
 func NewCrawler(domain *url.URL, agent string) (Crawler, error) {
-	base, err := cleanFromURLString(domain, "/")
-	if err != nil {
-		return nil, err
+	return NewCrawlerWithOptions(domain, agent, DefaultOptions())
+}
+
+// NewCrawlerWithOptions creates a Crawler like NewCrawler does, with the
+// given options instead of the default ones.
+func NewCrawlerWithOptions(domain *url.URL, agent string, opts Options) (Crawler, error) {
+	normalizer := opts.Normalizer
+	if normalizer == nil {
+		normalizer = DefaultNormalizer
 	}
 
-	robot, err := makeRobot(domain)
+	base, err := cleanFromURLString(domain, "/", normalizer)
 	if err != nil {
 		return nil, err
 	}
 
-	return &crawler{
-		resources: htmlResources,
-		base:      base,
-		robot:     robot,
-		group:     robot.FindGroup(agent),
-		agent:     agent,
-	}, err
-}
-
-func makeRobot(host *url.URL) (r *robotstxt.RobotsData, err error) {
-	robotURL, err := host.Parse("/robots.txt")
+	client, err := clientOf(opts)
 	if err != nil {
-		return nil, fmt.Errorf("parsing robots.txt URL, %v", err)
+		return nil, err
+	}
+	if opts.Auth != nil {
+		if client, err = opts.Auth.client(client, base); err != nil {
+			return nil, err
+		}
+		if opts.Auth.Login != nil {
+			if err := opts.Auth.Login.login(client, agent, base); err != nil {
+				return nil, fmt.Errorf("logging in, %v", err)
+			}
+		}
 	}
 
-	resp, err := http.Get(robotURL.String())
+	robot, err := newRobots(domain, agent, client, opts)
 	if err != nil {
 		return nil, fmt.Errorf("retrieving robots.txt, %v", err)
 	}
-	defer func() { err = resp.Body.Close() }()
 
-	return robotstxt.FromResponse(resp)
+	observer := opts.Observer
+	if observer == nil {
+		observer = NewLogObserver(loggerOf(opts))
+	}
+	robot.observer = observer
+
+	scope := opts.Scope
+	if scope == nil {
+		scope = HostScope(base)
+	}
+
+	var saver *mirror
+	if opts.Mirror != "" {
+		saver = newMirror(opts.Mirror, normalizer)
+	}
+
+	var previous *previousCrawl
+	if opts.Previous != nil {
+		previous = newPreviousCrawl(opts.Previous)
+	}
+
+	htmlx := &htmlExtractor{
+		resources:   htmlResources,
+		agent:       agentToken(agent),
+		relNoFollow: opts.RelNoFollow,
+		normalizer:  normalizer,
+	}
+	return &crawler{
+		html:     htmlx,
+		xml:      &xmlExtractor{html: htmlx},
+		opts:     opts,
+		observer: observer,
+		client:   client,
+		base:     base,
+		scope:    scope,
+		robot:    robot,
+		hosts:    map[string]*robots{base.Host: robot},
+		agent:    agent,
+		mirror:   saver,
+		previous: previous,
+	}, err
 }
 
 type crawler struct {
-	resources []resourceLocator
-	base      *url.URL
-	robot     *robotstxt.RobotsData
-	group     *robotstxt.Group
-	agent     string
+	html     *htmlExtractor
+	xml      *xmlExtractor
+	opts     Options
+	observer Observer
+	client   *http.Client
+	base     *url.URL
+	scope    *Scope
+	robot    *robots
+	// robots.txt of every host in scope, including robot's
+	hosts map[string]*robots
+	agent string
+	// mirror saves the resources crawled, if not nil
+	mirror *mirror
+	// previous is the crawl to revalidate, if not nil
+	previous *previousCrawl
+}
+
+// fetchResult is what fetching a resource taught the crawler about it.
+type fetchResult struct {
+	status    int
+	followers []linkRef
+	robots    robotsDirectives
+	// truncated is set when the body was larger than the crawler reads
+	truncated bool
+	// bytes is how much of the body was read
+	bytes int64
+	// etag and lastModified are the validators the resource was served
+	// with
+	etag, lastModified string
+	// revalidated is set when the resource didn't change since the
+	// previous crawl, what's known of it comes from there
+	revalidated bool
+	// canonical is the preferred URL of the resource, if it has one
+	canonical *url.URL
+	// contentHash and simhash fingerprint the body of the documents
+	// that were parsed, contentHash is empty otherwise
+	contentHash string
+	simhash     uint64
+	// encoding is the character encoding the document was decoded from
+	encoding string
 }
 
 func (c *crawler) Crawl() (ResourceGraph, error) {
 
 	dig := newDigraph()
+	start := time.Now()
 
 	var (
-		fringe    urlQueue
-		followers []*url.URL
-		status    int
-		err       error
+		fringe   urlQueue
+		res      *fetchResult
+		err      error
+		external = newExternalChecker(c.client, c.agent, c.opts.ExternalDelay, c.robotsFor)
+		// leaves are only probed, not downloaded
+		leaves = newStringSet()
+		traps  = newTrapDetector(c.opts.Traps)
 	)
+	external.started = func(u *url.URL) { c.observer.FetchStarted(u, true) }
 
 	for _, root := range c.findRoots() {
-		fringe.Add(root)
+		if ok, _ := c.isAcceptable(root); ok {
+			fringe.Add(root)
+			c.observer.Enqueued(root, false)
+		}
 	}
 
-	log.Printf("[crawler] root has %d elements", fringe.Len())
-
 	for !fringe.IsEmpty() {
 		link := fringe.Remove()
 
-		followers, status, err = c.generateFollowers(link)
+		c.observer.FetchStarted(link, false)
+		fetchStart := time.Now()
+		if c.opts.HeadLeaves && c.mirror == nil && leaves.Contains(link.String()) {
+			res, err = c.probeLeaf(link)
+		} else {
+			res, err = c.generateFollowers(link)
+		}
 		if err != nil {
-			log.Printf("[crawler] error: %v", err)
+			c.observer.FetchDone(Fetch{URL: link, Status: -1, Elapsed: time.Since(fetchStart), Err: err})
 			continue
 		}
+		c.observer.FetchDone(Fetch{
+			URL:         link,
+			Status:      res.status,
+			Elapsed:     time.Since(fetchStart),
+			NoFollow:    res.robots.noFollow,
+			Truncated:   res.truncated,
+			Bytes:       res.bytes,
+			Revalidated: res.revalidated,
+		})
 
-		if status >= 400 {
-			dig.MarkStatus(link.String(), status)
-			log.Printf("[crawler] status %d : %q", status, link.String())
+		if res.status >= 400 {
+			dig.MarkStatus(link.String(), res.status)
 			continue
 		}
 
-		reject := 0
-		newLinks := 0
-		for _, follow := range followers {
-			if !c.isAcceptable(follow) {
-				reject++
+		if res.robots.noFollow {
+			res.followers = nil
+		}
+
+		for _, ref := range res.followers {
+			follow := ref.url
+			if c.opts.CheckExternal && c.scope.External(follow) {
+				isNew := !dig.Contains(follow.String())
+				if isNew {
+					external.Add(follow)
+					c.observer.Enqueued(follow, true)
+				}
+				dig.AddEdge(link.String(), follow.String())
+				dig.AddHref(follow.String(), ref.raw)
+				if ref.guessed {
+					dig.MarkGuessed(link.String(), follow.String())
+				}
+				dig.MarkExternal(follow.String())
+				c.observer.LinkDiscovered(link, follow, isNew)
 				continue
 			}
-			if !dig.Contains(follow.String()) {
+			if ok, reason := c.isAcceptable(follow); !ok {
+				dig.AddRejected(link.String(), follow.String(), reason)
+				c.observer.LinkRejected(link, follow, reason)
+				continue
+			}
+			follow = c.scope.Equivalent(c.base, follow)
+			if ok, heuristic := traps.admit(follow); !ok {
+				dig.AddRejected(link.String(), follow.String(), "trap: "+heuristic)
+				c.observer.LinkRejected(link, follow, "trap: "+heuristic)
+				continue
+			}
+			isNew := !dig.Contains(follow.String())
+			if isNew {
 				fringe.Add(follow)
-				newLinks++
+				c.observer.Enqueued(follow, false)
+				if c.isLeaf(ref, follow) {
+					leaves.Add(follow.String())
+				}
 			}
 			dig.AddEdge(link.String(), follow.String())
+			dig.AddHref(follow.String(), ref.raw)
+			if ref.guessed {
+				dig.MarkGuessed(link.String(), follow.String())
+			}
+			if ref.leaf {
+				dig.MarkLeaf(link.String(), follow.String())
+			}
+			c.observer.LinkDiscovered(link, follow, isNew)
 		}
 
-		log.Printf("[crawler] fringe=%d\tfound=%d (new=%d, rejected=%d)\tsource=%q", fringe.Len(), len(followers), newLinks, reject, link.String())
+		dig.MarkStatus(link.String(), res.status)
+		if res.robots.noIndex {
+			dig.MarkNoIndex(link.String())
+		}
+		if res.canonical != nil {
+			dig.MarkCanonical(link.String(), c.scope.Equivalent(c.base, res.canonical).String())
+		}
+		if res.contentHash != "" {
+			dig.MarkFingerprint(link.String(), res.contentHash, res.simhash)
+		}
+		if res.encoding != "" {
+			dig.MarkEncoding(link.String(), res.encoding)
+		}
+		if res.truncated {
+			dig.MarkTruncated(link.String())
+		}
+		if res.etag != "" || res.lastModified != "" {
+			dig.MarkValidators(link.String(), res.etag, res.lastModified)
+		}
+		if res.revalidated {
+			dig.MarkRevalidated(link.String())
+		}
+	}
 
-		dig.MarkStatus(link.String(), status)
+	for external.Len() != 0 {
+		checked := external.Next()
+		link := checked.link.String()
+		fetch := Fetch{URL: checked.link, Status: checked.status, Elapsed: checked.elapsed, Err: checked.err, External: true}
+		switch {
+		case checked.verdict != nil:
+			fetch.Err = &notCheckedError{verdict: checked.verdict}
+			dig.MarkError(link, fetch.Err.Error())
+		case checked.err != nil:
+			dig.MarkError(link, checked.err.Error())
+		}
+		dig.MarkStatus(link, checked.status)
+		c.observer.FetchDone(fetch)
+	}
+
+	if c.mirror != nil && c.opts.MirrorRewrite {
+		c.mirror.rewriteLinks(c.observer.Error)
 	}
 
-	log.Printf("[crawler] done crawling, %d resources, %d links", dig.ResourceCount(), dig.LinkCount())
+	c.observer.CrawlFinished(dig, time.Since(start))
 	return dig, err
 }
 
@@ -126,11 +305,16 @@ func (c *crawler) findRoots() []*url.URL {
 	roots := newStringSet()
 	roots.Add(c.base.String())
 
-	for _, site := range c.robot.Sitemaps {
-		dirtyU := must(c.base.Parse(site))
-		u := must(cleanFromURLString(dirtyU, ""))
-		if u.Host != c.base.Host {
-			log.Printf("Wrong sitemap domain: %q", site)
+	for _, site := range c.robot.Sitemaps() {
+		// robots.txt can say anything
+		u, err := cleanFromURLString(c.base, site, c.html.normalizer)
+		if err != nil {
+			robotsURL := &url.URL{Scheme: c.base.Scheme, Host: c.base.Host, Path: "/robots.txt"}
+			c.observer.Error(robotsURL, &sitemapError{site: site, err: err})
+			continue
+		}
+		if ok, _ := c.scope.Allows(u); !ok {
+			c.observer.Error(u, &sitemapError{site: site})
 			continue
 		}
 		roots.Add(u.String())
@@ -139,99 +323,321 @@ func (c *crawler) findRoots() []*url.URL {
 	return urls
 }
 
-func (c *crawler) isAcceptable(u *url.URL) bool {
+// sitemapError tells that a sitemap listed by robots.txt is left out,
+// because its URL is bad, or is out of the scope when err is nil.
+type sitemapError struct {
+	site string
+	err  error
+}
 
-	if u.Host != c.base.Host {
-		return false
+func (e *sitemapError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("bad sitemap URL: %q, %v", e.site, e.err)
 	}
+	return fmt.Sprintf("wrong sitemap domain: %q", e.site)
+}
 
-	allowed := c.group.Test(u.Path)
-	if !allowed {
-		return false
+// isAcceptable tells if u can be crawled. When it can't, reason says
+// which rule rejected it.
+func (c *crawler) isAcceptable(u *url.URL) (ok bool, reason string) {
+
+	if ok, rule := c.scope.Allows(u); !ok {
+		return false, "scope: " + rule
+	}
+
+	if c.opts.Auth.isLogout(u) {
+		return false, "logout: would end the session"
+	}
+
+	verdict := c.robotsFor(u).Explain(u)
+	if !verdict.Allowed {
+		return false, "robots.txt: " + verdict.String()
+	}
+
+	return true, ""
+}
+
+// robotsFor returns the robots.txt rules of u's host, fetching them the
+// first time the host is seen.
+func (c *crawler) robotsFor(u *url.URL) *robots {
+	robot, ok := c.hosts[u.Host]
+	if ok {
+		return robot
+	}
+
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	robot, err := newRobots(root, c.agent, c.client, c.opts)
+	if err != nil {
+		c.observer.Error(root, &robotsError{host: u.Host, instead: "disallows all", err: err})
+		robot = &robots{data: disallowAllRobots(err.Error())}
 	}
+	robot.observer = c.observer
+	c.hosts[u.Host] = robot
+	return robot
+}
 
-	return true
+// probeLeaf asks for the headers of a resource that shouldn't link
+// further. If the server says it's a document after all, it's fetched
+// and parsed like any other.
+func (c *crawler) probeLeaf(from *url.URL) (*fetchResult, error) {
+	resp, err := probe(c.client, c.agent, from)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &fetchResult{
+		status:       resp.StatusCode,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	if res.status >= 400 {
+		return res, nil
+	}
+	c.readHeaders(resp, res)
+
+	mediatype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && c.parses(mediatype) {
+		return c.generateFollowers(from)
+	}
+	return res, nil
 }
 
-func (c *crawler) generateFollowers(from *url.URL) (followers []*url.URL, status int, err error) {
+func (c *crawler) generateFollowers(from *url.URL) (res *fetchResult, err error) {
 	// use named return values to catch the resp.Body.Close() error
 	req, err := http.NewRequest("GET", from.String(), nil)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	req.Header.Add("User-Agent", c.agent)
-	resp, err := http.DefaultClient.Do(req)
+	previous, conditional := c.previous.validated(from)
+	if conditional {
+		setConditional(req, previous)
+	}
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	defer func() { err = resp.Body.Close() }()
 
-	status = resp.StatusCode
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		return c.previous.revalidated(previous, resp), nil
+	}
+
+	res = &fetchResult{
+		status:       resp.StatusCode,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
 
 	switch {
-	case status >= 400:
+	case res.status >= 400:
 		return
 	}
 
 	// the link exists/is usable (not 4xx/5xx)
 
-	mediatype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
-	if err != nil {
-		return
+	c.readHeaders(resp, res)
+
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	// the body is hashed as it's parsed, it's never held in memory
+	var in io.Reader = resp.Body
+	saved := c.saveTo(from, resp, mediatype)
+	if saved != nil {
+		// the mirror gets the whole body, past what's parsed
+		in = io.TeeReader(resp.Body, saved)
+	}
+	body := &cappedReader{r: in, max: c.opts.MaxBodySize}
+	var r io.Reader = body
+	if saved != nil {
+		defer func() {
+			// what isn't parsed is saved all the same
+			c.commitSaved(from, saved, io.MultiReader(body, in))
+			res.bytes, res.truncated = body.read, body.truncated
+		}()
 	}
 
-	switch mediatype {
-	// only try to find links in HTML, or perhaps XML documents
-	case "text/html",
-		"application/atom+xml",
-		"text/xml",
-		"text/plain",
-		"image/svg+xml":
-	default: // ignore everything else
+	if !c.parses(mediatype) {
 		return
 	}
 
-	node, err := html.Parse(resp.Body)
+	if isXMLType(mediatype) {
+		return c.parseXML(from, resp, r, body, res)
+	}
+	if guess := c.guesser(mediatype); guess != nil {
+		return c.parseGuessed(from, resp, r, body, res, guess)
+	}
+
+	// the body is hashed as it's served, and parsed as UTF-8
+	hash := sha256.New()
+	decoded, encoding := decodeDocument(io.TeeReader(r, hash), resp.Header.Get("Content-Type"))
+	node, err := html.Parse(decoded)
+	res.bytes = body.read
 	if err != nil {
 		return
 	}
+	res.truncated = body.truncated
+	res.encoding = encoding
+	res.contentHash = hex.EncodeToString(hash.Sum(nil))
+	res.simhash = simhash(visibleText(node))
+
+	// after redirects, links are relative to where we ended up
+	page := c.html.extract(resp.Request.URL, node)
+	res.followers = append(res.followers, page.links...)
+	if c.opts.MetaRobots {
+		res.robots = res.robots.merge(page.robots)
+	}
+	if res.canonical == nil {
+		res.canonical = page.canonical
+	}
 
-	add := func(link string) {
+	return
+}
 
-		u, err := cleanFromURLString(from, link)
-		if err == nil {
-			followers = append(followers, u)
+// parseXML finds the links of an XML document. A malformed document
+// keeps the links found before the error, which is reported unless the
+// body was cut short.
+func (c *crawler) parseXML(from *url.URL, resp *http.Response, r io.Reader, body *cappedReader, res *fetchResult) (*fetchResult, error) {
+	hash := sha256.New()
+	doc, err := c.xml.extract(resp.Request.URL, io.TeeReader(r, hash), resp.Header.Get("Content-Type"))
+	res.bytes = body.read
+	if _, malformed := err.(*xml.SyntaxError); malformed {
+		if !body.truncated {
+			c.observer.Error(from, fmt.Errorf("parsing XML, %v", err))
 		}
+	} else if err != nil {
+		return res, err
 	}
+	res.truncated = body.truncated
+	res.encoding = doc.encoding
+	res.contentHash = hex.EncodeToString(hash.Sum(nil))
+	res.simhash = simhash(doc.words)
+	res.followers = append(res.followers, doc.links...)
+	return res, nil
+}
 
-	doc := goquery.NewDocumentFromNode(node)
+// parseGuessed guesses the links of a document without markup. A
+// malformed JSON document keeps the links found before the error, which
+// is reported unless the body was cut short.
+func (c *crawler) parseGuessed(from *url.URL, resp *http.Response, r io.Reader, body *cappedReader, res *fetchResult, guess guessFunc) (*fetchResult, error) {
+	hash := sha256.New()
+	decoded, encoding := decodeDocument(io.TeeReader(r, hash), resp.Header.Get("Content-Type"))
+	doc, err := guess(resp.Request.URL, decoded, c.html.normalizer)
+	res.bytes = body.read
+	if _, malformed := err.(*json.SyntaxError); malformed || err == io.ErrUnexpectedEOF {
+		if !body.truncated {
+			c.observer.Error(from, fmt.Errorf("parsing JSON, %v", err))
+		}
+	} else if err != nil {
+		return res, err
+	}
+	res.truncated = body.truncated
+	res.encoding = encoding
+	res.contentHash = hex.EncodeToString(hash.Sum(nil))
+	res.simhash = simhash(doc.words)
+	res.followers = append(res.followers, doc.links...)
+	return res, nil
+}
 
-	for _, res := range c.resources {
-		doc.Find(res.cssSelector()).Each(func(_ int, s *goquery.Selection) {
-			val, ok := s.Attr(res.attr)
-			if !ok {
-				return
-			}
+// guesser is how the links of documents of the media type are guessed,
+// nil if they're not or if it's turned off.
+func (c *crawler) guesser(mediatype string) guessFunc {
+	switch {
+	case mediatype == "text/plain" && c.opts.TextLinks:
+		return guessTextLinks
+	case isJSONType(mediatype) && c.opts.JSONLinks:
+		return guessJSONLinks
+	case isScriptType(mediatype) && c.opts.ScriptLinks:
+		return guessScriptLinks
+	}
+	return nil
+}
 
-			add(val)
-		})
+// parses tells if links are looked for in documents of the media type.
+func (c *crawler) parses(mediatype string) bool {
+	return isParsedType(mediatype) || c.guesser(mediatype) != nil
+}
+
+// isLeaf tells if a link is to a resource that doesn't link further,
+// which scripts do when their links are guessed. The links whose
+// extension tells a type that's parsed aren't leaves either, like SVG
+// images, they'd be downloaded right after their HEAD.
+func (c *crawler) isLeaf(ref linkRef, u *url.URL) bool {
+	if c.opts.ScriptLinks && isScriptLink(u) {
+		return false
 	}
+	if mediatype, ok := parsedType(u); ok && c.parses(mediatype) {
+		return false
+	}
+	return ref.leaf || hasLeafExtension(u)
+}
 
-	return
+// saveTo opens the file of the mirror where the body of a response is
+// saved, nil if it isn't saved.
+func (c *crawler) saveTo(from *url.URL, resp *http.Response, mediatype string) *mirrorFile {
+	if c.mirror == nil || resp.StatusCode/100 != 2 {
+		return nil
+	}
+	file, err := c.mirror.create(resp.Request.URL, mediatype)
+	if err != nil {
+		c.observer.Error(from, err)
+		return nil
+	}
+	return file
 }
 
-func cleanFromURLString(from *url.URL, link string) (*url.URL, error) {
+// commitSaved copies what's left of the body to the mirror, and commits
+// the file.
+func (c *crawler) commitSaved(from *url.URL, saved *mirrorFile, rest io.Reader) {
+	_, err := io.Copy(ioutil.Discard, rest)
+	if cerr := c.mirror.commit(saved, from); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.observer.Error(from, fmt.Errorf("saving to the mirror, %v", err))
+	}
+}
+
+// readHeaders learns what the response headers tell about a resource:
+// its robots directives, and its canonical. A canonical given by a Link
+// header is followed like any other link, and wins over the one of the
+// document.
+func (c *crawler) readHeaders(resp *http.Response, res *fetchResult) {
+	if c.opts.RobotsHeader {
+		res.robots = parseRobotsHeader(resp.Header["X-Robots-Tag"], c.html.agent)
+	}
 
-	u, err := url.Parse(link)
-	if u.Host == "" {
-		u.Scheme = from.Scheme
-		u.Host = from.Host
+	canonicals := parseLinkHeader(resp.Header["Link"], "canonical")
+	if len(canonicals) == 0 {
+		return
+	}
+	canonical, err := cleanFromURLString(resp.Request.URL, canonicals[0], c.html.normalizer)
+	if err != nil {
+		return
 	}
-	uStr := purell.NormalizeURL(u, purell.FlagsUsuallySafeGreedy)
+	res.canonical = canonical
+	res.followers = append(res.followers, linkRef{url: canonical, raw: canonicals[0]})
+}
+
+// isParsedType tells if the markup of documents of the media type is
+// parsed for links.
+func isParsedType(mediatype string) bool {
+	// only HTML and XML documents, links are at best guessed from others
+	return mediatype == "text/html" || isXMLType(mediatype)
+}
 
-	clean, err := from.Parse(uStr)
+// cleanFromURLString resolves link against from, and normalizes the
+// result, with DefaultNormalizer if n is nil.
+func cleanFromURLString(from *url.URL, link string, n Normalizer) (*url.URL, error) {
 
-	return clean, err
+	u, err := from.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		n = DefaultNormalizer
+	}
+	return n.Normalize(u)
 }
 
 func must(u *url.URL, err error) *url.URL {
@@ -1,12 +1,17 @@
 package crawler
 
 import (
+	"fmt"
 	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -81,8 +86,576 @@ func TestGraphHasNoExtraResources(t *testing.T) {
 	})
 }
 
+func TestCrawlHonorsRobotsDirectives(t *testing.T) {
+	pages := map[string]string{
+		"/": `<a href="/header"></a><a href="/meta"></a><a href="/nofollow"></a>
+			<a href="/rel" rel="nofollow"></a>`,
+		"/header":   `<a href="/from_header"></a>`,
+		"/meta":     `<meta name="robots" content="noindex"><a href="/from_meta"></a>`,
+		"/nofollow": `<meta name="crawlerundertest" content="nofollow"><a href="/hidden"></a>`,
+		"/rel":      `<a href="/from_rel"></a>`,
+	}
+
+	tt := []struct {
+		name         string
+		opts         Options
+		wantNoIndex  []string
+		wantFound    []string
+		wantNotFound []string
+	}{
+		{
+			name:         "default options",
+			opts:         DefaultOptions(),
+			wantNoIndex:  []string{"/header", "/meta"},
+			wantFound:    []string{"/from_header", "/from_meta", "/rel", "/from_rel"},
+			wantNotFound: []string{"/hidden"},
+		},
+		{
+			name:         "rel nofollow",
+			opts:         Options{MetaRobots: true, RobotsHeader: true, RelNoFollow: true},
+			wantNoIndex:  []string{"/header", "/meta"},
+			wantNotFound: []string{"/hidden", "/rel", "/from_rel"},
+		},
+		{
+			name:      "everything ignored",
+			opts:      Options{},
+			wantFound: []string{"/hidden", "/from_header", "/from_meta", "/rel"},
+		},
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/header" {
+			w.Header().Set("X-Robots-Tag", "noindex")
+		}
+		htmlPages(pages)(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		for _, tt := range tt {
+			t.Logf("==== robots directives: %s ====", tt.name)
+
+			c, err := NewCrawlerWithOptions(domain, testAgent, tt.opts)
+			check(t, err == nil, "couldn't create crawler, %v", err)
+			g, err := c.Crawl()
+			check(t, err == nil, "couldn't crawl, %v", err)
+
+			noIndex := newStringSet()
+			for _, path := range tt.wantNoIndex {
+				noIndex.Add(must(domain.Parse(path)).String())
+			}
+			g.Walk(func(link string, _ int, _, _ []string) bool {
+				info, _ := g.Info(link)
+				check(t, info.NoIndex == noIndex.Contains(link), "want %q noindex=%v, got %v", link, noIndex.Contains(link), info.NoIndex)
+				return true
+			})
+
+			for _, path := range tt.wantFound {
+				link := must(domain.Parse(path)).String()
+				check(t, g.Contains(link), "crawler should know of %q", link)
+			}
+			for _, path := range tt.wantNotFound {
+				link := must(domain.Parse(path)).String()
+				check(t, !g.Contains(link), "crawler should not know of %q", link)
+			}
+			t.Log("ok!")
+		}
+	})
+}
+
+func TestCrawlScopeSpansSubdomains(t *testing.T) {
+	hosts := map[string]http.Handler{
+		"example.test": htmlPages(map[string]string{
+			"/": `<a href="http://www.example.test/a"></a>
+				<a href="http://blog.example.test/"></a>
+				<a href="http://other.test/"></a>
+				<a href="/private"></a>
+				<a href="/docs/old/a"></a>`,
+		}),
+		"www.example.test": htmlPages(map[string]string{
+			"/a": `<a href="http://example.test/"></a><a href="/private"></a>`,
+		}),
+		"blog.example.test": htmlPages(map[string]string{
+			"/": `<a href="http://www.example.test/a"></a>`,
+		}),
+		"other.test": htmlPages(map[string]string{
+			"/": `<a href="http://example.test/b"></a>`,
+		}),
+	}
+	robots := map[string]string{
+		"example.test":     "User-agent: *\nDisallow: /private\n",
+		"www.example.test": "User-agent: *\nDisallow:\n",
+	}
+
+	withVirtualHosts(t, hosts, robots, func(client *http.Client) {
+		root := must(url.Parse("http://example.test/"))
+		opts := DefaultOptions()
+		opts.Client = client
+		opts.Scope = DomainScope(root)
+		opts.Scope.ExcludePrefixes = []string{"/docs/old/"}
+
+		c, err := NewCrawlerWithOptions(root, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		for _, want := range []string{
+			"http://example.test",
+			"http://www.example.test/a",
+			"http://blog.example.test",
+			"http://www.example.test/private",
+		} {
+			check(t, g.Contains(want), "crawler should know of %q", want)
+		}
+
+		wantRejected := map[string]string{
+			"http://other.test":              `scope: host "other.test"`,
+			"http://example.test/private":    `robots.txt: blocked by line 2 "Disallow: /private", in group for *`,
+			"http://example.test/docs/old/a": `scope: excluded prefix "/docs/old/"`,
+		}
+		gotRejected := 0
+		g.WalkRejected(func(link, reason string, referedBy []string) bool {
+			gotRejected++
+			want, ok := wantRejected[link]
+			check(t, ok, "%q shouldn't be rejected, got %q", link, reason)
+			check(t, reason == want, "want %q rejected by %q, got %q", link, want, reason)
+			check(t, len(referedBy) == 1 && referedBy[0] == "http://example.test", "want %q refered by root, got %q", link, referedBy)
+			check(t, !g.Contains(link), "rejected %q shouldn't be in the graph", link)
+			return true
+		})
+		check(t, gotRejected == len(wantRejected), "want %d rejected links, got %d", len(wantRejected), gotRejected)
+	})
+}
+
+func TestCrawlChecksExternalLinks(t *testing.T) {
+	requests := map[string]int{}
+	hosts := map[string]http.Handler{
+		"example.test": htmlPages(map[string]string{
+			"/":  `<a href="http://other.test/page"></a><a href="http://other.test/missing"></a><a href="/a"></a>`,
+			"/a": `<a href="http://other.test/page"></a><a href="http://blocked.test/"></a><a href="http://down.test/"></a>`,
+		}),
+		"other.test": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests[r.Method+" "+r.URL.Path]++
+			htmlPages(map[string]string{
+				"/page": `<a href="http://other.test/never_crawled"></a>`,
+			})(w, r)
+		}),
+		"down.test": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			_ = conn.Close()
+		}),
+	}
+	robots := map[string]string{
+		"blocked.test": "User-agent: *\nDisallow: /\n",
+	}
+
+	withVirtualHosts(t, hosts, robots, func(client *http.Client) {
+		root := must(url.Parse("http://example.test/"))
+		opts := DefaultOptions()
+		opts.Client = client
+		opts.CheckExternal = true
+		opts.ExternalDelay = 0
+
+		c, err := NewCrawlerWithOptions(root, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		wantStatus := map[string]int{
+			"http://other.test/page":    200,
+			"http://other.test/missing": 404,
+			"http://blocked.test":       -1,
+			"http://down.test":          -1,
+		}
+		for link, status := range wantStatus {
+			info, ok := g.Info(link)
+			check(t, ok, "external link %q should be in the graph", link)
+			check(t, info.External, "%q should be external", link)
+			check(t, info.Status == status, "want %q status %d, got %d", link, status, info.Status)
+			check(t, len(info.RefersTo) == 0, "external %q shouldn't refer to anything, got %q", link, info.RefersTo)
+			check(t, (status == -1) == (info.Error != ""), "want %q error only when unchecked, got %q", link, info.Error)
+		}
+		info, _ := g.Info("http://blocked.test")
+		check(t, strings.HasPrefix(info.Error, "not checked, robots.txt: blocked"), "want blocked by robots.txt, got %q", info.Error)
+
+		check(t, !g.Contains("http://other.test/never_crawled"), "external links shouldn't be crawled")
+		check(t, requests["HEAD /page"] == 1, "want external link checked once with HEAD, got %v", requests)
+		check(t, requests["GET /page"] == 0, "want external link not downloaded, got %v", requests)
+
+		internal, _ := g.Info("http://example.test/a")
+		check(t, !internal.External, "internal link shouldn't be external")
+	})
+}
+
+func TestCrawlProbesLeaves(t *testing.T) {
+	requests := map[string]int{}
+	big := strings.Repeat("<p>filler</p>", 100) + `<a href="/after_cap"></a>`
+	pages := map[string]string{
+		"/": `<img src="/logo"><script src="/app.js"></script><a href="/photo.JPG"></a>
+			<a href="/page.js"></a><a href="/big"></a><img src="/icon.svg">`,
+		"/big":       big,
+		"/page.js":   `<a href="/from_page"></a>`,
+		"/after_cap": ``,
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+		switch r.URL.Path {
+		case "/logo", "/photo.JPG":
+			w.Header().Set("Content-Type", "image/png")
+		case "/app.js":
+			w.Header().Set("Content-Type", "application/javascript")
+		case "/icon.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			fmt.Fprint(w, `<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+		default:
+			htmlPages(pages)(w, r)
+		}
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		opts := DefaultOptions()
+		opts.MaxBodySize = 512
+
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		for _, path := range []string{"/logo", "/app.js", "/photo.JPG"} {
+			check(t, requests["HEAD "+path] == 1, "want leaf %q probed with HEAD, got %v", path, requests)
+			check(t, requests["GET "+path] == 0, "want leaf %q not downloaded, got %v", path, requests)
+			info, ok := g.Info(must(domain.Parse(path)).String())
+			check(t, ok && info.Status == 200, "want leaf %q in the graph with its status, got %+v", path, info)
+		}
+
+		// parsed, downloaded right away
+		check(t, requests["HEAD /icon.svg"] == 0 && requests["GET /icon.svg"] == 1, "want the SVG image downloaded once, got %v", requests)
+
+		// the extension lied, the server said it's HTML
+		check(t, requests["GET /page.js"] == 1, "want HTML leaf downloaded, got %v", requests)
+		check(t, g.Contains(must(domain.Parse("/from_page")).String()), "want links of HTML leaf followed")
+
+		info, _ := g.Info(must(domain.Parse("/big")).String())
+		check(t, info.Truncated, "want large page marked truncated")
+		check(t, !g.Contains(must(domain.Parse("/after_cap")).String()), "want links past the cap ignored")
+		info, _ = g.Info(must(domain.Parse("/page.js")).String())
+		check(t, !info.Truncated, "want small page not truncated")
+	})
+}
+
+func TestCrawlNormalizesLinks(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="a?utm_source=home"></a><a href="/a/"></a><a href="/A?fbclid=1"></a>`,
+		"/a": ``,
+	}
+
+	withHandler(t, htmlPages(pages), func(domain *url.URL) {
+		opts := DefaultOptions()
+		opts.Normalizer = NormalizerChain{DefaultNormalizer, StripTrackingParams, LowercasePath()}
+
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		check(t, g.ResourceCount() == 2, "want every link normalized to the same resource, got %d resources", g.ResourceCount())
+		info, ok := g.Info(must(domain.Parse("/a")).String())
+		check(t, ok, "want normalized link in the graph")
+
+		want := []string{"a?utm_source=home", "/a/", "/A?fbclid=1"}
+		check(t, len(info.Hrefs) == len(want), "want hrefs %q, got %q", want, info.Hrefs)
+		for i := range want {
+			check(t, info.Hrefs[i] == want[i], "want hrefs %q, got %q", want, info.Hrefs)
+		}
+	})
+}
+
+func TestCrawlRecordsCanonicals(t *testing.T) {
+	pages := map[string]string{
+		"/":          `<a href="/a?print=1"></a><a href="/doc.pdf"></a>`,
+		"/a":         `<link rel="canonical" href="/a">`,
+		"/a?print=1": `<link rel="canonical" href="/a">`,
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/doc.pdf" {
+			w.Header().Set("Link", `</docs/doc>; rel="canonical"`)
+			w.Header().Set("Content-Type", "application/pdf")
+			return
+		}
+		htmlPages(pages)(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		c, err := NewCrawler(domain, testAgent)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		link := func(path string) string { return must(domain.Parse(path)).String() }
+		for page, canonical := range map[string]string{
+			"/a?print=1": "/a",
+			"/a":         "/a",
+			"/doc.pdf":   "/docs/doc",
+		} {
+			info, _ := g.Info(link(page))
+			check(t, info.Canonical == link(canonical), "want %q canonical %q, got %q", page, canonical, info.Canonical)
+		}
+
+		a, _ := g.Info(link("/a"))
+		check(t, a.Status == 200, "want canonical crawled, got status %d", a.Status)
+		doc, _ := g.Info(link("/docs/doc"))
+		check(t, doc.Status == 404, "want canonical of header crawled, got status %d", doc.Status)
+
+		report := ReportCanonicals(g)
+		check(t, len(report.Broken) == 1 && report.Broken[0].URL == link("/doc.pdf"), "want broken canonical of the PDF, got %+v", report.Broken)
+
+		merged := MergeCanonicals(g)
+		check(t, !merged.Contains(link("/a?print=1")), "want print version merged into its canonical")
+	})
+}
+
+func TestCrawlFingerprintsPages(t *testing.T) {
+	text := strings.Repeat("the same words over and over again, ", 50)
+	pages := map[string]string{
+		"/":       `<a href="/a"></a><a href="/copy"></a><a href="/edited"></a><a href="/logo.png"></a>`,
+		"/a":      `<p>` + text + `</p>`,
+		"/copy":   `<p>` + text + `</p>`,
+		"/edited": `<p>` + text + ` and a few more</p>`,
+	}
+
+	withHandler(t, htmlPages(pages), func(domain *url.URL) {
+		c, err := NewCrawler(domain, testAgent)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		info := func(path string) ResourceInfo {
+			info, _ := g.Info(must(domain.Parse(path)).String())
+			return info
+		}
+		a, copied, edited := info("/a"), info("/copy"), info("/edited")
+		check(t, a.ContentHash != "" && a.ContentHash == copied.ContentHash, "want copies to have the same hash, got %q and %q", a.ContentHash, copied.ContentHash)
+		check(t, a.ContentHash != edited.ContentHash, "want edited copy to have another hash")
+		check(t, Similarity(a.SimHash, edited.SimHash) >= 0.9, "want edited copy to be similar, got %v", Similarity(a.SimHash, edited.SimHash))
+		check(t, info("/logo.png").ContentHash == "", "want leaves not fingerprinted")
+
+		report := ReportDuplicates(g, 0.9)
+		check(t, len(report.Exact) == 1 && len(report.Exact[0]) == 2, "want a pair of exact duplicates, got %q", report.Exact)
+		check(t, len(report.Near) == 1 && len(report.Near[0].URLs) == 2, "want a pair of near duplicates, got %+v", report.Near)
+	})
+}
+
+func TestCrawlPrunesTraps(t *testing.T) {
+	// a calendar that never ends, and relative links that never stop
+	// growing
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch {
+		case r.URL.Path == "/":
+			fmt.Fprint(w, `<a href="/cal?month=1"></a><a href="a/b/"></a>`)
+		case r.URL.Path == "/cal":
+			var month int
+			fmt.Sscan(r.URL.Query().Get("month"), &month)
+			fmt.Fprintf(w, `<a href="/cal?month=%d"></a>`, month+1)
+		default:
+			fmt.Fprint(w, `<a href="a/b/"></a>`)
+		}
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		opts := DefaultOptions()
+		opts.Traps.MaxQueryVariants = 10
+
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		check(t, g.Contains(must(domain.Parse("/cal?month=10")).String()), "want the calendar crawled up to the limit")
+		check(t, !g.Contains(must(domain.Parse("/cal?month=11")).String()), "want the calendar pruned past the limit")
+		// trailing slashes are removed, so "a/b/" resolves one level
+		// deeper every time
+		check(t, g.Contains(must(domain.Parse("/a/a/b")).String()), "want relative links crawled up to the limit")
+
+		reasons := map[string]string{}
+		g.WalkRejected(func(link, reason string, _ []string) bool {
+			reasons[strings.TrimPrefix(link, domain.String())] = reason
+			return true
+		})
+		want := map[string]string{
+			"/cal?month=11": `trap: more than 10 variants of "` + domain.Host + `/cal"`,
+			"/a/a/a/b":      `trap: segment "a" repeated 3 times`,
+		}
+		check(t, reflect.DeepEqual(reasons, want), "want pruned links %q, got %q", want, reasons)
+	})
+}
+
+func TestCrawlSkipsBadSitemaps(t *testing.T) {
+	pages := map[string]string{
+		"/":             `<p>home</p>`,
+		"/sitemap.html": `<a href="/from-sitemap"></a>`,
+		"/from-sitemap": `<p>listed</p>`,
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nSitemap: http://%%zz/bad.xml\nSitemap: http://other.com/s.xml\nSitemap: http://%s/sitemap.html\n", r.Host)
+			return
+		}
+		htmlPages(pages)(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		rec := &recorder{}
+		opts := DefaultOptions()
+		opts.Observer = rec
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		check(t, g.Contains(domain.String()+"/from-sitemap"), "want the good sitemap crawled")
+		check(t, !g.Contains("http://other.com/s.xml"), "want the foreign sitemap left out")
+		var errs []string
+		for _, event := range rec.events {
+			if strings.HasPrefix(event, "error ") {
+				errs = append(errs, event)
+			}
+		}
+		ok := len(errs) == 2 &&
+			strings.HasPrefix(errs[0], `error bad sitemap URL: "http://%zz/bad.xml", `) &&
+			errs[1] == `error wrong sitemap domain: "http://other.com/s.xml"`
+		check(t, ok, "want the bad and the foreign sitemaps reported, got %q", errs)
+	})
+}
+
+func TestCrawlMirrors(t *testing.T) {
+	big := strings.Repeat("0123456789", 100)
+	files := map[string]struct{ mediatype, body string }{
+		"/":             {"text/html", `<link rel=stylesheet href="/css/s.css"><a href="/posts/a?p=2">A</a><a href="/old">Old</a><a href="/missing">M</a><a href="/api">API</a><a href="/api/v1">v1</a><a href="/big.txt">Big</a>`},
+		"/api":          {"application/json", `{"versions": 1}`},
+		"/api/v1":       {"application/json", `{"version": 1}`},
+		"/big.txt":      {"text/plain", big},
+		"/posts/a":      {"text/html", `<a href="/">Home</a><img src="/img/logo.png">`},
+		"/new":          {"text/html", `<p>New</p>`},
+		"/css/s.css":    {"text/css", `body { background: url(../img/logo.png) }`},
+		"/img/logo.png": {"image/png", "PNG"},
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", f.mediatype)
+		if r.Method != "HEAD" {
+			_, _ = w.Write([]byte(f.body))
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "mirror")
+	check(t, err == nil, "couldn't create the mirror directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		opts := DefaultOptions()
+		opts.Mirror = dir
+		opts.MirrorRewrite = true
+		// less than the big file, saved whole all the same
+		opts.MaxBodySize = 512
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		host := strings.Replace(domain.Host, ":", "_", -1)
+		want := map[string]string{
+			"index.html":       `<link rel="stylesheet" href="css/s.css"><a href="posts/a@p=2.html">A</a><a href="new.html">Old</a><a href="/missing">M</a><a href="api/index">API</a><a href="api/v1/index">v1</a><a href="big.txt">Big</a>`,
+			"posts/a@p=2.html": `<a href="../index.html">Home</a><img src="../img/logo.png">`,
+			"new.html":         `<p>New</p>`,
+			"css/s.css":        `body { background: url(../img/logo.png) }`,
+			"img/logo.png":     "PNG",
+			"api/index":        `{"versions": 1}`,
+			"api/v1/index":     `{"version": 1}`,
+			"big.txt":          big,
+		}
+		for name, body := range want {
+			data, err := ioutil.ReadFile(filepath.Join(dir, host, filepath.FromSlash(name)))
+			check(t, err == nil, "couldn't read %q, %v", name, err)
+			check(t, string(data) == body, "%s: want\n%s\ngot\n%s", name, body, data)
+		}
+		_, err = os.Stat(filepath.Join(dir, host, "missing.html"))
+		check(t, os.IsNotExist(err), "want no copy of a 404, got %v", err)
+	})
+}
+
 // context providers
 
+// starts a fake server with the given handler, provides f with the
+// domain URL to that fake server
+func withHandler(t *testing.T, h http.Handler, f func(*url.URL)) {
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	domain, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("bad server URL, %v", err)
+	}
+	f(domain)
+}
+
+// starts a fake server for many hosts, provides f with a client that
+// sends every request to that fake server. Hosts serve their robots.txt
+// if they have one, 404 otherwise.
+func withVirtualHosts(t *testing.T, hosts map[string]http.Handler, robots map[string]string, f func(*http.Client)) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if r.URL.Path == "/robots.txt" {
+			body, ok := robots[host]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		h, ok := hosts[host]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(server *url.URL) {
+		client := &http.Client{Transport: &http.Transport{
+			Dial: func(network, _ string) (net.Conn, error) {
+				return net.Dial(network, server.Host)
+			},
+		}}
+		f(client)
+	})
+}
+
+// serves HTML pages by path, 404 for everything else
+func htmlPages(pages map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}
+}
+
 // basic test harness starts a fake server to crawl, provides
 // f with the domain URL to that fake server
 func withDomain(t *testing.T, f func(*url.URL)) {
@@ -137,7 +710,7 @@ func withResourceGraph(t *testing.T, f func(ResourceGraph, map[string]struct{}))
 
 			path = path[len(testPath):]
 
-			u, err := cleanFromURLString(domain, path)
+			u, err := cleanFromURLString(domain, path, nil)
 			groundTruth[u.String()] = struct{}{}
 			return err
 		})
@@ -146,7 +719,7 @@ func withResourceGraph(t *testing.T, f func(ResourceGraph, map[string]struct{}))
 		}
 
 		for toIgnore := range filesNotToFind {
-			u, err := cleanFromURLString(domain, toIgnore)
+			u, err := cleanFromURLString(domain, toIgnore, nil)
 			if err != nil {
 				t.Fatalf("coudn't parse URLs not to fine, %v", err)
 			}
@@ -156,7 +729,7 @@ func withResourceGraph(t *testing.T, f func(ResourceGraph, map[string]struct{}))
 			delete(groundTruth, u.String())
 		}
 
-		u, err := cleanFromURLString(domain, "/")
+		u, err := cleanFromURLString(domain, "/", nil)
 		if err != nil {
 			t.Fatalf("coudn't parse root URL, %v", err)
 		}
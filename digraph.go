@@ -2,6 +2,8 @@ package crawler
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"sync"
 )
 
@@ -16,10 +18,67 @@ type ResourceGraph interface {
 	LinkCount() int
 	// walks over the graph as long as the func returns true.
 	Walk(func(link string, status int, refersTo, referedBy []string) bool)
+	// describes a resource, if it's in the graph.
+	Info(link string) (ResourceInfo, bool)
+	// walks over the links that were not crawled, with the reason they
+	// were rejected, as long as the func returns true.
+	WalkRejected(func(link, reason string, referedBy []string) bool)
 	// can be marshalled to JSON.
 	json.Marshaler
 }
 
+// ResourceInfo describes what the crawler learned about a resource.
+type ResourceInfo struct {
+	URL       string
+	Status    int
+	RefersTo  []string
+	ReferedBy []string
+	// Guessed are the links of RefersTo that were guessed from what
+	// looks like a link in text, JSON or scripts, rather than found in
+	// markup.
+	Guessed []string
+	// Leaves are the links of RefersTo that were found as resources that
+	// don't link further, like images, to only ask for their headers.
+	Leaves []string
+	// NoIndex is set when the resource asked not to be indexed, with
+	// a robots meta tag or X-Robots-Tag header.
+	NoIndex bool
+	// External is set for links to other web sites, which are checked
+	// but not crawled.
+	External bool
+	// Error tells why the resource couldn't be retrieved.
+	Error string
+	// Hrefs are the links to the resource as written in the documents
+	// referring to it, before they were resolved and normalized.
+	Hrefs []string
+	// Canonical is the preferred URL the resource declared, with a
+	// rel="canonical" link or header.
+	Canonical string
+	// Aliases are the resources merged into this one because it's
+	// their canonical.
+	Aliases []string
+	// ContentHash is the SHA-256 of the body, in hex, and SimHash the
+	// fingerprint of its visible text. They're only known for the
+	// documents that were parsed, and SimHash is zero for those with
+	// too little text to fingerprint.
+	ContentHash string
+	SimHash     uint64
+	// Encoding is the character encoding the document was decoded from,
+	// like "shift_jis". It's only known for the documents that were
+	// parsed.
+	Encoding string
+	// Truncated is set when the resource was too large to be read
+	// entirely, so some of its links may be missing.
+	Truncated bool
+	// ETag and LastModified are the validators the resource was served
+	// with, to ask for it again only if it changed.
+	ETag         string
+	LastModified string
+	// Revalidated is set when the resource didn't change since the
+	// previous crawl, and what was known of it then was kept.
+	Revalidated bool
+}
+
 // digraph implements ResourceGraph + extra methods needed by the crawler.
 // It is immutable by external users who only see the interface.
 type digraph struct {
@@ -29,13 +88,16 @@ type digraph struct {
 	lock  sync.RWMutex
 	e     int
 	nodes map[string]*resource
+	// rejected links are not part of the graph
+	rejected map[string]*rejection
 }
 
 func newDigraph() *digraph {
 	return &digraph{
-		e:     0,
-		lock:  sync.RWMutex{},
-		nodes: make(map[string]*resource),
+		e:        0,
+		lock:     sync.RWMutex{},
+		nodes:    make(map[string]*resource),
+		rejected: make(map[string]*rejection),
 	}
 }
 
@@ -51,6 +113,26 @@ func (d *digraph) AddEdge(v, w string) bool {
 	return d.addEdge(v, w)
 }
 
+// AddRejected remembers that from refers to a link that was rejected.
+// The first reason given for a link is kept.
+func (d *digraph) AddRejected(from, link, reason string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.addRejected(from, link, reason)
+}
+
+// AddHref remembers a link to v as it was written, before it was
+// normalized.
+func (d *digraph) AddHref(v, href string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.hrefs.Add(href)
+	}
+	return ok
+}
+
 func (d *digraph) MarkStatus(v string, code int) bool {
 	d.lock.Lock()
 	defer d.lock.Unlock()
@@ -61,6 +143,118 @@ func (d *digraph) MarkStatus(v string, code int) bool {
 	return ok
 }
 
+func (d *digraph) MarkNoIndex(v string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.noIndex = true
+	}
+	return ok
+}
+
+func (d *digraph) MarkExternal(v string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.external = true
+	}
+	return ok
+}
+
+func (d *digraph) MarkTruncated(v string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.truncated = true
+	}
+	return ok
+}
+
+func (d *digraph) MarkCanonical(v, canonical string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.canonical = canonical
+	}
+	return ok
+}
+
+func (d *digraph) MarkFingerprint(v, contentHash string, simhash uint64) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.contentHash = contentHash
+		node.simhash = simhash
+	}
+	return ok
+}
+
+func (d *digraph) MarkGuessed(v, w string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.guessed.Add(w)
+	}
+	return ok
+}
+
+func (d *digraph) MarkLeaf(v, w string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.leaves.Add(w)
+	}
+	return ok
+}
+
+func (d *digraph) MarkEncoding(v, encoding string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.encoding = encoding
+	}
+	return ok
+}
+
+func (d *digraph) MarkValidators(v, etag, lastModified string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.etag = etag
+		node.lastModified = lastModified
+	}
+	return ok
+}
+
+func (d *digraph) MarkRevalidated(v string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.revalidated = true
+	}
+	return ok
+}
+
+func (d *digraph) MarkError(v string, err string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node, ok := d.nodes[v]
+	if ok {
+		node.err = err
+	}
+	return ok
+}
+
 func (d *digraph) ResourceCount() int {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
@@ -89,16 +283,41 @@ func (d *digraph) Walk(walker func(string, int, []string, []string) bool) {
 	}
 }
 
+func (d *digraph) Info(v string) (ResourceInfo, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	node, ok := d.nodes[v]
+	if !ok {
+		return ResourceInfo{}, false
+	}
+	return node.info(), true
+}
+
+func (d *digraph) WalkRejected(walker func(string, string, []string) bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for _, rej := range d.rejected {
+		if !walker(rej.link, rej.reason, rej.referedBy.Slice()) {
+			return
+		}
+	}
+}
+
 func (d *digraph) MarshalJSON() ([]byte, error) {
 	var nodes []*resource
 	for _, node := range d.nodes {
 		nodes = append(nodes, node)
 	}
+	var rejected []*rejection
+	for _, rej := range d.rejected {
+		rejected = append(rejected, rej)
+	}
 	return json.Marshal(struct {
-		ResourceCount int         `json:"resource_count"`
-		LinkCount     int         `json:"link_count"`
-		Resources     []*resource `json:"resources"`
-	}{d.ResourceCount(), d.LinkCount(), nodes})
+		ResourceCount int          `json:"resource_count"`
+		LinkCount     int          `json:"link_count"`
+		Resources     []*resource  `json:"resources"`
+		Rejected      []*rejection `json:"rejected"`
+	}{d.ResourceCount(), d.LinkCount(), nodes, rejected})
 }
 
 func (d *digraph) contains(v string) bool {
@@ -126,32 +345,227 @@ func (d *digraph) addEdge(from, to string) bool {
 	return true
 }
 
+func (d *digraph) addRejected(from, link, reason string) {
+	rej, ok := d.rejected[link]
+	if !ok {
+		rej = &rejection{link: link, reason: reason, referedBy: newStringSet()}
+		d.rejected[link] = rej
+	}
+	rej.referedBy.Add(from)
+}
+
 type resource struct {
 	referedBy *stringSet
 	refersTo  *stringSet
+	// guessed are the links of refersTo that are guesses
+	guessed *stringSet
+	// leaves are the links of refersTo found as leaves
+	leaves    *stringSet
 	link      string
 	status    int
+	noIndex   bool
+	external  bool
+	err       string
+	truncated bool
+	hrefs     *stringSet
+	canonical string
+	aliases   *stringSet
+	// contentHash is empty when the body wasn't parsed
+	contentHash string
+	simhash     uint64
+	encoding    string
+	// validators, empty when the resource wasn't served with any
+	etag, lastModified string
+	revalidated        bool
 }
 
 func newResource(link string) *resource {
 	return &resource{
 		referedBy: newStringSet(),
 		refersTo:  newStringSet(),
+		guessed:   newStringSet(),
+		leaves:    newStringSet(),
+		hrefs:     newStringSet(),
+		aliases:   newStringSet(),
 		link:      link,
 		status:    -1,
 	}
 }
 
+func (r *resource) info() ResourceInfo {
+	return ResourceInfo{
+		URL:         r.link,
+		Status:      r.status,
+		RefersTo:    r.refersTo.Slice(),
+		ReferedBy:   r.referedBy.Slice(),
+		Guessed:     r.guessed.Slice(),
+		Leaves:      r.leaves.Slice(),
+		NoIndex:     r.noIndex,
+		External:    r.external,
+		Error:       r.err,
+		Hrefs:       r.hrefs.Slice(),
+		Canonical:   r.canonical,
+		Aliases:     r.aliases.Slice(),
+		ContentHash: r.contentHash,
+		SimHash:     r.simhash,
+		Encoding:    r.encoding,
+		Truncated:   r.truncated,
+
+		ETag:         r.etag,
+		LastModified: r.lastModified,
+		Revalidated:  r.revalidated,
+	}
+}
+
+// setInfo copies what's known about a resource, but not its links.
+func (r *resource) setInfo(info ResourceInfo) {
+	r.status = info.Status
+	r.noIndex = info.NoIndex
+	r.external = info.External
+	r.err = info.Error
+	r.canonical = info.Canonical
+	r.contentHash = info.ContentHash
+	r.simhash = info.SimHash
+	r.encoding = info.Encoding
+	r.truncated = info.Truncated
+	r.etag = info.ETag
+	r.lastModified = info.LastModified
+	r.revalidated = info.Revalidated
+}
+
+// resourceJSON is how a resource is marshalled.
+type resourceJSON struct {
+	URL          string   `json:"url"`
+	ReferedBy    []string `json:"refered_by"`
+	RefersTo     []string `json:"refers_to"`
+	Guessed      []string `json:"guessed,omitempty"`
+	Leaves       []string `json:"leaves,omitempty"`
+	Status       int      `json:"status_code"`
+	NoIndex      bool     `json:"noindex"`
+	External     bool     `json:"external,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Hrefs        []string `json:"hrefs,omitempty"`
+	Canonical    string   `json:"canonical,omitempty"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Hash         string   `json:"content_hash,omitempty"`
+	SimHash      string   `json:"simhash,omitempty"`
+	Encoding     string   `json:"encoding,omitempty"`
+	Truncated    bool     `json:"truncated,omitempty"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Revalidated  bool     `json:"revalidated,omitempty"`
+}
+
 func (r *resource) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		URL       string   `json:"url"`
-		ReferedBy []string `json:"refered_by"`
-		RefersTo  []string `json:"refers_to"`
-		Status    int      `json:"status_code"`
-	}{
-		r.link,
-		r.referedBy.Slice(),
-		r.refersTo.Slice(),
-		r.status,
+	// as hex, 64 bits integers don't survive JavaScript
+	var simhash string
+	if r.simhash != 0 {
+		simhash = fmt.Sprintf("%016x", r.simhash)
+	}
+	return json.Marshal(resourceJSON{
+		URL:          r.link,
+		ReferedBy:    r.referedBy.Slice(),
+		RefersTo:     r.refersTo.Slice(),
+		Guessed:      r.guessed.Slice(),
+		Leaves:       r.leaves.Slice(),
+		Status:       r.status,
+		NoIndex:      r.noIndex,
+		External:     r.external,
+		Error:        r.err,
+		Hrefs:        r.hrefs.Slice(),
+		Canonical:    r.canonical,
+		Aliases:      r.aliases.Slice(),
+		Hash:         r.contentHash,
+		SimHash:      simhash,
+		Encoding:     r.encoding,
+		Truncated:    r.truncated,
+		ETag:         r.etag,
+		LastModified: r.lastModified,
+		Revalidated:  r.revalidated,
 	})
 }
+
+// rejection is a link the crawler refused to follow.
+type rejection struct {
+	link      string
+	reason    string
+	referedBy *stringSet
+}
+
+// rejectionJSON is how a rejection is marshalled.
+type rejectionJSON struct {
+	URL       string   `json:"url"`
+	Reason    string   `json:"reason"`
+	ReferedBy []string `json:"refered_by"`
+}
+
+func (r *rejection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rejectionJSON{
+		URL:       r.link,
+		Reason:    r.reason,
+		ReferedBy: r.referedBy.Slice(),
+	})
+}
+
+// ReadGraph reads a graph back from the JSON it was marshalled to, like
+// the site map of a previous crawl.
+func ReadGraph(r io.Reader) (ResourceGraph, error) {
+	var data struct {
+		Resources []resourceJSON  `json:"resources"`
+		Rejected  []rejectionJSON `json:"rejected"`
+	}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	d := newDigraph()
+	for _, res := range data.Resources {
+		if !d.contains(res.URL) {
+			d.nodes[res.URL] = newResource(res.URL)
+		}
+		for _, to := range res.RefersTo {
+			d.addEdge(res.URL, to)
+		}
+		for _, to := range res.Guessed {
+			d.nodes[res.URL].guessed.Add(to)
+		}
+		for _, to := range res.Leaves {
+			d.nodes[res.URL].leaves.Add(to)
+		}
+	}
+	for _, res := range data.Resources {
+		var simhash uint64
+		if res.SimHash != "" {
+			if _, err := fmt.Sscanf(res.SimHash, "%x", &simhash); err != nil {
+				return nil, fmt.Errorf("simhash of %q, %v", res.URL, err)
+			}
+		}
+		node := d.nodes[res.URL]
+		node.setInfo(ResourceInfo{
+			Status:       res.Status,
+			NoIndex:      res.NoIndex,
+			External:     res.External,
+			Error:        res.Error,
+			Canonical:    res.Canonical,
+			ContentHash:  res.Hash,
+			SimHash:      simhash,
+			Encoding:     res.Encoding,
+			Truncated:    res.Truncated,
+			ETag:         res.ETag,
+			LastModified: res.LastModified,
+			Revalidated:  res.Revalidated,
+		})
+		for _, href := range res.Hrefs {
+			node.hrefs.Add(href)
+		}
+		for _, alias := range res.Aliases {
+			node.aliases.Add(alias)
+		}
+	}
+	for _, rej := range data.Rejected {
+		for _, from := range rej.ReferedBy {
+			d.addRejected(from, rej.URL, rej.Reason)
+		}
+	}
+	return d, nil
+}
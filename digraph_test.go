@@ -342,6 +342,72 @@ func TestDigraphCanMarshalToJSON(t *testing.T) {
 	}
 }
 
+func TestDigraphInfoDescribesResources(t *testing.T) {
+	for _, tt := range digraphTT {
+		t.Logf("==== Digraph: %s ====", tt.name)
+
+		dig := newDigraph()
+		for _, edge := range tt.input {
+			dig.AddEdge(edge.from, edge.to)
+			dig.MarkStatus(edge.from, 200)
+		}
+
+		for invalid, code := range tt.invalids {
+			dig.MarkStatus(invalid, code)
+			check(t, dig.MarkNoIndex(invalid), "should be able to mark %q as noindex", invalid)
+		}
+
+		_, ok := dig.Info("not in the graph")
+		check(t, !ok, "should not describe unknown resources")
+
+		dig.Walk(func(link string, code int, refersTo, referedBy []string) bool {
+			info, ok := dig.Info(link)
+			check(t, ok, "should describe %q", link)
+			check(t, info.URL == link, "want URL %q, got %q", link, info.URL)
+			check(t, info.Status == code, "want status %d, got %d", code, info.Status)
+
+			_, wantNoIndex := tt.invalids[link]
+			check(t, info.NoIndex == wantNoIndex, "want %q noindex=%v, got %v", link, wantNoIndex, info.NoIndex)
+
+			verifyOutRef(t, tt.input, link, info.RefersTo)
+			verifyInRef(t, tt.input, link, info.ReferedBy)
+			return true
+		})
+
+		t.Log("ok!")
+	}
+}
+
+func TestDigraphRemembersRejectedLinks(t *testing.T) {
+	dig := newDigraph()
+	dig.AddEdge("a", "b")
+	dig.AddRejected("a", "x", "first reason")
+	dig.AddRejected("b", "x", "second reason")
+	dig.AddRejected("a", "y", "other reason")
+
+	check(t, !dig.Contains("x"), "rejected links shouldn't be in the graph")
+	check(t, dig.ResourceCount() == 2, "want 2 resources, got %d", dig.ResourceCount())
+
+	got := map[string]string{}
+	dig.WalkRejected(func(link, reason string, referedBy []string) bool {
+		got[link] = reason
+		if link == "x" {
+			check(t, len(referedBy) == 2, "want x refered by a and b, got %q", referedBy)
+		}
+		return true
+	})
+	check(t, len(got) == 2, "want 2 rejected links, got %d", len(got))
+	check(t, got["x"] == "first reason", "want first reason to be kept, got %q", got["x"])
+	check(t, got["y"] == "other reason", "want y's reason, got %q", got["y"])
+
+	data, err := json.Marshal(dig)
+	check(t, err == nil, "should be able to marshal to JSON, but got error: %v", err)
+	var unmarsh map[string]interface{}
+	check(t, json.Unmarshal(data, &unmarsh) == nil, "encoding/json error")
+	gotRaw := len(unmarsh["rejected"].([]interface{}))
+	check(t, gotRaw == 2, "want 2 rejected links in JSON, got %d", gotRaw)
+}
+
 // verifies that all claimed references reachable by `link` are expected, and that
 // all those expected are reported
 func verifyOutRef(t *testing.T, knownEdges []edge, link string, outRef []string) {
@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"strings"
+)
+
+// robotsDirectives are the indexing rules a resource gives about itself,
+// through <meta name="robots"> tags or X-Robots-Tag headers.
+//
+// see https://developers.google.com/search/docs/crawling-indexing/robots-meta-tag
+type robotsDirectives struct {
+	noIndex  bool
+	noFollow bool
+}
+
+// merge keeps the most restrictive of both directives.
+func (r robotsDirectives) merge(other robotsDirectives) robotsDirectives {
+	return robotsDirectives{
+		noIndex:  r.noIndex || other.noIndex,
+		noFollow: r.noFollow || other.noFollow,
+	}
+}
+
+// parseRobotsDirectives reads a comma separated list of directives, as
+// found in the content of a robots meta tag. Unknown directives are
+// ignored.
+//
+//	"noindex, nofollow" => {noIndex: true, noFollow: true}
+func parseRobotsDirectives(content string) (r robotsDirectives) {
+	for _, d := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "noindex":
+			r.noIndex = true
+		case "nofollow":
+			r.noFollow = true
+		case "none":
+			r.noIndex = true
+			r.noFollow = true
+		}
+	}
+	return
+}
+
+// parseRobotsHeader reads the values of X-Robots-Tag headers. Values can
+// be prefixed by the agent they apply to, those meant for other agents
+// are ignored.
+//
+//	"otherbot: noindex", "nofollow" => {noFollow: true}
+func parseRobotsHeader(values []string, agent string) (r robotsDirectives) {
+	for _, v := range values {
+		if i := strings.Index(v, ":"); i >= 0 {
+			name := strings.ToLower(strings.TrimSpace(v[:i]))
+			// some directives have a value, like unavailable_after: <date>
+			if !strings.ContainsAny(name, ", ") && !isRobotsDirective(name) {
+				if name != agent {
+					continue
+				}
+				v = v[i+1:]
+			}
+		}
+		r = r.merge(parseRobotsDirectives(v))
+	}
+	return
+}
+
+func isRobotsDirective(name string) bool {
+	switch name {
+	case "all", "noindex", "nofollow", "none", "noarchive", "nosnippet",
+		"notranslate", "noimageindex", "unavailable_after",
+		"max-snippet", "max-image-preview", "max-video-preview",
+		"indexifembedded":
+		return true
+	}
+	return false
+}
+
+// agentToken is the product token of a user agent, which is how robots
+// rules refer to a crawler.
+//
+//	"Crawler/abuse:github.com/aybabtme/crawler" => "crawler"
+func agentToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+	return strings.ToLower(agent)
+}
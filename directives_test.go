@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"testing"
+)
+
+var robotsDirectivesTT = []struct {
+	name    string
+	content string
+	want    robotsDirectives
+}{
+	{name: "empty", content: "", want: robotsDirectives{}},
+	{name: "all", content: "all", want: robotsDirectives{}},
+	{name: "noindex", content: "noindex", want: robotsDirectives{noIndex: true}},
+	{name: "nofollow", content: "NoFollow", want: robotsDirectives{noFollow: true}},
+	{name: "both", content: " noindex , nofollow ", want: robotsDirectives{noIndex: true, noFollow: true}},
+	{name: "none", content: "none", want: robotsDirectives{noIndex: true, noFollow: true}},
+	{name: "unknown directives", content: "noarchive, max-snippet:20", want: robotsDirectives{}},
+}
+
+func TestParseRobotsDirectives(t *testing.T) {
+	for _, tt := range robotsDirectivesTT {
+		t.Logf("==== robots directives: %s ====", tt.name)
+		got := parseRobotsDirectives(tt.content)
+		check(t, got == tt.want, "want %+v, got %+v", tt.want, got)
+		t.Log("ok!")
+	}
+}
+
+var robotsHeaderTT = []struct {
+	name   string
+	values []string
+	want   robotsDirectives
+}{
+	{
+		name:   "no header",
+		values: nil,
+		want:   robotsDirectives{},
+	},
+	{
+		name:   "single value",
+		values: []string{"noindex, nofollow"},
+		want:   robotsDirectives{noIndex: true, noFollow: true},
+	},
+	{
+		name:   "many headers are merged",
+		values: []string{"noindex", "nofollow"},
+		want:   robotsDirectives{noIndex: true, noFollow: true},
+	},
+	{
+		name:   "value for another agent",
+		values: []string{"googlebot: noindex", "nofollow"},
+		want:   robotsDirectives{noFollow: true},
+	},
+	{
+		name:   "value for our agent",
+		values: []string{"crawlerundertest: noindex"},
+		want:   robotsDirectives{noIndex: true},
+	},
+	{
+		name:   "directive with a value",
+		values: []string{"unavailable_after: 25 Jun 2010 15:00:00 PST, noindex"},
+		want:   robotsDirectives{noIndex: true},
+	},
+}
+
+func TestParseRobotsHeader(t *testing.T) {
+	agent := agentToken(testAgent)
+	for _, tt := range robotsHeaderTT {
+		t.Logf("==== robots header: %s ====", tt.name)
+		got := parseRobotsHeader(tt.values, agent)
+		check(t, got == tt.want, "want %+v, got %+v", tt.want, got)
+		t.Log("ok!")
+	}
+}
+
+func TestAgentToken(t *testing.T) {
+	check(t, agentToken(testAgent) == "crawlerundertest", "want product token, got %q", agentToken(testAgent))
+	check(t, agentToken("Bot") == "bot", "want whole agent, got %q", agentToken("Bot"))
+	check(t, agentToken("Bot 1.0") == "bot", "want first word, got %q", agentToken("Bot 1.0"))
+}
@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// externalChecker checks that links leaving the scope of a crawl work,
+// without crawling them. Each host is checked politely: it gets its own
+// delay between requests, and its robots.txt is obeyed.
+type externalChecker struct {
+	client *http.Client
+	agent  string
+	// delay is the minimum time between two requests to a host, unless
+	// the host's robots.txt asks for a longer crawl-delay
+	delay  time.Duration
+	robots func(*url.URL) *robots
+
+	// started is called when a link is taken to be checked, before its
+	// robots.txt is obeyed, if not nil
+	started func(*url.URL)
+
+	queue urlQueue
+	last  map[string]time.Time
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newExternalChecker(client *http.Client, agent string, delay time.Duration, robots func(*url.URL) *robots) *externalChecker {
+	return &externalChecker{
+		client: client,
+		agent:  agent,
+		delay:  delay,
+		robots: robots,
+		last:   make(map[string]time.Time),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// externalResult is the outcome of checking an external link.
+type externalResult struct {
+	link *url.URL
+	// status is -1 when the link couldn't be checked
+	status int
+	err    error
+	// verdict is set when robots.txt blocked the check
+	verdict *RobotsVerdict
+	elapsed time.Duration
+}
+
+// notCheckedError tells that robots.txt blocked the check of a link.
+type notCheckedError struct {
+	verdict *RobotsVerdict
+}
+
+func (e *notCheckedError) Error() string {
+	return fmt.Sprintf("not checked, robots.txt: %v", e.verdict)
+}
+
+// Add queues a link to be checked. Links must be unique.
+func (x *externalChecker) Add(u *url.URL) { x.queue.Add(u) }
+
+// Len is the number of links left to check.
+func (x *externalChecker) Len() int { return x.queue.Len() }
+
+// Next checks the next link whose host can be requested, waiting for
+// one if all hosts are resting.
+func (x *externalChecker) Next() externalResult {
+	u := x.nextReady()
+	if x.started != nil {
+		x.started(u)
+	}
+
+	robot := x.robots(u)
+	if verdict := robot.Explain(u); !verdict.Allowed {
+		return externalResult{link: u, status: -1, verdict: &verdict}
+	}
+
+	start := x.now()
+	x.last[u.Host] = start
+	status, err := x.check(u)
+	return externalResult{link: u, status: status, err: err, elapsed: x.now().Sub(start)}
+}
+
+// nextReady removes from the queue the first link whose host has rested
+// long enough, sleeping until one has if needed.
+func (x *externalChecker) nextReady() *url.URL {
+	var (
+		earliest  time.Time
+		earliestI int
+	)
+	for i := 0; i < x.queue.Len(); i++ {
+		u := x.queue.Remove()
+		readyAt := x.last[u.Host].Add(x.hostDelay(u))
+		if !readyAt.After(x.now()) {
+			return u
+		}
+		if i == 0 || readyAt.Before(earliest) {
+			earliest, earliestI = readyAt, i
+		}
+		x.queue.Add(u)
+	}
+
+	// every host is resting, wait for the first one to be ready
+	x.sleep(earliest.Sub(x.now()))
+	for i := 0; i < earliestI; i++ {
+		x.queue.Add(x.queue.Remove())
+	}
+	return x.queue.Remove()
+}
+
+func (x *externalChecker) hostDelay(u *url.URL) time.Duration {
+	if crawlDelay := x.robots(u).CrawlDelay(); crawlDelay > x.delay {
+		return crawlDelay
+	}
+	return x.delay
+}
+
+func (x *externalChecker) check(u *url.URL) (int, error) {
+	resp, err := probe(x.client, x.agent, u)
+	if err != nil {
+		return -1, err
+	}
+	return resp.StatusCode, nil
+}
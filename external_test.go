@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExternalCheckerFallsBackOnGet(t *testing.T) {
+	var methods []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch {
+		case r.URL.Path == "/robots.txt":
+			http.NotFound(w, r)
+		case r.URL.Path == "/nohead" && r.Method == "HEAD":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		}
+	}
+
+	tt := []struct {
+		path        string
+		wantStatus  int
+		wantMethods []string
+	}{
+		{path: "/ok", wantStatus: 200, wantMethods: []string{"HEAD"}},
+		{path: "/nohead", wantStatus: 200, wantMethods: []string{"HEAD", "GET"}},
+		{path: "/missing", wantStatus: 404, wantMethods: []string{"HEAD", "GET"}},
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		robot, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+		check(t, err == nil, "couldn't get robots.txt, %v", err)
+		robotsFor := func(*url.URL) *robots { return robot }
+
+		for _, tt := range tt {
+			methods = nil
+			x := newExternalChecker(http.DefaultClient, testAgent, 0, robotsFor)
+			x.Add(must(domain.Parse(tt.path)))
+
+			got := x.Next()
+			check(t, got.err == nil, "%q shouldn't fail, %v", tt.path, got.err)
+			check(t, got.status == tt.wantStatus, "want %q status %d, got %d", tt.path, tt.wantStatus, got.status)
+			check(t, len(methods) == len(tt.wantMethods), "want %q checked with %q, got %q", tt.path, tt.wantMethods, methods)
+			for i := range methods {
+				check(t, methods[i] == tt.wantMethods[i], "want %q checked with %q, got %q", tt.path, tt.wantMethods, methods)
+			}
+		}
+	})
+}
+
+func TestExternalCheckerRateLimitsHosts(t *testing.T) {
+	var checked []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		checked = append(checked, r.URL.String())
+		return &http.Response{StatusCode: 200, Body: http.NoBody, Request: r}, nil
+	})}
+
+	slowHost := &robots{data: parseRobots([]byte("User-agent: *\nCrawl-delay: 10\n")), agent: testAgent}
+	fastHost := &robots{data: parseRobots(nil), agent: testAgent}
+	robotsFor := func(u *url.URL) *robots {
+		if u.Host == "slow.test" {
+			return slowHost
+		}
+		return fastHost
+	}
+
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	x := newExternalChecker(client, testAgent, time.Second, robotsFor)
+	x.now = func() time.Time { return now }
+	x.sleep = func(d time.Duration) { slept += d; now = now.Add(d) }
+
+	for _, link := range []string{
+		"http://a.test/1", "http://a.test/2", "http://slow.test/1",
+		"http://slow.test/2", "http://b.test/1",
+	} {
+		x.Add(must(url.Parse(link)))
+	}
+
+	for x.Len() != 0 {
+		x.Next()
+	}
+
+	want := []string{
+		"http://a.test/1",
+		"http://slow.test/1",
+		"http://b.test/1",
+		"http://a.test/2",    // after a.test rested 1s
+		"http://slow.test/2", // after the crawl-delay of 10s
+	}
+	check(t, len(checked) == len(want), "want %d links checked, got %q", len(want), checked)
+	for i := range want {
+		check(t, checked[i] == want[i], "want check #%d to be %q, got %q", i, want[i], checked[i])
+	}
+	check(t, slept == 10*time.Second, "want to have waited 10s, got %v", slept)
+}
+
+func TestExternalCheckerObeysRobots(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Fatalf("blocked link shouldn't be requested, got %q", r.URL)
+		return nil, nil
+	})}
+	blocked := &robots{data: parseRobots([]byte("User-agent: *\nDisallow: /\n")), agent: testAgent}
+
+	x := newExternalChecker(client, testAgent, 0, func(*url.URL) *robots { return blocked })
+	x.Add(must(url.Parse("http://blocked.test/a")))
+
+	got := x.Next()
+	check(t, got.verdict != nil && !got.verdict.Allowed, "want a blocking verdict, got %v", got.verdict)
+	check(t, got.status == -1, "want no status, got %d", got.status)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,241 @@
+package crawler
+
+import (
+	"code.google.com/p/go.net/html"
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"strings"
+)
+
+// htmlExtractor finds what the crawler needs to know about HTML
+// documents.
+type htmlExtractor struct {
+	resources []resourceLocator
+	// agent is the product token of the crawler, robots meta tags can
+	// be addressed to it by name
+	agent string
+	// relNoFollow skips the links marked rel="nofollow"
+	relNoFollow bool
+	// normalizer rewrites the links found, DefaultNormalizer if nil
+	normalizer Normalizer
+}
+
+// htmlDocument is what an HTML document tells about itself.
+type htmlDocument struct {
+	links  []linkRef
+	robots robotsDirectives
+	// canonical is the preferred URL of the document, if it declares one
+	canonical *url.URL
+}
+
+// linkRef is a link found in a document.
+type linkRef struct {
+	url *url.URL
+	// raw is the link as written in the document
+	raw string
+	// leaf is set when the link is known to point to a resource that
+	// doesn't link further, like an image
+	leaf bool
+	// guessed is set when the link was found in a document without
+	// markup, from something that looks like a link, so it's less
+	// certain to be one
+	guessed bool
+}
+
+// extract finds all the links that an HTML document refers to, as
+// described by the resource locators, and the robots directives of its
+// meta tags.
+func (x *htmlExtractor) extract(from *url.URL, node *html.Node) (page htmlDocument) {
+
+	add := func(base *url.URL, link string, leaf bool) {
+		link = strings.TrimSpace(link)
+		u, err := cleanFromURLString(base, link, x.normalizer)
+		if err == nil {
+			page.links = append(page.links, linkRef{url: u, raw: link, leaf: leaf})
+		}
+	}
+
+	doc := goquery.NewDocumentFromNode(node)
+	docBase := documentBase(from, doc)
+	page.robots = x.metaRobots(doc)
+	page.canonical = x.canonical(docBase, doc)
+
+	for _, res := range x.resources {
+		doc.Find(res.cssSelector()).Each(func(_ int, s *goquery.Selection) {
+			val, ok := s.Attr(res.attr)
+			if !ok {
+				return
+			}
+
+			if x.relNoFollow && hasRelNoFollow(s) {
+				return
+			}
+
+			base := docBase
+			if res.baseAttr != "" {
+				if dir, ok := s.Attr(res.baseAttr); ok {
+					base = directoryURL(docBase, dir)
+				}
+			}
+			if base == nil {
+				return
+			}
+
+			for _, link := range res.values(val) {
+				add(base, link, res.leaf)
+			}
+		})
+	}
+
+	return
+}
+
+// metaRobots merges the directives of the meta tags named "robots" or
+// after the crawler's agent.
+func (x *htmlExtractor) metaRobots(doc *goquery.Document) (r robotsDirectives) {
+	doc.Find("meta[name][content]").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "robots" && name != x.agent {
+			return
+		}
+		content, _ := s.Attr("content")
+		r = r.merge(parseRobotsDirectives(content))
+	})
+	return
+}
+
+// canonical is the URL of the first <link rel="canonical"> of the
+// document.
+func (x *htmlExtractor) canonical(base *url.URL, doc *goquery.Document) (canonical *url.URL) {
+	doc.Find("link[rel][href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if !hasRel(s, "canonical") {
+			return true
+		}
+		href, _ := s.Attr("href")
+		u, err := cleanFromURLString(base, strings.TrimSpace(href), x.normalizer)
+		if err != nil {
+			return true
+		}
+		canonical = u
+		return false
+	})
+	return
+}
+
+func hasRelNoFollow(s *goquery.Selection) bool {
+	return hasRel(s, "nofollow")
+}
+
+// hasRel tells if the rel attribute of an element has the link type.
+func hasRel(s *goquery.Selection, linkType string) bool {
+	rel, _ := s.Attr("rel")
+	return hasRelValue(rel, linkType)
+}
+
+// hasRelValue tells if a rel attribute value has the link type.
+func hasRelValue(rel, linkType string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, linkType) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentBase is the URL that relative links of a document resolve
+// against: the first <base href> if there's one, the page URL otherwise.
+func documentBase(from *url.URL, doc *goquery.Document) *url.URL {
+	bases := doc.Find("base[href]")
+	if bases.Length() == 0 {
+		return from
+	}
+	href, _ := bases.First().Attr("href")
+
+	// not normalized, that could drop the trailing slash of
+	// directories and change what the links resolve to
+	base, err := from.Parse(strings.TrimSpace(href))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return from
+	}
+	return base
+}
+
+// directoryURL resolves dir against from, making sure the result is
+// a directory that relative links can be resolved against.
+func directoryURL(from *url.URL, dir string) *url.URL {
+	u, err := from.Parse(strings.TrimSpace(dir))
+	if err != nil {
+		return nil
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u
+}
+
+// parseSrcset returns the URLs of the image candidates found in a srcset
+// attribute, dropping their width and density descriptors. It follows
+// the parsing rules of the HTML spec, so URLs containing commas, like
+// data URLs, survive.
+//
+//	"a.png 1x, b.png 2x" => ["a.png", "b.png"]
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for {
+		srcset = strings.TrimLeft(srcset, srcsetSpace+",")
+		if srcset == "" {
+			return urls
+		}
+
+		end := strings.IndexAny(srcset, srcsetSpace)
+		if end < 0 {
+			end = len(srcset)
+		}
+		candidate := srcset[:end]
+		srcset = srcset[end:]
+
+		if strings.HasSuffix(candidate, ",") {
+			// trailing commas end the candidate, there are no descriptors
+			candidate = strings.TrimRight(candidate, ",")
+		} else {
+			srcset = skipDescriptors(srcset)
+		}
+
+		if candidate != "" {
+			urls = append(urls, candidate)
+		}
+	}
+}
+
+const srcsetSpace = " \t\n\r\f"
+
+// skipDescriptors drops everything up to the comma that ends the current
+// srcset candidate. Commas within parens belong to the descriptor.
+func skipDescriptors(s string) string {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				return s[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+func splitComma(s string) (fields []string) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return
+}
@@ -0,0 +1,308 @@
+package crawler
+
+import (
+	"code.google.com/p/go.net/html"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var srcsetTT = []struct {
+	name   string
+	srcset string
+	want   []string
+}{
+	{
+		name:   "single URL without descriptor",
+		srcset: "a.png",
+		want:   []string{"a.png"},
+	},
+	{
+		name:   "density descriptors",
+		srcset: "a.png 1x, b.png 2x",
+		want:   []string{"a.png", "b.png"},
+	},
+	{
+		name:   "width descriptors and odd whitespace",
+		srcset: "\n  /img/small.jpg 480w,\n\t/img/large.jpg   1080w  ",
+		want:   []string{"/img/small.jpg", "/img/large.jpg"},
+	},
+	{
+		name:   "candidate ended by trailing comma",
+		srcset: "a.png,b.png 2x",
+		want:   []string{"a.png,b.png"},
+	},
+	{
+		name:   "candidate without descriptor ended by comma",
+		srcset: "a.png, b.png 2x,",
+		want:   []string{"a.png", "b.png"},
+	},
+	{
+		name:   "data URL with commas",
+		srcset: "data:image/png;base64,iVBORw0KGgo= 1x, b.png 2x",
+		want:   []string{"data:image/png;base64,iVBORw0KGgo=", "b.png"},
+	},
+	{
+		name:   "empty attribute",
+		srcset: "  , ",
+		want:   nil,
+	},
+}
+
+func TestParseSrcset(t *testing.T) {
+	for _, tt := range srcsetTT {
+		t.Logf("==== srcset: %s ====", tt.name)
+		got := parseSrcset(tt.srcset)
+		check(t, len(got) == len(tt.want), "want %d URLs %q, got %d %q", len(tt.want), tt.want, len(got), got)
+		for i := range tt.want {
+			check(t, got[i] == tt.want[i], "want URL #%d to be %q, got %q", i, tt.want[i], got[i])
+		}
+		t.Log("ok!")
+	}
+}
+
+var extractHTMLTT = []struct {
+	name string
+	page string
+	body string
+	want []string
+}{
+	{
+		name: "img srcset",
+		page: "http://example.com/posts/a.html",
+		body: `<img src="/small.png" srcset="/small.png 1x, /large.png 2x">`,
+		want: []string{"http://example.com/small.png", "http://example.com/large.png"},
+	},
+	{
+		name: "picture sources",
+		page: "http://example.com",
+		body: `<picture>
+			<source srcset="/a.webp 1x, /b.webp 2x" type="image/webp">
+			<source src="/c.jpg">
+			<img src="/d.jpg">
+		</picture>`,
+		want: []string{
+			"http://example.com/a.webp",
+			"http://example.com/b.webp",
+			"http://example.com/c.jpg",
+			"http://example.com/d.jpg",
+		},
+	},
+	{
+		name: "svg xlink:href and href",
+		page: "http://example.com",
+		body: `<svg xmlns:xlink="http://www.w3.org/1999/xlink">
+			<use xlink:href="/sprites.svg#icon"></use>
+			<image href="/photo.jpg"></image>
+			<image xlink:href="/other.jpg"></image>
+		</svg>`,
+		want: []string{
+			"http://example.com/photo.jpg",
+			"http://example.com/other.jpg",
+			"http://example.com/sprites.svg#icon",
+		},
+	},
+	{
+		name: "applet code and archive resolve against codebase",
+		page: "http://example.com/posts/a.html",
+		body: `<applet code="Main.class" archive="lib.jar, more.jar" codebase="/classes"></applet>`,
+		want: []string{
+			"http://example.com/classes/Main.class",
+			"http://example.com/classes/lib.jar",
+			"http://example.com/classes/more.jar",
+		},
+	},
+	{
+		name: "object data resolves against codebase",
+		page: "http://example.com",
+		body: `<object data="movie.swf" codebase="http://cdn.example.com/flash/"></object>`,
+		want: []string{"http://cdn.example.com/flash/movie.swf"},
+	},
+	{
+		name: "object without codebase",
+		page: "http://example.com",
+		body: `<object data="/movie.swf"></object>`,
+		want: []string{"http://example.com/movie.swf"},
+	},
+	{
+		name: "relative links resolve against the page",
+		page: "http://example.com/posts/a.html",
+		body: `<a href="b.html"></a><a href="../c.html"></a><a href=" /d.html "></a>`,
+		want: []string{
+			"http://example.com/posts/b.html",
+			"http://example.com/c.html",
+			"http://example.com/d.html",
+		},
+	},
+	{
+		name: "absolute base",
+		page: "http://example.com/index.html",
+		body: `<head><base href="http://example.com/docs/v2/"></head>
+			<a href="intro.html"></a><a href="/about.html"></a>`,
+		want: []string{
+			"http://example.com/docs/v2/intro.html",
+			"http://example.com/about.html",
+		},
+	},
+	{
+		name: "root relative base",
+		page: "http://example.com/index.html",
+		body: `<head><base href="/docs/v2/"></head><a href="intro.html"></a>`,
+		want: []string{"http://example.com/docs/v2/intro.html"},
+	},
+	{
+		name: "relative base",
+		page: "http://example.com/docs/index.html",
+		body: `<head><base href="v2/"></head><a href="intro.html"></a><img src="../logo.png">`,
+		want: []string{
+			"http://example.com/docs/v2/intro.html",
+			"http://example.com/docs/logo.png",
+		},
+	},
+	{
+		name: "cross host base",
+		page: "http://example.com/index.html",
+		body: `<head><base href="https://cdn.example.org/assets/"></head>
+			<img src="logo.png"><a href="/about.html"></a><a href="http://example.com/contact.html"></a>`,
+		want: []string{
+			"https://cdn.example.org/assets/logo.png",
+			"https://cdn.example.org/about.html",
+			"http://example.com/contact.html",
+		},
+	},
+	{
+		name: "only the first base counts",
+		page: "http://example.com/index.html",
+		body: `<head><base href="/first/"><base href="/second/"></head><a href="a.html"></a>`,
+		want: []string{"http://example.com/first/a.html"},
+	},
+	{
+		name: "base without a usable scheme is ignored",
+		page: "http://example.com/docs/index.html",
+		body: `<head><base href="javascript:void(0)"></head><a href="a.html"></a>`,
+		want: []string{"http://example.com/docs/a.html"},
+	},
+	{
+		name: "codebase resolves against the base",
+		page: "http://example.com/index.html",
+		body: `<head><base href="/docs/"></head><applet code="Main.class" codebase="classes"></applet>`,
+		want: []string{"http://example.com/docs/classes/Main.class"},
+	},
+}
+
+func TestExtractHTML(t *testing.T) {
+	for _, tt := range extractHTMLTT {
+		t.Logf("==== extract HTML: %s ====", tt.name)
+
+		page, err := url.Parse(tt.page)
+		check(t, err == nil, "bad page URL, %v", err)
+		node, err := html.Parse(strings.NewReader(tt.body))
+		check(t, err == nil, "bad HTML, %v", err)
+
+		x := &htmlExtractor{resources: htmlResources}
+
+		got := newStringSet()
+		for _, l := range x.extract(page, node).links {
+			got.Add(l.url.String())
+		}
+
+		check(t, len(got.Slice()) == len(tt.want), "want %d links %q, got %d %q", len(tt.want), tt.want, len(got.Slice()), got.Slice())
+		for _, want := range tt.want {
+			check(t, got.Contains(want), "want link %q, got %q", want, got.Slice())
+		}
+		t.Log("ok!")
+	}
+}
+
+var extractRobotsTT = []struct {
+	name        string
+	body        string
+	relNoFollow bool
+	wantLinks   int
+	want        robotsDirectives
+}{
+	{
+		name:      "no meta tags",
+		body:      `<a href="/a"></a>`,
+		wantLinks: 1,
+	},
+	{
+		name:      "robots meta tag",
+		body:      `<head><meta name="robots" content="noindex,nofollow"></head><a href="/a"></a>`,
+		wantLinks: 1,
+		want:      robotsDirectives{noIndex: true, noFollow: true},
+	},
+	{
+		name:      "meta tag for our agent",
+		body:      `<head><meta name="CrawlerUnderTest" content="noindex"></head>`,
+		wantLinks: 0,
+		want:      robotsDirectives{noIndex: true},
+	},
+	{
+		name:      "meta tag for another agent",
+		body:      `<head><meta name="googlebot" content="noindex"><meta name="robots" content="nofollow"></head>`,
+		wantLinks: 0,
+		want:      robotsDirectives{noFollow: true},
+	},
+	{
+		name:      "rel nofollow is ignored by default",
+		body:      `<a href="/a" rel="nofollow"></a><a href="/b"></a>`,
+		wantLinks: 2,
+	},
+	{
+		name:        "rel nofollow skips the link",
+		body:        `<a href="/a" rel="external NoFollow"></a><a href="/b" rel="next"></a>`,
+		relNoFollow: true,
+		wantLinks:   1,
+	},
+}
+
+func TestExtractHTMLRobots(t *testing.T) {
+	page, _ := url.Parse("http://example.com")
+	for _, tt := range extractRobotsTT {
+		t.Logf("==== extract HTML robots: %s ====", tt.name)
+
+		node, err := html.Parse(strings.NewReader(tt.body))
+		check(t, err == nil, "bad HTML, %v", err)
+
+		x := &htmlExtractor{
+			resources:   htmlResources,
+			agent:       agentToken(testAgent),
+			relNoFollow: tt.relNoFollow,
+		}
+		got := x.extract(page, node)
+
+		check(t, len(got.links) == tt.wantLinks, "want %d links, got %d", tt.wantLinks, len(got.links))
+		check(t, got.robots == tt.want, "want directives %+v, got %+v", tt.want, got.robots)
+		t.Log("ok!")
+	}
+}
+
+func TestExtractHTMLCanonical(t *testing.T) {
+	tt := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"none", `<link rel="stylesheet" href="/s.css">`, ""},
+		{"relative", `<head><link rel="canonical" href="../a/"></head>`, "http://example.com/a"},
+		{"first wins", `<link rel="Canonical" href="/a"><link rel="canonical" href="/b">`, "http://example.com/a"},
+		{"among other types", `<link rel="alternate canonical" href="http://www.example.com/a">`, "http://www.example.com/a"},
+		{"after base", `<base href="http://example.com/dir/"><link rel="canonical" href="a">`, "http://example.com/dir/a"},
+	}
+
+	page, _ := url.Parse("http://example.com/x/y")
+	for _, tt := range tt {
+		node, err := html.Parse(strings.NewReader(tt.body))
+		check(t, err == nil, "bad HTML, %v", err)
+
+		x := &htmlExtractor{resources: htmlResources}
+		got := x.extract(page, node).canonical
+		switch {
+		case tt.want == "":
+			check(t, got == nil, "%s: want no canonical, got %v", tt.name, got)
+		default:
+			check(t, got != nil && got.String() == tt.want, "%s: want canonical %q, got %v", tt.name, tt.want, got)
+		}
+	}
+}
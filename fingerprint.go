@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"code.google.com/p/go.net/html"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is how many consecutive words make the features of a
+// simhash. Longer shingles tell apart pages that use the same words in a
+// different order.
+const shingleSize = 3
+
+// visibleText returns the words of the text a browser would show, in
+// order and lowercased. Scripts, styles and the head, but for its title,
+// aren't shown.
+func visibleText(node *html.Node) []string {
+	var words []string
+	var walk func(n *html.Node, inHead bool)
+	walk = func(n *html.Node, inHead bool) {
+		switch n.Type {
+		case html.TextNode:
+			if !inHead || n.Parent != nil && n.Parent.Data == "title" {
+				words = append(words, strings.FieldsFunc(strings.ToLower(n.Data), isWordSeparator)...)
+			}
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			case "head":
+				inHead = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inHead)
+		}
+	}
+	walk(node, false)
+	return words
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// simhash fingerprints a text so that similar texts have fingerprints
+// that differ by few bits. Every shingle of words votes for the bits of
+// its hash.
+//
+// Texts shorter than a shingle, like those of empty pages, redirect
+// stubs or images, have no fingerprint and get zero: they would all look
+// alike.
+//
+// see https://www.cs.princeton.edu/courses/archive/spring04/cos598B/bib/CharikarEstim.pdf
+func simhash(words []string) uint64 {
+	if len(words) < shingleSize {
+		return 0
+	}
+
+	var votes [64]int
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for bit := uint(0); bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				votes[bit]++
+			} else {
+				votes[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if votes[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Similarity is the fraction of bits two simhashes have in common, 1
+// when they're the same.
+func Similarity(a, b uint64) float64 {
+	diff := a ^ b
+	distance := 0
+	for ; diff != 0; diff &= diff - 1 {
+		distance++
+	}
+	return 1 - float64(distance)/64
+}
+
+// DuplicateReport groups the pages of a crawl that have the same content.
+type DuplicateReport struct {
+	// Exact are pages with the same bytes.
+	Exact [][]string `json:"exact"`
+	// Near are pages with a similar visible text.
+	Near []NearDuplicates `json:"near"`
+}
+
+// NearDuplicates are pages whose visible text is similar.
+type NearDuplicates struct {
+	URLs []string `json:"urls"`
+	// Similarity is the lowest similarity between two pages that made
+	// them part of the cluster.
+	Similarity float64 `json:"similarity"`
+}
+
+// ReportDuplicates clusters the pages of a graph that are exact
+// duplicates, and those whose text is at least as similar as threshold,
+// between 0 and 1. Exact duplicates of each other are counted once among
+// near duplicates, and pages without a simhash are left out of them.
+//
+// Every pair of pages is compared, which is fine up to tens of thousands
+// of pages.
+func ReportDuplicates(g ResourceGraph, threshold float64) DuplicateReport {
+	byHash := make(map[string][]string)
+	var hashes []string
+	simhashes := make(map[string]uint64)
+	for _, link := range graphLinks(g) {
+		info, _ := g.Info(link)
+		if info.ContentHash == "" {
+			continue
+		}
+		if _, ok := byHash[info.ContentHash]; !ok {
+			hashes = append(hashes, info.ContentHash)
+			simhashes[info.ContentHash] = info.SimHash
+		}
+		byHash[info.ContentHash] = append(byHash[info.ContentHash], link)
+	}
+
+	report := DuplicateReport{}
+	for _, hash := range hashes {
+		if len(byHash[hash]) > 1 {
+			report.Exact = append(report.Exact, byHash[hash])
+		}
+	}
+
+	// clusters of near duplicates, joined by their most similar pairs
+	cluster := make([]int, len(hashes))
+	lowest := make(map[int]float64)
+	for i := range cluster {
+		cluster[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if cluster[i] != i {
+			cluster[i] = find(cluster[i])
+		}
+		return cluster[i]
+	}
+	for i := range hashes {
+		if simhashes[hashes[i]] == 0 {
+			continue
+		}
+		for j := i + 1; j < len(hashes); j++ {
+			if simhashes[hashes[j]] == 0 {
+				continue
+			}
+			sim := Similarity(simhashes[hashes[i]], simhashes[hashes[j]])
+			if sim < threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			low := sim
+			for _, r := range []int{ri, rj} {
+				if l, ok := lowest[r]; ok && l < low {
+					low = l
+				}
+			}
+			cluster[rj] = ri
+			lowest[ri] = low
+		}
+	}
+
+	members := make(map[int][]string)
+	var roots []int
+	for i, hash := range hashes {
+		r := find(i)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], byHash[hash][0])
+	}
+	for _, r := range roots {
+		if len(members[r]) < 2 {
+			continue
+		}
+		urls := members[r]
+		sort.Strings(urls)
+		report.Near = append(report.Near, NearDuplicates{URLs: urls, Similarity: lowest[r]})
+	}
+	return report
+}
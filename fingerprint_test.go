@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"code.google.com/p/go.net/html"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVisibleText(t *testing.T) {
+	body := `<html><head><title>The Title</title><script>var x = "hidden";</script>
+		<style>p { color: red }</style></head>
+		<body><p>Hello, <b>World</b>!</p><noscript>no js</noscript><p>it's 2014</p></body></html>`
+	node, err := html.Parse(strings.NewReader(body))
+	check(t, err == nil, "bad HTML, %v", err)
+
+	want := []string{"the", "title", "hello", "world", "it", "s", "2014"}
+	got := visibleText(node)
+	check(t, reflect.DeepEqual(got, want), "want words %q, got %q", want, got)
+}
+
+// essay is a text of n words, where the words listed in changed differ.
+func essay(n int, changed ...int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i%37*i%101)
+	}
+	for _, i := range changed {
+		words[i] = "changed"
+	}
+	return words
+}
+
+func TestSimhash(t *testing.T) {
+	original := simhash(essay(300))
+
+	check(t, simhash(essay(300)) == original, "want the same text to have the same simhash")
+	check(t, simhash(nil) == 0, "want no text to have an empty simhash")
+	check(t, simhash([]string{"redirecting", "now"}) == 0, "want a text shorter than a shingle to have an empty simhash")
+
+	near := Similarity(original, simhash(essay(300, 150)))
+	check(t, near >= 0.9, "want a one word change to be similar, got %v", near)
+
+	far := Similarity(original, simhash(strings.Fields(strings.Repeat("something else entirely ", 100))))
+	check(t, far < 0.8, "want different texts not to be similar, got %v", far)
+}
+
+func TestSimilarity(t *testing.T) {
+	tt := []struct {
+		a, b uint64
+		want float64
+	}{
+		{0, 0, 1},
+		{0xff, 0xff, 1},
+		{0, 1, 1 - 1.0/64},
+		{0, 0xffffffffffffffff, 0},
+		{0xf0, 0x0f, 1 - 8.0/64},
+	}
+	for _, tt := range tt {
+		got := Similarity(tt.a, tt.b)
+		check(t, got == tt.want, "%x ~ %x: want %v, got %v", tt.a, tt.b, tt.want, got)
+	}
+}
+
+func TestReportDuplicates(t *testing.T) {
+	dig := newDigraph()
+	fingerprints := map[string]struct {
+		hash    string
+		simhash uint64
+	}{
+		"a":       {"h1", 0x0100},
+		"a?print": {"h1", 0x0100},
+		"b":       {"h2", 0x0101}, // 1 bit from a
+		"c":       {"h3", 0x0103}, // 1 bit from b, 2 from a
+		"d":       {"h4", 0xffff},
+		"e":       {"", 0},
+		// near empty pages, unrelated
+		"empty":       {"h5", simhash(nil)},
+		"empty?print": {"h5", simhash(nil)},
+		"loading":     {"h6", simhash(strings.Fields("loading"))},
+		"redirect":    {"h7", simhash(strings.Fields("redirecting now"))},
+	}
+	for link, fp := range fingerprints {
+		dig.AddEdge("root", link)
+		dig.MarkFingerprint(link, fp.hash, fp.simhash)
+	}
+
+	got := ReportDuplicates(dig, 1-1.0/64)
+	want := DuplicateReport{
+		Exact: [][]string{{"a", "a?print"}, {"empty", "empty?print"}},
+		Near:  []NearDuplicates{{URLs: []string{"a", "b", "c"}, Similarity: 1 - 1.0/64}},
+	}
+	check(t, reflect.DeepEqual(got, want), "want %+v, got %+v", want, got)
+
+	got = ReportDuplicates(dig, 1)
+	check(t, len(got.Near) == 0, "want no near duplicates at similarity 1, got %+v", got.Near)
+}
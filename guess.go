@@ -0,0 +1,307 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxGuessLen is the length past which a string isn't taken for a link.
+const maxGuessLen = 2048
+
+// guessedDocument is what's found in a document without markup, where
+// links are only guessed from what looks like one.
+type guessedDocument struct {
+	links []linkRef
+	// words are those of the text, to fingerprint the document
+	words []string
+}
+
+// guessFunc guesses the links of a document served from a URL.
+type guessFunc func(from *url.URL, r io.Reader, n Normalizer) (guessedDocument, error)
+
+// add resolves a guessed link and keeps it if it's valid.
+func (g *guessedDocument) add(from *url.URL, link string, n Normalizer) {
+	u, err := cleanFromURLString(from, link, n)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return
+	}
+	g.links = append(g.links, linkRef{url: u, raw: link, guessed: true})
+}
+
+// addWords keeps the words of some text, for the fingerprint.
+func (g *guessedDocument) addWords(text string) {
+	g.words = append(g.words, strings.FieldsFunc(strings.ToLower(text), isWordSeparator)...)
+}
+
+// textURL matches the absolute URLs written out in text. It stops at
+// whitespace and at what usually surrounds URLs, like quotes and
+// brackets.
+var textURL = regexp.MustCompile("(?i)\\bhttps?://[^\\s<>\"'`{}|\\\\^\\[\\]]+")
+
+// guessTextLinks finds the absolute URLs of plain text, like README or
+// robots-style files.
+func guessTextLinks(from *url.URL, r io.Reader, n Normalizer) (guessedDocument, error) {
+	var doc guessedDocument
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		doc.addWords(line)
+		for _, link := range textURL.FindAllString(line, -1) {
+			if link = trimTextURL(link); len(link) <= maxGuessLen {
+				doc.add(from, link, n)
+			}
+		}
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, err
+		}
+	}
+}
+
+// trimTextURL removes the punctuation ending the sentence a URL is in,
+// and the closing parenthesis around it, but not those that are part of
+// the URL, like in http://en.wikipedia.org/wiki/Go_(language).
+func trimTextURL(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?*", last) >= 0:
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+		default:
+			return link
+		}
+		link = link[:len(link)-1]
+	}
+	return link
+}
+
+// guessJSONLinks finds the string values of a JSON document that are
+// URLs, absolute or relative to the root of the server. Object keys are
+// never links. What was found before a syntax error is returned along
+// with it.
+func guessJSONLinks(from *url.URL, r io.Reader, n Normalizer) (guessedDocument, error) {
+	var doc guessedDocument
+	d := json.NewDecoder(r)
+	// objects tells for each open container if it's an object
+	var objects []bool
+	// key is set when the next string is an object key
+	key := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF && len(objects) > 0 {
+			// the decoder doesn't tell a document cut short
+			err = io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, err
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{':
+				objects = append(objects, true)
+				key = true
+				continue
+			case '[':
+				objects = append(objects, false)
+				key = false
+				continue
+			}
+			// a closed container is a value of its parent
+			objects = objects[:len(objects)-1]
+			key = false
+		case string:
+			if !key {
+				doc.addWords(tok)
+				if looksLikeLink(tok) {
+					doc.add(from, tok, n)
+				}
+			}
+		}
+		// objects alternate keys and values
+		key = !key && len(objects) > 0 && objects[len(objects)-1]
+	}
+}
+
+// looksLikeLink tells if a string is an absolute http(s) URL, or a path
+// from the root of the server, without anything a link wouldn't have.
+func looksLikeLink(s string) bool {
+	if len(s) < 2 || len(s) > maxGuessLen || strings.ContainsAny(s, " \t\r\n<>\"'`{}|\\^") {
+		return false
+	}
+	if s[0] == '/' {
+		// but not protocol-relative, or a comment
+		return s[1] != '/' && s[1] != '*'
+	}
+	lower := strings.ToLower(s)
+	for _, scheme := range []string{"http://", "https://"} {
+		if strings.HasPrefix(lower, scheme) && len(s) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// guessScriptLinks finds the string literals of a script that are links
+// to the origin it was served from, absolute or relative to the root of
+// the server. Comments are skipped, as are the template literals with
+// substitutions.
+func guessScriptLinks(from *url.URL, r io.Reader, n Normalizer) (guessedDocument, error) {
+	var doc guessedDocument
+	s := &scriptScanner{r: bufio.NewReader(r)}
+	for {
+		literal, ok, err := s.next()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, err
+		}
+		if !ok {
+			continue
+		}
+		doc.addWords(literal)
+		if !looksLikeLink(literal) {
+			continue
+		}
+		u, err := from.Parse(literal)
+		if err == nil && u.Scheme == from.Scheme && strings.EqualFold(u.Host, from.Host) {
+			doc.add(from, literal, n)
+		}
+	}
+}
+
+// scriptScanner reads the string literals of a script. It doesn't know
+// regular expression literals, a quote in one can make it read code as a
+// string, which is then unlikely to look like a link.
+type scriptScanner struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// next reads up to the end of the next string literal, and unescapes it.
+// ok is false when the literal can't be known, because it's unterminated,
+// too long or holds substitutions.
+func (s *scriptScanner) next() (literal string, ok bool, err error) {
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return "", false, err
+		}
+		switch c {
+		case '/':
+			switch next, _ := s.r.Peek(1); {
+			case len(next) == 1 && next[0] == '/':
+				_, err = s.r.ReadString('\n')
+			case len(next) == 1 && next[0] == '*':
+				_, _ = s.r.ReadByte()
+				err = s.skipBlockComment()
+			}
+			if err != nil {
+				return "", false, err
+			}
+		case '"', '\'', '`':
+			return s.literal(c)
+		}
+	}
+}
+
+func (s *scriptScanner) skipBlockComment() error {
+	star := false
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if star && c == '/' {
+			return nil
+		}
+		star = c == '*'
+	}
+}
+
+// literal reads a string literal up to its closing quote.
+func (s *scriptScanner) literal(quote byte) (string, bool, error) {
+	s.buf = s.buf[:0]
+	ok := true
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case c == quote:
+			return string(s.buf), ok && len(s.buf) <= maxGuessLen, nil
+		case c == '\n' && quote != '`':
+			// unterminated
+			return "", false, nil
+		case c == '$' && quote == '`':
+			if next, _ := s.r.Peek(1); len(next) == 1 && next[0] == '{' {
+				ok = false
+			}
+		case c == '\\':
+			c, err = s.r.ReadByte()
+			if err != nil {
+				return "", false, err
+			}
+			switch c {
+			case '/', '\\', '"', '\'', '`', '$':
+			case 'u':
+				hex, err := s.r.Peek(4)
+				if err != nil {
+					return "", false, err
+				}
+				r, perr := strconv.ParseUint(string(hex), 16, 16)
+				_, _ = s.r.Discard(4)
+				if perr != nil {
+					ok = false
+					continue
+				}
+				s.buf = append(s.buf, string(rune(r))...)
+				continue
+			default:
+				// like \n, never in a link
+				ok = false
+			}
+		}
+		if len(s.buf) <= maxGuessLen {
+			s.buf = append(s.buf, c)
+		}
+	}
+}
+
+// isJSONType tells if documents of the media type are JSON.
+func isJSONType(mediatype string) bool {
+	return mediatype == "application/json" || strings.HasSuffix(mediatype, "+json")
+}
+
+// isScriptType tells if documents of the media type are JavaScript.
+func isScriptType(mediatype string) bool {
+	switch mediatype {
+	case "application/javascript", "text/javascript", "application/x-javascript",
+		"application/ecmascript", "text/ecmascript":
+		return true
+	}
+	return false
+}
+
+// isScriptLink tells if a link is to a script, known by its extension.
+func isScriptLink(u *url.URL) bool {
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".js", ".mjs":
+		return true
+	}
+	return false
+}
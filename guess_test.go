@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// guessed are the links a guess finds, sorted.
+func guessed(t *testing.T, guess guessFunc, from, body string) []string {
+	doc, err := guess(must(url.Parse(from)), strings.NewReader(body), nil)
+	check(t, err == nil, "couldn't guess the links of %q, %v", body, err)
+	var links []string
+	for _, l := range doc.links {
+		check(t, l.guessed, "want %v marked as a guess", l.url)
+		links = append(links, l.url.String())
+	}
+	sort.Strings(links)
+	return links
+}
+
+func TestGuessTextLinks(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"see http://example.com/a.", []string{"http://example.com/a"}},
+		{"(at https://example.com/b?x=1&y=2), or", []string{"https://example.com/b?x=1&y=2"}},
+		{"http://en.wikipedia.org/wiki/Go_(language)!", []string{"http://en.wikipedia.org/wiki/Go_(language)"}},
+		{"<http://example.com/c> and \"HTTP://example.com/d\"", []string{"http://example.com/c", "http://example.com/d"}},
+		{"[doc](http://example.com/e)\nSitemap: http://example.com/sitemap.xml\n", []string{"http://example.com/e", "http://example.com/sitemap.xml"}},
+		{"relative /a, ftp://example.com/f, mailto:me@example.com, example.com/g", nil},
+		{`<a href="/h">markup isn't parsed</a>`, nil},
+		{"http://", nil},
+	}
+	for _, tt := range tests {
+		got := guessed(t, guessTextLinks, "http://example.com/README", tt.body)
+		check(t, reflect.DeepEqual(tt.want, got), "%q: want %q, got %q", tt.body, tt.want, got)
+	}
+}
+
+func TestGuessJSONLinks(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"next": "/api/items?page=2", "self": "http://example.com/api/items"}`,
+			[]string{"http://example.com/api/items", "http://example.com/api/items?page=2"}},
+		{`[{"url": "https://other.com/x"}, ["/nested", 1, true, null]]`,
+			[]string{"http://example.com/nested", "https://other.com/x"}},
+		{`{"/keys": "aren't links", "http://example.com/key": {}}`, nil},
+		{`{"a": {}, "/not-a-key": "value", "b": [], "c": "/after-containers"}`,
+			[]string{"http://example.com/after-containers"}},
+		{`{"escaped": "http:\/\/example.com\/escaped"}`, []string{"http://example.com/escaped"}},
+		{`{"text": "hello world", "path": "/", "protocol": "//cdn.example.com/x", "date": "2014/05/11", "re": "/a b/"}`, nil},
+		{`"/top-level"`, []string{"http://example.com/top-level"}},
+	}
+	for _, tt := range tests {
+		got := guessed(t, guessJSONLinks, "http://example.com/api", tt.body)
+		check(t, reflect.DeepEqual(tt.want, got), "%s: want %q, got %q", tt.body, tt.want, got)
+	}
+
+	// what's found before a syntax error is kept
+	doc, err := guessJSONLinks(must(url.Parse("http://example.com/")), strings.NewReader(`["/a", "/b", }`), nil)
+	check(t, err != nil, "want a syntax error")
+	check(t, len(doc.links) == 2, "want the links before the error, got %v", doc.links)
+}
+
+func TestGuessScriptLinks(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`fetch("/api/users"); load('/static/app.css')`, []string{"http://example.com/api/users", "http://example.com/static/app.css"}},
+		{"var u = `/templates/list.html`, v = `/users/${id}`", []string{"http://example.com/templates/list.html"}},
+		{`a = "http://example.com/same"; b = "https://example.com/scheme"; c = "http://other.com/x"`, []string{"http://example.com/same"}},
+		{`x = "\/escaped\/path"; y = "\u002Funicode"; z = "/line\nbreak"`, []string{"http://example.com/escaped/path", "http://example.com/unicode"}},
+		{"// fetch(\"/commented\")\n/* \"/block\" */ go(\"/live\")", []string{"http://example.com/live"}},
+		{`s.replace(/"/g, "");` + "\n" + `open("/after-regexp")`, []string{"http://example.com/after-regexp"}},
+		{`a = 1 / 2; b = "relative/path"; c = "/"; d = "</div>"; e = "/a b"`, nil},
+		{`"/unterminated`, nil},
+	}
+	for _, tt := range tests {
+		got := guessed(t, guessScriptLinks, "http://example.com/js/app.js", tt.body)
+		check(t, reflect.DeepEqual(tt.want, got), "%s: want %q, got %q", tt.body, tt.want, got)
+	}
+}
+
+func TestCrawlGuessesLinks(t *testing.T) {
+	pages := map[string]struct{ contentType, body string }{
+		"/":            {"text/html", `<a href="/README"></a><a href="/api"></a><script src="/app.js"></script>`},
+		"/README":      {"text/plain; charset=utf-8", "Docs at http://HOST/docs. Elsewhere: http://other.com/x\n"},
+		"/api":         {"application/json", `{"items": ["/items/1"], "broken": `},
+		"/app.js":      {"application/javascript", `fetch("/from-script")`},
+		"/docs":        {"text/html", `<p>docs</p>`},
+		"/items/1":     {"application/hal+json", `{"_links": {"self": {"href": "/items/1"}}}`},
+		"/from-script": {"text/plain", `script`},
+	}
+
+	tests := []struct {
+		name                  string
+		text, json, script    bool
+		want                  []string
+		wantJSONErrorReported bool
+	}{
+		{"defaults", true, false, false, []string{"", "/README", "/api", "/app.js", "/docs"}, false},
+		{"all", true, true, true, []string{"", "/README", "/api", "/app.js", "/docs", "/from-script", "/items/1"}, true},
+		{"none", false, false, false, []string{"", "/README", "/api", "/app.js"}, false},
+	}
+
+	for _, tt := range tests {
+		var requests []string
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			page, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			w.Header().Set("Content-Type", page.contentType)
+			fmt.Fprint(w, strings.Replace(page.body, "HOST", r.Host, -1))
+		}
+		withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+			rec := &recorder{}
+			opts := DefaultOptions()
+			opts.Observer = rec
+			opts.TextLinks, opts.JSONLinks, opts.ScriptLinks = tt.text, tt.json, tt.script
+			c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+			check(t, err == nil, "%s: couldn't create crawler, %v", tt.name, err)
+			g, err := c.Crawl()
+			check(t, err == nil, "%s: couldn't crawl, %v", tt.name, err)
+
+			var got []string
+			g.Walk(func(link string, status int, _, _ []string) bool {
+				got = append(got, must(url.Parse(link)).Path)
+				return true
+			})
+			sort.Strings(got)
+			check(t, reflect.DeepEqual(tt.want, got), "%s: want resources %q, got %q", tt.name, tt.want, got)
+
+			// links from markup aren't guesses, those from text are
+			root, _ := g.Info(domain.String())
+			check(t, len(root.Guessed) == 0, "%s: want no guessed links from the page, got %q", tt.name, root.Guessed)
+			readme, _ := g.Info(domain.String() + "/README")
+			if tt.text {
+				check(t, reflect.DeepEqual(readme.Guessed, []string{domain.String() + "/docs"}), "%s: want /docs guessed, got %q", tt.name, readme.Guessed)
+				check(t, readme.ContentHash != "" && readme.Encoding == "utf-8", "%s: want the text fingerprinted, got %+v", tt.name, readme)
+			} else {
+				check(t, len(readme.RefersTo) == 0, "%s: want no links from text, got %q", tt.name, readme.RefersTo)
+			}
+
+			// the script is downloaded only when its links are guessed
+			getScript := false
+			for _, req := range requests {
+				getScript = getScript || req == "GET /app.js"
+			}
+			check(t, getScript == tt.script, "%s: want the script downloaded=%v, got requests %q", tt.name, tt.script, requests)
+
+			reported := false
+			for _, event := range rec.events {
+				reported = reported || strings.HasPrefix(event, "error parsing JSON")
+			}
+			check(t, reported == tt.wantJSONErrorReported, "%s: want the malformed JSON reported=%v, got %q", tt.name, tt.wantJSONErrorReported, rec.events)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// leafExtensions are the extensions of resources that never link further,
+// so that a HEAD request tells all the crawler needs to know about them.
+var leafExtensions = map[string]bool{
+	// images, but SVG which is parsed
+	".avif": true, ".bmp": true, ".gif": true, ".ico": true, ".jpeg": true,
+	".jpg": true, ".png": true, ".tif": true, ".tiff": true,
+	".webp": true,
+	// audio and video
+	".aac": true, ".avi": true, ".flac": true, ".m4a": true, ".m4v": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".mpeg": true,
+	".ogg": true, ".ogv": true, ".opus": true, ".wav": true, ".webm": true,
+	// scripts and fonts, stylesheets aren't leaves since they can import
+	".js": true, ".mjs": true, ".eot": true, ".otf": true, ".ttf": true,
+	".woff": true, ".woff2": true,
+	// documents and archives
+	".7z": true, ".bz2": true, ".dmg": true, ".doc": true, ".docx": true,
+	".exe": true, ".gz": true, ".iso": true, ".pdf": true, ".rar": true,
+	".tar": true, ".xls": true, ".xlsx": true, ".zip": true,
+}
+
+// parsedExtensions are the extensions of the types whose links are looked
+// for, when the crawler is set to, whatever else links to them: an SVG
+// image is parsed, not probed. Told here rather than by the system's MIME
+// types, for crawls to be the same everywhere.
+var parsedExtensions = map[string]string{
+	// pages and XML documents
+	".htm":   "text/html",
+	".html":  "text/html",
+	".xhtml": "application/xhtml+xml",
+	".svg":   "image/svg+xml",
+	".xml":   "application/xml",
+	".rss":   "application/rss+xml",
+	".atom":  "application/atom+xml",
+	// those whose links are guessed
+	".txt":  "text/plain",
+	".json": "application/json",
+	".js":   "text/javascript",
+	".mjs":  "text/javascript",
+}
+
+// parsedType is the media type told by the extension of the path of u,
+// if it's one of those that can be parsed.
+func parsedType(u *url.URL) (string, bool) {
+	mediatype, ok := parsedExtensions[strings.ToLower(path.Ext(u.Path))]
+	return mediatype, ok
+}
+
+// hasLeafExtension tells if the path of u ends with the extension of a
+// resource that never links further.
+func hasLeafExtension(u *url.URL) bool {
+	return leafExtensions[strings.ToLower(path.Ext(u.Path))]
+}
+
+// probe does a HEAD request, and falls back on GET for the servers that
+// don't answer HEAD properly. Bodies are never read, the response is
+// returned closed.
+func probe(client *http.Client, agent string, u *url.URL) (*http.Response, error) {
+	resp, err := request(client, agent, "HEAD", u)
+	if err == nil && resp.StatusCode < 400 {
+		return resp, nil
+	}
+	return request(client, agent, "GET", u)
+}
+
+func request(client *http.Client, agent, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", agent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, resp.Body.Close()
+}
+
+// cappedReader reads up to max bytes, and remembers if there was more to
+// read. A max of zero or less reads everything.
+type cappedReader struct {
+	r         io.Reader
+	max       int64
+	read      int64
+	truncated bool
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.max > 0 && c.read >= c.max {
+		// peek a byte to know if anything is cut
+		var b [1]byte
+		if n, _ := io.ReadFull(c.r, b[:]); n > 0 {
+			c.truncated = true
+		}
+		return 0, io.EOF
+	}
+	if left := c.max - c.read; c.max > 0 && int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	return n, err
+}
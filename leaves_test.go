@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHasLeafExtension(t *testing.T) {
+	tt := []struct {
+		link string
+		want bool
+	}{
+		{"http://example.com/img/logo.png", true},
+		{"http://example.com/IMG/LOGO.PNG", true},
+		{"http://example.com/app.min.js?v=3", true},
+		{"http://example.com/talk.mp4#t=10", true},
+		{"http://example.com/", false},
+		{"http://example.com/posts/hello.html", false},
+		{"http://example.com/download?file=a.zip", false},
+		{"http://example.com/png", false},
+	}
+	for _, tt := range tt {
+		got := hasLeafExtension(must(url.Parse(tt.link)))
+		check(t, got == tt.want, "%q: want leaf=%v, got %v", tt.link, tt.want, got)
+	}
+}
+
+func TestParsedType(t *testing.T) {
+	tt := []struct {
+		link string
+		want string
+	}{
+		{"http://example.com/img/logo.svg", "image/svg+xml"},
+		{"http://example.com/FEED.RSS", "application/rss+xml"},
+		{"http://example.com/posts/hello.html?x=1", "text/html"},
+		{"http://example.com/robots.txt", "text/plain"},
+		{"http://example.com/img/logo.png", ""},
+		{"http://example.com/", ""},
+	}
+	for _, tt := range tt {
+		got, ok := parsedType(must(url.Parse(tt.link)))
+		check(t, got == tt.want && ok == (tt.want != ""), "%q: want type %q, got %q", tt.link, tt.want, got)
+	}
+}
+
+func TestCappedReader(t *testing.T) {
+	tt := []struct {
+		name          string
+		body          string
+		max           int64
+		want          string
+		wantTruncated bool
+	}{
+		{"no cap", "hello world", 0, "hello world", false},
+		{"under the cap", "hello", 10, "hello", false},
+		{"exactly the cap", "hello", 5, "hello", false},
+		{"over the cap", "hello world", 5, "hello", true},
+		{"empty", "", 5, "", false},
+	}
+	for _, tt := range tt {
+		r := &cappedReader{r: strings.NewReader(tt.body), max: tt.max}
+		got, err := ioutil.ReadAll(r)
+		check(t, err == nil, "%s: unexpected error, %v", tt.name, err)
+		check(t, string(got) == tt.want, "%s: want %q, got %q", tt.name, tt.want, got)
+		check(t, r.truncated == tt.wantTruncated, "%s: want truncated=%v, got %v", tt.name, tt.wantTruncated, r.truncated)
+	}
+}
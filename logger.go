@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level tells how important a log entry is.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel reads the name of a level, like "info".
+func ParseLevel(name string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes log entries made of a message and of key/value fields,
+// given as alternating keys and values.
+//
+//	logger.Log(LevelInfo, "crawled", "url", u, "status", 200)
+type Logger interface {
+	Log(level Level, msg string, kv ...interface{})
+}
+
+// NopLogger discards everything, it's the logger of the crawlers that
+// are given none.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...interface{}) {}
+
+// NewLogfmtLogger writes the entries at least as important as min to w,
+// one line per entry, as logfmt.
+//
+//	time=2014-05-11T02:28:05Z level=info msg=crawled url=http://antoine.im status=200
+func NewLogfmtLogger(w io.Writer, min Level) Logger {
+	return &writerLogger{w: w, min: min, now: time.Now, format: formatLogfmt}
+}
+
+// NewJSONLogger writes the entries at least as important as min to w, one
+// JSON object per line.
+//
+//	{"time":"2014-05-11T02:28:05Z","level":"info","msg":"crawled","url":"http://antoine.im","status":200}
+func NewJSONLogger(w io.Writer, min Level) Logger {
+	return &writerLogger{w: w, min: min, now: time.Now, format: formatJSON}
+}
+
+type writerLogger struct {
+	lock   sync.Mutex
+	w      io.Writer
+	min    Level
+	now    func() time.Time
+	format func(buf *bytes.Buffer, fields []interface{})
+}
+
+func (l *writerLogger) Log(level Level, msg string, kv ...interface{}) {
+	if level < l.min {
+		return
+	}
+	fields := append([]interface{}{
+		"time", l.now().UTC().Format(time.RFC3339),
+		"level", level.String(),
+		"msg", msg,
+	}, kv...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, nil)
+	}
+
+	var buf bytes.Buffer
+	l.format(&buf, fields)
+	buf.WriteByte('\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, _ = l.w.Write(buf.Bytes())
+}
+
+func formatLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(fmt.Sprint(fields[i])))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(fieldString(fields[i+1])))
+	}
+}
+
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func formatJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(fieldValue(fields[i+1]))
+		if err != nil {
+			value, _ = json.Marshal(fieldString(fields[i+1]))
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+// fieldValue is how a field is written as JSON: numbers and booleans as
+// is, everything else as a string.
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int, int64, uint64, float64:
+		return v
+	}
+	return fieldString(v)
+}
+
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLoggers(t *testing.T) {
+	u := must(url.Parse("http://example.com/a b"))
+	tt := []struct {
+		name   string
+		logger func(*bytes.Buffer) Logger
+		level  Level
+		msg    string
+		kv     []interface{}
+		want   string
+	}{
+		{
+			name:   "logfmt",
+			logger: func(b *bytes.Buffer) Logger { return NewLogfmtLogger(b, LevelInfo) },
+			level:  LevelInfo,
+			msg:    "crawled",
+			kv:     []interface{}{"url", u, "status", 200, "took", time.Second, "ok", true},
+			want:   `time=2014-05-11T02:28:04Z level=info msg=crawled url=http://example.com/a%20b status=200 took=1s ok=true` + "\n",
+		},
+		{
+			name:   "logfmt quoting",
+			logger: func(b *bytes.Buffer) Logger { return NewLogfmtLogger(b, LevelInfo) },
+			level:  LevelError,
+			msg:    "fetch failed",
+			kv:     []interface{}{"err", errors.New(`said "no"`), "empty", "", "bad key", 1, "odd"},
+			want:   `time=2014-05-11T02:28:04Z level=error msg="fetch failed" err="said \"no\"" empty="" bad_key=1 odd=""` + "\n",
+		},
+		{
+			name:   "logfmt below level",
+			logger: func(b *bytes.Buffer) Logger { return NewLogfmtLogger(b, LevelInfo) },
+			level:  LevelDebug,
+			msg:    "nofollow",
+			want:   "",
+		},
+		{
+			name:   "json",
+			logger: func(b *bytes.Buffer) Logger { return NewJSONLogger(b, LevelDebug) },
+			level:  LevelDebug,
+			msg:    "crawled",
+			kv:     []interface{}{"url", u, "status", 200, "err", nil, "failed", errors.New("nope")},
+			want:   `{"time":"2014-05-11T02:28:04Z","level":"debug","msg":"crawled","url":"http://example.com/a%20b","status":200,"err":null,"failed":"nope"}` + "\n",
+		},
+	}
+
+	for _, tt := range tt {
+		var buf bytes.Buffer
+		logger := tt.logger(&buf).(*writerLogger)
+		logger.now = func() time.Time { return time.Date(2014, 5, 11, 2, 28, 4, 0, time.UTC) }
+		logger.Log(tt.level, tt.msg, tt.kv...)
+		check(t, buf.String() == tt.want, "%s: want\n%s\ngot\n%s", tt.name, tt.want, buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		got, err := ParseLevel(l.String())
+		check(t, err == nil && got == l, "want %v parsed, got %v, %v", l, got, err)
+	}
+	_, err := ParseLevel("loud")
+	check(t, err != nil, "want unknown levels rejected")
+}
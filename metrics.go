@@ -0,0 +1,328 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchBuckets are the upper bounds of the fetch latency histogram, in
+// seconds.
+var fetchBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// recentFetches is how many fetches the status page lists.
+const recentFetches = 20
+
+// MetricsObserver keeps count of what a crawl does, to serve it as
+// Prometheus metrics and as a JSON status page while the crawl runs.
+type MetricsObserver struct {
+	lock sync.Mutex
+	now  func() time.Time
+
+	started, finished time.Time
+	frontier          int
+	externals         int
+
+	// by status class, like "2xx"
+	fetched     map[string]int
+	revalidated int
+	bytes       int64
+	discovered  int
+	// by kind of rule, like "robots"
+	rejected map[string]int
+	// by type of error, like "timeout"
+	errors map[string]int
+
+	latencyBuckets []int
+	latencyCount   int
+	latencySum     float64
+
+	recent []RecentFetch
+}
+
+// RecentFetch is a fetch listed on the status page.
+type RecentFetch struct {
+	URL     string    `json:"url"`
+	Status  int       `json:"status_code"`
+	Elapsed string    `json:"elapsed"`
+	At      time.Time `json:"at"`
+}
+
+// NewMetricsObserver returns an observer that's ready to count.
+func NewMetricsObserver() *MetricsObserver {
+	return &MetricsObserver{
+		now:            time.Now,
+		fetched:        make(map[string]int),
+		rejected:       make(map[string]int),
+		errors:         make(map[string]int),
+		latencyBuckets: make([]int, len(fetchBuckets)),
+	}
+}
+
+func (m *MetricsObserver) Enqueued(_ *url.URL, external bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started.IsZero() {
+		m.started = m.now()
+	}
+	if external {
+		m.externals++
+	} else {
+		m.frontier++
+	}
+}
+
+func (m *MetricsObserver) FetchStarted(_ *url.URL, external bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if external {
+		m.externals--
+	} else {
+		m.frontier--
+	}
+}
+
+func (m *MetricsObserver) FetchDone(f Fetch) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch _, blocked := f.Err.(*notCheckedError); {
+	case blocked:
+		// never requested, robots.txt rejected it
+		m.rejected["robots"]++
+	case f.Err != nil:
+		m.errors[errorType(f.Err)]++
+	default:
+		m.fetched[fmt.Sprintf("%dxx", f.Status/100)]++
+	}
+	if f.Revalidated {
+		m.revalidated++
+	}
+	m.bytes += f.Bytes
+
+	if f.Status != -1 {
+		secs := f.Elapsed.Seconds()
+		for i, bound := range fetchBuckets {
+			if secs <= bound {
+				m.latencyBuckets[i]++
+			}
+		}
+		m.latencyCount++
+		m.latencySum += secs
+	}
+
+	m.recent = append(m.recent, RecentFetch{
+		URL:     f.URL.String(),
+		Status:  f.Status,
+		Elapsed: f.Elapsed.String(),
+		At:      m.now(),
+	})
+	if len(m.recent) > recentFetches {
+		m.recent = m.recent[len(m.recent)-recentFetches:]
+	}
+}
+
+func (m *MetricsObserver) LinkDiscovered(_, _ *url.URL, _ bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.discovered++
+}
+
+func (m *MetricsObserver) LinkRejected(_, _ *url.URL, reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rejected[rejectionKind(reason)]++
+}
+
+func (m *MetricsObserver) Error(_ *url.URL, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.errors[errorType(err)]++
+}
+
+func (m *MetricsObserver) CrawlFinished(ResourceGraph, time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.finished = m.now()
+}
+
+// rejectionKind is the kind of rule that rejected a link, the part of the
+// reason before the colon.
+//
+//	`robots.txt: blocked by line 2 "Disallow: /"` => "robots"
+func rejectionKind(reason string) string {
+	kind := reason
+	if i := strings.Index(reason, ":"); i >= 0 {
+		kind = reason[:i]
+	}
+	return strings.TrimSuffix(kind, ".txt")
+}
+
+// errorType sorts errors by what went wrong, for them to be counted.
+func errorType(err error) string {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return "timeout"
+	}
+	if oerr, ok := err.(*net.OpError); ok {
+		if _, ok := oerr.Err.(*net.DNSError); ok {
+			return "dns"
+		}
+		return "connection"
+	}
+	if verr, ok := err.(*tls.CertificateVerificationError); ok {
+		err = verr.Err
+	}
+	switch err.(type) {
+	case *net.DNSError:
+		return "dns"
+	case tls.RecordHeaderError, x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return "tls"
+	case *robotsError, *notCheckedError:
+		return "robots"
+	case *sitemapError:
+		return "sitemap"
+	}
+	return "other"
+}
+
+// Metrics serves the counts in the Prometheus text format.
+//
+// see https://prometheus.io/docs/instrumenting/exposition_formats/
+func (m *MetricsObserver) Metrics() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write(m.exposition())
+	})
+}
+
+func (m *MetricsObserver) exposition() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var buf bytes.Buffer
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	labeled := func(name, label string, counts map[string]int) {
+		var keys []string
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s{%s=%q} %d\n", name, label, k, counts[k])
+		}
+	}
+
+	metric("crawler_pages_fetched_total", "counter", "Resources fetched, by status class.")
+	labeled("crawler_pages_fetched_total", "class", m.fetched)
+
+	metric("crawler_pages_revalidated_total", "counter", "Resources that didn't change since the previous crawl.")
+	fmt.Fprintf(&buf, "crawler_pages_revalidated_total %d\n", m.revalidated)
+
+	metric("crawler_bytes_downloaded_total", "counter", "Bytes of response bodies read.")
+	fmt.Fprintf(&buf, "crawler_bytes_downloaded_total %d\n", m.bytes)
+
+	metric("crawler_frontier_size", "gauge", "Links waiting to be crawled.")
+	fmt.Fprintf(&buf, "crawler_frontier_size %d\n", m.frontier)
+
+	metric("crawler_external_queue_size", "gauge", "External links waiting to be checked.")
+	fmt.Fprintf(&buf, "crawler_external_queue_size %d\n", m.externals)
+
+	metric("crawler_links_discovered_total", "counter", "Links found and kept in the graph.")
+	fmt.Fprintf(&buf, "crawler_links_discovered_total %d\n", m.discovered)
+
+	metric("crawler_links_rejected_total", "counter", "Links found but not crawled, by kind of rule.")
+	labeled("crawler_links_rejected_total", "reason", m.rejected)
+
+	metric("crawler_errors_total", "counter", "Errors, by type.")
+	labeled("crawler_errors_total", "type", m.errors)
+
+	metric("crawler_fetch_duration_seconds", "histogram", "Time to fetch a resource.")
+	for i, bound := range fetchBuckets {
+		fmt.Fprintf(&buf, "crawler_fetch_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.latencyBuckets[i])
+	}
+	fmt.Fprintf(&buf, "crawler_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(&buf, "crawler_fetch_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(&buf, "crawler_fetch_duration_seconds_count %d\n", m.latencyCount)
+
+	return buf.Bytes()
+}
+
+// Status is a snapshot of the progress of a crawl.
+type Status struct {
+	Started  time.Time `json:"started"`
+	Elapsed  string    `json:"elapsed"`
+	Finished bool      `json:"finished"`
+	Fetched  int       `json:"fetched"`
+	Frontier int       `json:"frontier"`
+	// ETA guesses how long the crawl has left, from the pace so far and
+	// the size of the frontier. Links found later aren't accounted for.
+	ETA     string        `json:"eta"`
+	Recent  []RecentFetch `json:"recent"`
+	Errors  int           `json:"errors"`
+	Rejects int           `json:"rejected"`
+}
+
+// Status tells how the crawl is going.
+func (m *MetricsObserver) Status() Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	if !m.finished.IsZero() {
+		now = m.finished
+	}
+
+	s := Status{
+		Started:  m.started,
+		Finished: !m.finished.IsZero(),
+		Frontier: m.frontier + m.externals,
+		Recent:   append([]RecentFetch{}, m.recent...),
+	}
+	for _, n := range m.fetched {
+		s.Fetched += n
+	}
+	for _, n := range m.errors {
+		s.Errors += n
+	}
+	for _, n := range m.rejected {
+		s.Rejects += n
+	}
+
+	var elapsed time.Duration
+	if !m.started.IsZero() {
+		elapsed = now.Sub(m.started)
+	}
+	s.Elapsed = elapsed.String()
+	if done := s.Fetched + s.Errors; done > 0 && !s.Finished {
+		perFetch := elapsed / time.Duration(done)
+		s.ETA = (perFetch * time.Duration(s.Frontier)).String()
+	}
+	return s
+}
+
+// StatusPage serves the status of the crawl as JSON.
+func (m *MetricsObserver) StatusPage() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.MarshalIndent(m.Status(), "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
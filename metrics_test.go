@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsObserver(t *testing.T) {
+	root := must(url.Parse("http://example.com/"))
+	a := must(url.Parse("http://example.com/a"))
+	b := must(url.Parse("http://example.com/b"))
+	other := must(url.Parse("http://other.com/"))
+
+	m := NewMetricsObserver()
+	m.Enqueued(root, false)
+	m.FetchStarted(root, false)
+	m.FetchDone(Fetch{URL: root, Status: 200, Elapsed: 80 * time.Millisecond, Bytes: 1024, Revalidated: true})
+	m.Enqueued(a, false)
+	m.LinkDiscovered(root, a, true)
+	m.Enqueued(b, false)
+	m.LinkDiscovered(root, b, true)
+	m.LinkRejected(root, a, `robots.txt: blocked by line 2 "Disallow: /"`)
+	m.LinkRejected(root, a, "trap: path longer than 1024 bytes")
+	m.Enqueued(other, true)
+	m.FetchStarted(a, false)
+	m.FetchDone(Fetch{URL: a, Status: 404, Elapsed: 2 * time.Second, Bytes: 10})
+	m.FetchStarted(b, false)
+	m.FetchDone(Fetch{URL: b, Status: -1, Elapsed: 3 * time.Second, Err: errors.New("boom")})
+	m.Error(root, &sitemapError{site: "http://other.com/sitemap.xml"})
+
+	rec := httptest.NewRecorder()
+	m.Metrics().ServeHTTP(rec, nil)
+	got := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE crawler_pages_fetched_total counter",
+		`crawler_pages_fetched_total{class="2xx"} 1`,
+		`crawler_pages_fetched_total{class="4xx"} 1`,
+		"crawler_pages_revalidated_total 1",
+		"crawler_bytes_downloaded_total 1034",
+		"# TYPE crawler_frontier_size gauge",
+		"crawler_frontier_size 0",
+		"crawler_external_queue_size 1",
+		"crawler_links_discovered_total 2",
+		`crawler_links_rejected_total{reason="robots"} 1`,
+		`crawler_links_rejected_total{reason="trap"} 1`,
+		`crawler_errors_total{type="other"} 1`,
+		`crawler_errors_total{type="sitemap"} 1`,
+		"# TYPE crawler_fetch_duration_seconds histogram",
+		`crawler_fetch_duration_seconds_bucket{le="0.05"} 0`,
+		`crawler_fetch_duration_seconds_bucket{le="0.1"} 1`,
+		`crawler_fetch_duration_seconds_bucket{le="2.5"} 2`,
+		`crawler_fetch_duration_seconds_bucket{le="+Inf"} 2`,
+		"crawler_fetch_duration_seconds_sum 2.08",
+		"crawler_fetch_duration_seconds_count 2",
+	} {
+		check(t, strings.Contains(got, line+"\n"), "want line %q in metrics\n%s", line, got)
+	}
+}
+
+func TestMetricsStatus(t *testing.T) {
+	clock := time.Date(2014, 5, 11, 2, 28, 4, 0, time.UTC)
+	m := NewMetricsObserver()
+	m.now = func() time.Time { return clock }
+
+	var links []*url.URL
+	for _, path := range []string{"/", "/a", "/b", "/c"} {
+		links = append(links, must(url.Parse("http://example.com"+path)))
+		m.Enqueued(links[len(links)-1], false)
+	}
+	for _, link := range links[:2] {
+		m.FetchStarted(link, false)
+		clock = clock.Add(time.Second)
+		m.FetchDone(Fetch{URL: link, Status: 200, Elapsed: time.Second})
+	}
+
+	rec := httptest.NewRecorder()
+	m.StatusPage().ServeHTTP(rec, nil)
+	var status Status
+	err := json.Unmarshal(rec.Body.Bytes(), &status)
+	check(t, err == nil, "couldn't decode status, %v", err)
+
+	check(t, status.Fetched == 2, "want 2 fetched, got %d", status.Fetched)
+	check(t, status.Frontier == 2, "want frontier of 2, got %d", status.Frontier)
+	check(t, status.Elapsed == "2s", "want 2s elapsed, got %q", status.Elapsed)
+	check(t, status.ETA == "2s", "want an ETA of 2s, got %q", status.ETA)
+	check(t, len(status.Recent) == 2 && status.Recent[1].URL == "http://example.com/a", "want recent fetches, got %v", status.Recent)
+
+	m.CrawlFinished(newDigraph(), 2*time.Second)
+	clock = clock.Add(time.Hour)
+	status = m.Status()
+	check(t, status.Finished, "want the crawl finished")
+	check(t, status.Elapsed == "2s", "want elapsed to stop with the crawl, got %q", status.Elapsed)
+	check(t, status.ETA == "", "want no ETA once finished, got %q", status.ETA)
+}
+
+func TestMetricsKeepsRecentFetches(t *testing.T) {
+	m := NewMetricsObserver()
+	link := must(url.Parse("http://example.com/"))
+	for i := 0; i < recentFetches*2; i++ {
+		m.FetchDone(Fetch{URL: link, Status: 200})
+	}
+	status := m.Status()
+	check(t, len(status.Recent) == recentFetches, "want %d recent fetches, got %d", recentFetches, len(status.Recent))
+	check(t, status.Fetched == recentFetches*2, "want %d fetched, got %d", recentFetches*2, status.Fetched)
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&url.Error{Op: "Get", URL: "http://nope/", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope"}}}, "dns"},
+		{&url.Error{Op: "Get", URL: "http://example.com/", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, "connection"},
+		{&url.Error{Op: "Get", URL: "http://example.com/", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}, "timeout"},
+		{&url.Error{Op: "Get", URL: "https://example.com/", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, "tls"},
+		{x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}, "tls"},
+		{x509.CertificateInvalidError{Cert: &x509.Certificate{}, Reason: x509.Expired}, "tls"},
+		{&notCheckedError{verdict: &RobotsVerdict{Rule: "Disallow: /", Line: 2}}, "robots"},
+		{&robotsError{host: "example.com", instead: "disallows all", err: errors.New("500")}, "robots"},
+		{&sitemapError{site: "http://other.com/sitemap.xml"}, "sitemap"},
+		{&sitemapError{site: "http://[::1", err: errors.New("missing ']' in host")}, "sitemap"},
+		{errors.New(`parsing XML of "http://example.com/sitemap.xml", robots.txt x509: tls:`), "other"},
+		{errors.New("unexpected EOF"), "other"},
+	}
+	for _, tt := range tests {
+		got := errorType(tt.err)
+		check(t, got == tt.want, "%v: want type %q, got %q", tt.err, tt.want, got)
+	}
+}
+
+func TestMetricsOfACrawl(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a"></a>`,
+		"/a": `<a href="/missing"></a>`,
+	}
+	withHandler(t, htmlPages(pages), func(domain *url.URL) {
+		m := NewMetricsObserver()
+		opts := DefaultOptions()
+		opts.Observer = m
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		status := m.Status()
+		check(t, status.Fetched == 3, "want 3 fetched, got %d", status.Fetched)
+		check(t, status.Frontier == 0, "want an empty frontier, got %d", status.Frontier)
+		check(t, m.bytes > 0, "want bytes downloaded")
+		check(t, m.fetched["4xx"] == 1, "want a 4xx, got %v", m.fetched)
+	})
+}
+
+func TestMetricsOfBlockedExternalLinks(t *testing.T) {
+	hosts := map[string]http.Handler{
+		"example.test": htmlPages(map[string]string{"/": `<a href="http://blocked.test/a"></a><a href="http://other.test/"></a>`}),
+		"blocked.test": htmlPages(map[string]string{"/a": `<p>A</p>`}),
+		"other.test":   htmlPages(map[string]string{"/": `<p>Other</p>`}),
+	}
+	robots := map[string]string{"blocked.test": "User-agent: *\nDisallow: /\n"}
+
+	withVirtualHosts(t, hosts, robots, func(client *http.Client) {
+		m := NewMetricsObserver()
+		opts := DefaultOptions()
+		opts.Client = client
+		opts.Observer = m
+		opts.CheckExternal = true
+		opts.ExternalDelay = 0
+		c, err := NewCrawlerWithOptions(must(url.Parse("http://example.test/")), testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		status := m.Status()
+		check(t, status.Frontier == 0, "want an empty frontier, got %d", status.Frontier)
+		check(t, m.externals == 0, "want no external link left, got %d", m.externals)
+		check(t, m.rejected["robots"] == 1, "want the blocked link rejected by robots.txt, got %v", m.rejected)
+		check(t, len(m.errors) == 0, "want no errors, got %v", m.errors)
+		check(t, m.fetched["2xx"] == 2, "want the page and the other link fetched, got %v", m.fetched)
+	})
+}
@@ -0,0 +1,404 @@
+package crawler
+
+import (
+	"bytes"
+	"code.google.com/p/go.net/html"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxMirrorName is the longest file name of the mirror, longer ones are
+// cut and end with a hash instead. Most file systems stop at 255 bytes.
+const maxMirrorName = 200
+
+// mirror saves the resources crawled to a directory, in a tree following
+// their URLs.
+type mirror struct {
+	dir        string
+	normalizer Normalizer
+	// files saved, by the normalized URLs they answer for
+	files map[string]*mirrorFile
+}
+
+// mirrorFile is a resource saved in the mirror.
+type mirrorFile struct {
+	*os.File
+	// path is relative to the mirror, slash separated
+	path string
+	// url is where the body came from, after redirects
+	url       *url.URL
+	mediatype string
+}
+
+func newMirror(dir string, n Normalizer) *mirror {
+	if n == nil {
+		n = DefaultNormalizer
+	}
+	return &mirror{dir: dir, normalizer: n, files: make(map[string]*mirrorFile)}
+}
+
+// create opens the file where the body of u is saved.
+func (m *mirror) create(u *url.URL, mediatype string) (*mirrorFile, error) {
+	p := mirrorPath(u, mediatype)
+	filename := filepath.Join(m.dir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &mirrorFile{File: file, path: p, url: u, mediatype: mediatype}, nil
+}
+
+// commit closes the file, and records it as the copy of its URL and of
+// the aliases it was requested as, like the URLs that redirected to it.
+func (m *mirror) commit(f *mirrorFile, aliases ...*url.URL) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	for _, u := range append(aliases, f.url) {
+		if key, ok := m.key(u); ok {
+			m.files[key] = f
+		}
+	}
+	return nil
+}
+
+// key is how URLs are known by the mirror: normalized, without their
+// fragment.
+func (m *mirror) key(u *url.URL) (string, bool) {
+	n, err := m.normalizer.Normalize(u)
+	if err != nil {
+		return "", false
+	}
+	n = copyURL(n)
+	n.Fragment = ""
+	return n.String(), true
+}
+
+// rewriteLinks rewrites the links of the HTML and CSS saved to the files
+// of the mirror they point to, as relative paths. Links to resources
+// that weren't saved are left as they are. The files that can't be
+// rewritten are reported to fail.
+func (m *mirror) rewriteLinks(fail func(*url.URL, error)) {
+	// a file can be saved under many URLs, rewrite it once
+	seen := make(map[string]bool)
+	var keys []string
+	for key := range m.files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := m.files[key]
+		if seen[f.path] {
+			continue
+		}
+		seen[f.path] = true
+
+		var rewrite func(io.Writer, []byte, *url.URL, func(*url.URL) (string, bool)) error
+		switch f.mediatype {
+		case "text/html", "application/xhtml+xml":
+			rewrite = rewriteHTML
+		case "text/css":
+			rewrite = func(w io.Writer, data []byte, base *url.URL, local func(*url.URL) (string, bool)) error {
+				_, err := io.WriteString(w, rewriteCSS(string(data), base, local))
+				return err
+			}
+		default:
+			continue
+		}
+		if err := m.rewriteFile(f, rewrite); err != nil {
+			fail(f.url, fmt.Errorf("rewriting links of %q, %v", f.path, err))
+		}
+	}
+}
+
+func (m *mirror) rewriteFile(f *mirrorFile, rewrite func(io.Writer, []byte, *url.URL, func(*url.URL) (string, bool)) error) error {
+	filename := filepath.Join(m.dir, filepath.FromSlash(f.path))
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	local := func(u *url.URL) (string, bool) {
+		key, ok := m.key(u)
+		if !ok {
+			return "", false
+		}
+		target, ok := m.files[key]
+		if !ok {
+			return "", false
+		}
+		rel := &url.URL{Path: relativePath(f.path, target.path), Fragment: u.Fragment}
+		return rel.String(), true
+	}
+
+	var buf bytes.Buffer
+	if err := rewrite(&buf, data, f.url, local); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// mirrorPath is where a resource is saved in the mirror, relative to it.
+// The path follows the host and path of u. Directories are saved as
+// their index, the query is kept in the file name before its extension,
+// and HTML documents always end in .html, for browsers to open them as
+// such. Other documents without an extension are saved as the index of
+// their path, which may also be the directory of the paths below it.
+//
+//	"http://example.com/"                => "example.com/index.html"
+//	"http://example.com/posts/a?p=2"     => "example.com/posts/a@p=2.html"
+//	"http://example.com:8080/s.css?v=1"  => "example.com_8080/s@v=1.css"
+//	"http://example.com/api"             => "example.com/api/index"
+func mirrorPath(u *url.URL, mediatype string) string {
+	isHTML := mediatype == "text/html" || mediatype == "application/xhtml+xml"
+
+	p := u.Path
+	switch {
+	case p == "" || strings.HasSuffix(p, "/"):
+		if isHTML {
+			p += "index.html"
+		} else {
+			p += "index"
+		}
+	case !isHTML && path.Ext(p) == "":
+		p += "/index"
+	}
+	// cleaning a rooted path drops the dot segments that would climb out
+	// of the mirror
+	dir, name := path.Split(path.Clean("/" + p))
+
+	ext := path.Ext(name)
+	if isHTML && ext != ".html" && ext != ".htm" {
+		ext = ".html"
+	} else {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if u.RawQuery != "" {
+		name += "@" + escapeMirrorName(u.RawQuery)
+	}
+	name = shortMirrorName(name, ext) + ext
+
+	var segments []string
+	for _, s := range strings.Split(dir, "/") {
+		if s != "" {
+			segments = append(segments, shortMirrorName(s, ""))
+		}
+	}
+	host := strings.Replace(u.Host, ":", "_", -1)
+	return path.Join(append(append([]string{host}, segments...), name)...)
+}
+
+// escapeMirrorName percent-encodes what's not safe in a file name, and
+// the percent sign, so that two queries never share a file name.
+func escapeMirrorName(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9',
+			strings.IndexByte("-_.=&,+", b) >= 0:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+// shortMirrorName cuts the names that would be too long once ext is
+// added, and ends them with their hash for them to stay apart.
+func shortMirrorName(name, ext string) string {
+	if len(name)+len(ext) <= maxMirrorName {
+		return name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return fmt.Sprintf("%s-%08x", name[:maxMirrorName-len(ext)-9], h.Sum32())
+}
+
+// relativePath is the path from the file at from to the file at to, both
+// slash separated and relative to the same directory.
+//
+//	"a/b/index.html", "a/c.css" => "../c.css"
+func relativePath(from, to string) string {
+	fromDirs := strings.Split(path.Dir(from), "/")
+	toParts := strings.Split(to, "/")
+	common := 0
+	for common < len(fromDirs) && common < len(toParts)-1 && fromDirs[common] == toParts[common] {
+		common++
+	}
+	var parts []string
+	for i := common; i < len(fromDirs); i++ {
+		if fromDirs[i] != "." {
+			parts = append(parts, "..")
+		}
+	}
+	return path.Join(append(parts, toParts[common:]...)...)
+}
+
+// rewriteHTML writes the document with its links replaced by what local
+// returns for them, when it returns true. The document is written as it
+// was read, only the tags whose links change are written anew. A base
+// href would have the local links resolve elsewhere, it's removed.
+func rewriteHTML(w io.Writer, data []byte, from *url.URL, local func(*url.URL) (string, bool)) error {
+	base := from
+	z := html.NewTokenizer(bytes.NewReader(data))
+	inStyle := false
+	for {
+		tt := z.Next()
+		raw := z.Raw()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+
+		case html.TextToken:
+			if inStyle {
+				raw = []byte(rewriteCSS(string(raw), base, local))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// the raw bytes are reused by the tokenizer, keep them first
+			raw = append([]byte{}, raw...)
+			tok := z.Token()
+			inStyle = tok.Data == "style" && tt == html.StartTagToken
+			if tok.Data == "base" && base == from {
+				if changed := rewriteBase(&tok, &base); changed {
+					raw = []byte(tok.String())
+				}
+				break
+			}
+			if rewriteTag(&tok, base, local) {
+				raw = []byte(tok.String())
+			}
+
+		case html.EndTagToken:
+			inStyle = false
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteBase removes the href of a base tag, after making it the base
+// the following links resolve against.
+func rewriteBase(tok *html.Token, base **url.URL) bool {
+	for i, attr := range tok.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+		u, err := (*base).Parse(strings.TrimSpace(attr.Val))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return false
+		}
+		*base = u
+		tok.Attr = append(tok.Attr[:i], tok.Attr[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// rewriteTag replaces the links of the attributes of a tag that the
+// crawler follows, and the URLs of its style.
+func rewriteTag(tok *html.Token, base *url.URL, local func(*url.URL) (string, bool)) (changed bool) {
+	for _, attr := range tok.Attr {
+		// links resolving against another attribute are left alone
+		if attr.Key == "codebase" {
+			return false
+		}
+	}
+
+	for i, attr := range tok.Attr {
+		if attr.Key == "style" {
+			css := rewriteCSS(attr.Val, base, local)
+			if css != attr.Val {
+				tok.Attr[i].Val = css
+				changed = true
+			}
+			continue
+		}
+		// the tokenizer, unlike the parser, keeps the xlink prefix
+		key := strings.TrimPrefix(attr.Key, "xlink:")
+		for _, res := range htmlResources {
+			if res.element != tok.Data || res.attr != key {
+				continue
+			}
+			val := attr.Val
+			offset := 0
+			for _, link := range res.values(attr.Val) {
+				start := strings.Index(val[offset:], link)
+				if start < 0 {
+					continue
+				}
+				start += offset
+				u, err := base.Parse(strings.TrimSpace(link))
+				if err != nil {
+					offset = start + len(link)
+					continue
+				}
+				localLink, ok := local(u)
+				if !ok {
+					offset = start + len(link)
+					continue
+				}
+				val = val[:start] + localLink + val[start+len(link):]
+				offset = start + len(localLink)
+			}
+			if val != attr.Val {
+				tok.Attr[i].Val = val
+				changed = true
+			}
+			break
+		}
+	}
+	return
+}
+
+// cssURL matches the url() and the @import of stylesheets, the URL being
+// in one of the groups.
+var cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'"\s)]*))\s*\)|@import\s*(?:"([^"]*)"|'([^']*)')`)
+
+// rewriteCSS replaces the URLs of a stylesheet by what local returns for
+// them, when it returns true.
+func rewriteCSS(css string, base *url.URL, local func(*url.URL) (string, bool)) string {
+	var buf bytes.Buffer
+	last := 0
+	for _, m := range cssURL.FindAllStringSubmatchIndex(css, -1) {
+		for g := 1; g < len(m)/2; g++ {
+			start, end := m[2*g], m[2*g+1]
+			if start < 0 {
+				continue
+			}
+			u, err := base.Parse(strings.TrimSpace(css[start:end]))
+			if err != nil {
+				break
+			}
+			localLink, ok := local(u)
+			if !ok {
+				break
+			}
+			buf.WriteString(css[last:start])
+			buf.WriteString(localLink)
+			last = end
+			break
+		}
+	}
+	buf.WriteString(css[last:])
+	return buf.String()
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMirrorPath(t *testing.T) {
+	html, css, none := "text/html", "text/css", ""
+	tests := []struct {
+		url, mediatype, want string
+	}{
+		{"http://example.com", html, "example.com/index.html"},
+		{"http://example.com/", html, "example.com/index.html"},
+		{"http://example.com/posts/", html, "example.com/posts/index.html"},
+		{"http://example.com/posts/a", html, "example.com/posts/a.html"},
+		{"http://example.com/posts/a.html", html, "example.com/posts/a.html"},
+		{"http://example.com/posts/a.htm", html, "example.com/posts/a.htm"},
+		{"http://example.com/index.php", html, "example.com/index.php.html"},
+		{"http://example.com/posts/a?p=2", html, "example.com/posts/a@p=2.html"},
+		{"http://example.com/?p=2&q=go", html, "example.com/index@p=2&q=go.html"},
+		{"http://example.com/search?q=a%20b/c", html, "example.com/search@q=a%2520b%2Fc.html"},
+		{"http://example.com/s.css?v=1", css, "example.com/s@v=1.css"},
+		{"http://example.com/img/logo.png", "image/png", "example.com/img/logo.png"},
+		{"http://example.com/feed", none, "example.com/feed/index"},
+		{"http://example.com/api?v=1", "application/json", "example.com/api/index@v=1"},
+		{"http://example.com/api/v1", "application/json", "example.com/api/v1/index"},
+		{"http://example.com/data/", "application/json", "example.com/data/index"},
+		{"http://example.com:8080/", html, "example.com_8080/index.html"},
+		{"http://example.com/a/../../../etc/passwd", none, "example.com/etc/passwd/index"},
+	}
+	for _, tt := range tests {
+		got := mirrorPath(must(url.Parse(tt.url)), tt.mediatype)
+		check(t, got == tt.want, "%s: want path %q, got %q", tt.url, tt.want, got)
+	}
+}
+
+func TestMirrorPathOfLongNames(t *testing.T) {
+	long := "http://example.com/" + strings.Repeat("a", 300) + "?q=" + strings.Repeat("b", 300)
+	other := "http://example.com/" + strings.Repeat("a", 300) + "?q=" + strings.Repeat("b", 299)
+
+	p := mirrorPath(must(url.Parse(long)), "text/html")
+	for _, name := range strings.Split(p, "/") {
+		check(t, len(name) <= maxMirrorName, "want names at most %d bytes, got %d", maxMirrorName, len(name))
+	}
+	check(t, strings.HasSuffix(p, ".html"), "want the extension kept, got %q", p)
+	check(t, p != mirrorPath(must(url.Parse(other)), "text/html"), "want long names apart, got %q", p)
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		from, to, want string
+	}{
+		{"example.com/index.html", "example.com/a.html", "a.html"},
+		{"example.com/index.html", "example.com/posts/a.html", "posts/a.html"},
+		{"example.com/posts/a.html", "example.com/index.html", "../index.html"},
+		{"example.com/a/b/index.html", "example.com/a/c.css", "../c.css"},
+		{"example.com/a/b/index.html", "example.com/x/y/z.png", "../../x/y/z.png"},
+		{"example.com/index.html", "cdn.example.com/s.css", "../cdn.example.com/s.css"},
+		{"example.com/index.html", "example.com/index.html", "index.html"},
+	}
+	for _, tt := range tests {
+		got := relativePath(tt.from, tt.to)
+		check(t, got == tt.want, "%s -> %s: want %q, got %q", tt.from, tt.to, tt.want, got)
+	}
+}
+
+// localLinks maps the URLs to their local paths, relative to the root of
+// example.com.
+func localLinks(paths map[string]string) func(*url.URL) (string, bool) {
+	return func(u *url.URL) (string, bool) {
+		frag := u.Fragment
+		u.Fragment = ""
+		p, ok := paths[u.String()]
+		if ok && frag != "" {
+			p += "#" + frag
+		}
+		return p, ok
+	}
+}
+
+func TestRewriteHTML(t *testing.T) {
+	local := localLinks(map[string]string{
+		"http://example.com/a":        "a.html",
+		"http://example.com/logo.png": "logo.png",
+		"http://example.com/big.png":  "big.png",
+		"http://example.com/bg.png":   "bg.png",
+		"http://example.com/s.css":    "s.css",
+	})
+	tests := []struct {
+		name, html, want string
+	}{
+		{"untouched", `<!DOCTYPE html><p class=x>Hi &amp; bye<!-- c --></p>`, `<!DOCTYPE html><p class=x>Hi &amp; bye<!-- c --></p>`},
+		{"href", `<a href="/a#top" class=x>A</a><a href=/b>B</a>`, `<a href="a.html#top" class="x">A</a><a href=/b>B</a>`},
+		{"same", `<img src='logo.png'/>`, `<img src='logo.png'/>`},
+		{"src", `<img src='/logo.png'/>`, `<img src="logo.png"/>`},
+		{"srcset", `<img srcset="logo.png 1x, /b.png 2x, big.png 3x">`, `<img srcset="logo.png 1x, /b.png 2x, big.png 3x">`},
+		{"absolute", `<link rel=stylesheet href="http://example.com/s.css">`, `<link rel="stylesheet" href="s.css">`},
+		{"style", `<style>body { background: url("/bg.png") }</style>`, `<style>body { background: url("bg.png") }</style>`},
+		{"style attribute", `<div style="background: url(/bg.png)"></div>`, `<div style="background: url(bg.png)"></div>`},
+		{"svg", `<svg><image xlink:href="/logo.png"/></svg>`, `<svg><image xlink:href="logo.png"/></svg>`},
+		{"base", `<base href="/posts/"><a href="../a">A</a>`, `<base><a href="a.html">A</a>`},
+		{"codebase", `<object codebase="/x/" data="/a"></object>`, `<object codebase="/x/" data="/a"></object>`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := rewriteHTML(&buf, []byte(tt.html), must(url.Parse("http://example.com/")), local)
+		check(t, err == nil, "%s: couldn't rewrite, %v", tt.name, err)
+		check(t, buf.String() == tt.want, "%s: want\n%s\ngot\n%s", tt.name, tt.want, buf.String())
+	}
+}
+
+func TestRewriteHTMLSrcset(t *testing.T) {
+	local := localLinks(map[string]string{
+		"http://example.com/img/a.png": "../img/a.png",
+		"http://example.com/img/b.png": "../img/b.png",
+	})
+	var buf bytes.Buffer
+	err := rewriteHTML(&buf, []byte(`<img srcset="/img/a.png 1x, /img/c.png 2x, /img/b.png 3x">`), must(url.Parse("http://example.com/posts/")), local)
+	check(t, err == nil, "couldn't rewrite, %v", err)
+	want := `<img srcset="../img/a.png 1x, /img/c.png 2x, ../img/b.png 3x">`
+	check(t, buf.String() == want, "want\n%s\ngot\n%s", want, buf.String())
+}
+
+func TestRewriteCSS(t *testing.T) {
+	local := localLinks(map[string]string{
+		"http://example.com/css/base.css":  "base.css",
+		"http://example.com/img/bg.png":    "../img/bg.png",
+		"http://example.com/fonts/a.woff2": "../fonts/a.woff2",
+	})
+	css := `@import "base.css";
+@import 'missing.css';
+body { background: url(../img/bg.png) }
+@font-face { src: url( "/fonts/a.woff2" ) format("woff2"), url('/fonts/a.woff') }
+a { background: url(data:image/png;base64,AAAA) }`
+	want := `@import "base.css";
+@import 'missing.css';
+body { background: url(../img/bg.png) }
+@font-face { src: url( "../fonts/a.woff2" ) format("woff2"), url('/fonts/a.woff') }
+a { background: url(data:image/png;base64,AAAA) }`
+	got := rewriteCSS(css, must(url.Parse("http://example.com/css/main.css")), local)
+	check(t, got == want, "want\n%s\ngot\n%s", want, got)
+}
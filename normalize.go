@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/purell"
+	"golang.org/x/net/idna"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Normalizer rewrites a URL to the form the crawler knows it by. Links
+// that normalize to the same URL are the same resource.
+type Normalizer interface {
+	Normalize(u *url.URL) (*url.URL, error)
+}
+
+// NormalizerFunc is a function used as a Normalizer.
+type NormalizerFunc func(u *url.URL) (*url.URL, error)
+
+// Normalize calls f(u).
+func (f NormalizerFunc) Normalize(u *url.URL) (*url.URL, error) { return f(u) }
+
+// NormalizerChain applies normalizers one after the other.
+type NormalizerChain []Normalizer
+
+// Normalize applies every normalizer of the chain, in order.
+func (chain NormalizerChain) Normalize(u *url.URL) (*url.URL, error) {
+	var err error
+	for _, n := range chain {
+		if u, err = n.Normalize(u); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// PurellNormalizer normalizes URLs with purell, using the given flags.
+func PurellNormalizer(flags purell.NormalizationFlags) Normalizer {
+	return NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+		return url.Parse(purell.NormalizeURL(copyURL(u), flags))
+	})
+}
+
+var (
+	// SafeNormalizer only makes changes that can't change the resource a
+	// URL points to, like lowercasing the host.
+	SafeNormalizer = PurellNormalizer(purell.FlagsSafe)
+
+	// DefaultNormalizer also removes trailing slashes and dot segments,
+	// which is right for most sites.
+	DefaultNormalizer = PurellNormalizer(purell.FlagsUsuallySafeGreedy)
+
+	// AggressiveNormalizer also removes directory indexes, fragments,
+	// duplicate slashes, tracking parameters and session IDs, sorts
+	// query keys and converts IDNs to punycode. It's right for sites that
+	// serve the same page under many URLs.
+	AggressiveNormalizer = NormalizerChain{
+		PunycodeHost,
+		PurellNormalizer(purell.FlagsUsuallySafeGreedy |
+			purell.FlagRemoveDirectoryIndex |
+			purell.FlagRemoveFragment |
+			purell.FlagRemoveDuplicateSlashes),
+		StripTrackingParams,
+		StripSessionIDs,
+		SortQueryKeys,
+	}
+)
+
+// StripQueryParams removes the query parameters with the given names,
+// ignoring case. A name ending with * removes every parameter starting
+// with the rest of the name.
+//
+//	StripQueryParams("utm_*")
+//	"/a?utm_source=x&id=2&UTM_medium=y" => "/a?id=2"
+func StripQueryParams(names ...string) Normalizer {
+	return NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+		return filterQuery(u, func(key string) bool {
+			key = strings.ToLower(key)
+			for _, name := range names {
+				name = strings.ToLower(name)
+				if strings.HasSuffix(name, "*") && strings.HasPrefix(key, name[:len(name)-1]) || key == name {
+					return false
+				}
+			}
+			return true
+		}), nil
+	})
+}
+
+// StripTrackingParams removes the query parameters used to track where
+// visitors come from, like utm_source or fbclid.
+var StripTrackingParams = StripQueryParams("utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid")
+
+// sessionParams are the usual names of session IDs.
+var sessionParams = []string{"jsessionid", "phpsessid", "aspsessionid*", "sid", "sessionid", "session_id", "cfid", "cftoken"}
+
+// sessionPathParam matches the session IDs some servers add to paths.
+//
+//	"/cart;jsessionid=A1B2" => "/cart"
+var sessionPathParam = regexp.MustCompile(`(?i);(jsessionid|phpsessid|sid|sessionid)=[^/;]*`)
+
+// StripSessionIDs removes session IDs from the query and the path.
+var StripSessionIDs = NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+	v, err := StripQueryParams(sessionParams...).Normalize(u)
+	if err != nil {
+		return nil, err
+	}
+	if sessionPathParam.MatchString(v.Path) {
+		v.Path = sessionPathParam.ReplaceAllString(v.Path, "")
+		v.RawPath = ""
+	}
+	return v, nil
+})
+
+// SortQueryKeys sorts the query parameters by key. Values of a repeated
+// key keep their order, since it can matter.
+var SortQueryKeys = NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+	if u.RawQuery == "" {
+		return u, nil
+	}
+	params := strings.Split(u.RawQuery, "&")
+	sort.Stable(byQueryKey(params))
+
+	v := copyURL(u)
+	v.RawQuery = strings.Join(params, "&")
+	return v, nil
+})
+
+type byQueryKey []string
+
+func (p byQueryKey) Len() int           { return len(p) }
+func (p byQueryKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byQueryKey) Less(i, j int) bool { return queryKey(p[i]) < queryKey(p[j]) }
+
+// LowercasePath lowercases the paths on the given hosts, for servers that
+// don't care about case, like IIS. Paths on every host are lowercased if
+// no host is given.
+func LowercasePath(hosts ...string) Normalizer {
+	return NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+		if len(hosts) != 0 && !(&Scope{Hosts: hosts}).allowsHost(u) {
+			return u, nil
+		}
+		v := copyURL(u)
+		v.Path = strings.ToLower(v.Path)
+		v.RawPath = ""
+		return v, nil
+	})
+}
+
+// PunycodeHost converts internationalized host names to their ASCII
+// form, mapped and checked the way browsers do, following UTS #46. Host
+// names that aren't valid are an error.
+//
+//	"http://bücher.example"  => "http://xn--bcher-kva.example"
+//	"http://ＢÜCHER.example" => "http://xn--bcher-kva.example"
+//
+// see https://www.unicode.org/reports/tr46/
+var PunycodeHost = NormalizerFunc(func(u *url.URL) (*url.URL, error) {
+	hostname := u.Hostname()
+	if isASCII(hostname) {
+		return u, nil
+	}
+	host, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return nil, fmt.Errorf("host %q, %v", hostname, err)
+	}
+	// lookups don't check the lengths of DNS
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) > 63 {
+			return nil, fmt.Errorf("host %q, label %q is longer than 63 bytes", hostname, label)
+		}
+	}
+	v := copyURL(u)
+	v.Host = host
+	if port := u.Port(); port != "" {
+		v.Host += ":" + port
+	}
+	return v, nil
+})
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// filterQuery keeps the query parameters whose key is kept, untouched
+// and in order.
+func filterQuery(u *url.URL, keep func(key string) bool) *url.URL {
+	if u.RawQuery == "" {
+		return u
+	}
+	var params []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if keep(queryKey(param)) {
+			params = append(params, param)
+		}
+	}
+	v := copyURL(u)
+	v.RawQuery = strings.Join(params, "&")
+	return v
+}
+
+// queryKey is the unescaped key of a query parameter.
+func queryKey(param string) string {
+	if i := strings.Index(param, "="); i >= 0 {
+		param = param[:i]
+	}
+	if key, err := url.QueryUnescape(param); err == nil {
+		return key
+	}
+	return param
+}
+
+func copyURL(u *url.URL) *url.URL {
+	v := *u
+	if u.User != nil {
+		user := *u.User
+		v.User = &user
+	}
+	return &v
+}
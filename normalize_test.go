@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizers(t *testing.T) {
+	tt := []struct {
+		name       string
+		normalizer Normalizer
+		link       string
+		want       string
+	}{
+		{"default keeps what it always did", DefaultNormalizer, "HTTP://Example.com:80/a/./b/../c/?q=1#top", "http://example.com/a/c?q=1#top"},
+		{"safe keeps trailing slash", SafeNormalizer, "http://Example.com/a/", "http://example.com/a/"},
+		{"aggressive", AggressiveNormalizer, "http://bücher.example/a//b/index.html?utm_source=x&b=2&a=1&PHPSESSID=9#top", "http://xn--bcher-kva.example/a/b?a=1&b=2"},
+
+		{"tracking params", StripTrackingParams, "http://example.com/?utm_source=x&id=2&UTM_Medium=y&fbclid=abc", "http://example.com/?id=2"},
+		{"only tracking params", StripTrackingParams, "http://example.com/a?utm_source=x", "http://example.com/a"},
+		{"no query", StripTrackingParams, "http://example.com/a", "http://example.com/a"},
+		{"named params", StripQueryParams("ref"), "http://example.com/a?ref=home&reference=1", "http://example.com/a?reference=1"},
+		{"escaped param names", StripQueryParams("utm_*"), "http://example.com/a?utm%5Fsource=x&b=1", "http://example.com/a?b=1"},
+
+		{"session in query", StripSessionIDs, "http://example.com/a?sid=42&page=2&ASPSESSIONIDQQ=x", "http://example.com/a?page=2"},
+		{"session in path", StripSessionIDs, "http://example.com/cart;jsessionid=A1B2?x=1", "http://example.com/cart?x=1"},
+
+		{"sort keys", SortQueryKeys, "http://example.com/?c=3&b=2&a=1", "http://example.com/?a=1&b=2&c=3"},
+		{"sort keeps repeated values in order", SortQueryKeys, "http://example.com/?b=2&a=9&b=1", "http://example.com/?a=9&b=2&b=1"},
+
+		{"lowercase path", LowercasePath(), "http://example.com/Docs/README.TXT?Q=A", "http://example.com/docs/readme.txt?Q=A"},
+		{"lowercase path on host", LowercasePath("iis.example.com"), "http://iis.example.com/Docs", "http://iis.example.com/docs"},
+		{"lowercase path on other host", LowercasePath("iis.example.com"), "http://example.com/Docs", "http://example.com/Docs"},
+
+		{"punycode", PunycodeHost, "http://www.münchen.de/straße", "http://www.xn--mnchen-3ya.de/stra%C3%9Fe"},
+		{"punycode ascii", PunycodeHost, "http://my_host.example.com/", "http://my_host.example.com/"},
+		{"punycode uppercase", PunycodeHost, "http://BÜCHER.example/", "http://xn--bcher-kva.example/"},
+		{"punycode decomposed", PunycodeHost, "http://bu\u0308cher.example/", "http://xn--bcher-kva.example/"},
+		{"punycode fullwidth", PunycodeHost, "http://ｂüｃｈｅｒ.example/", "http://xn--bcher-kva.example/"},
+		{"punycode port", PunycodeHost, "http://www.münchen.de:8080/", "http://www.xn--mnchen-3ya.de:8080/"},
+		{"punycode nontransitional", PunycodeHost, "http://straße.de/", "http://xn--strae-oqa.de/"},
+		{"punycode every label", PunycodeHost, "http://例え.テスト/", "http://xn--r8jz45g.xn--zckzah/"},
+		{"chain in order", NormalizerChain{StripTrackingParams, SortQueryKeys}, "http://example.com/?z=1&utm_id=2&a=3", "http://example.com/?a=3&z=1"},
+	}
+
+	for _, tt := range tt {
+		u, err := url.Parse(tt.link)
+		check(t, err == nil, "%s: bad test URL, %v", tt.name, err)
+		original := u.String()
+
+		got, err := tt.normalizer.Normalize(u)
+		check(t, err == nil, "%s: unexpected error, %v", tt.name, err)
+		check(t, got.String() == tt.want, "%s: want %q, got %q", tt.name, tt.want, got.String())
+		check(t, u.String() == original, "%s: normalizer changed its input to %q", tt.name, u.String())
+	}
+}
+
+func TestCleanFromURLStringRejectsBadLinks(t *testing.T) {
+	base := must(url.Parse("http://example.com/a/"))
+	for _, link := range []string{"http://[::1", "%zz", "http://exa mple.com/"} {
+		u, err := cleanFromURLString(base, link, nil)
+		check(t, err != nil, "%q: want an error, got %v", link, u)
+	}
+}
+
+func TestPunycodeHostRejectsBadHosts(t *testing.T) {
+	for _, link := range []string{
+		"http://a⒈b.example/",                             // disallowed
+		"http://aא.example/",                              // left to right and right to left
+		"http://-ü.example/",                              // leading hyphen
+		"http://" + strings.Repeat("ü", 64) + ".example/", // too long
+	} {
+		u, err := PunycodeHost.Normalize(must(url.Parse(link)))
+		check(t, err != nil, "%q: want an error, got %v", link, u)
+	}
+}
@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+)
+
+// Observer is told about the progress of a crawl, as it happens. Its
+// methods are called by the goroutine running the crawl, which waits for
+// them to return.
+type Observer interface {
+	// Enqueued is called when a link is queued to be crawled, or to be
+	// checked if it's external.
+	Enqueued(link *url.URL, external bool)
+	// FetchStarted is called before a link is requested.
+	FetchStarted(link *url.URL, external bool)
+	// FetchDone is called once a link was requested, whether it worked
+	// or not.
+	FetchDone(fetch Fetch)
+	// LinkDiscovered is called for every link found in a resource that
+	// is kept in the graph. isNew is set the first time the link is seen.
+	LinkDiscovered(from, to *url.URL, isNew bool)
+	// LinkRejected is called for every link found in a resource that is
+	// not crawled, with the reason why.
+	LinkRejected(from, to *url.URL, reason string)
+	// Error is called for the errors that aren't about a fetch, like
+	// robots.txt or sitemaps that can't be used.
+	Error(link *url.URL, err error)
+	// CrawlFinished is called once the crawl is over.
+	CrawlFinished(g ResourceGraph, elapsed time.Duration)
+}
+
+// Fetch describes the outcome of requesting a link.
+type Fetch struct {
+	URL *url.URL
+	// Status is -1 when there was no response.
+	Status  int
+	Elapsed time.Duration
+	// Err tells why there was no response, or why the link wasn't
+	// requested.
+	Err error
+	// External is set for the checks of external links.
+	External bool
+	// NoFollow is set when the resource asked not to follow its links.
+	NoFollow bool
+	// Truncated is set when the resource was too large to be read
+	// entirely.
+	Truncated bool
+	// Bytes is how much of the body was read, nothing for the resources
+	// that aren't parsed.
+	Bytes int64
+	// Revalidated is set when the resource didn't change since the
+	// previous crawl, and wasn't downloaded again.
+	Revalidated bool
+}
+
+// NopObserver ignores everything. Embed it to only implement some of the
+// methods of Observer.
+type NopObserver struct{}
+
+func (NopObserver) Enqueued(*url.URL, bool)                    {}
+func (NopObserver) FetchStarted(*url.URL, bool)                {}
+func (NopObserver) FetchDone(Fetch)                            {}
+func (NopObserver) LinkDiscovered(_, _ *url.URL, _ bool)       {}
+func (NopObserver) LinkRejected(_, _ *url.URL, _ string)       {}
+func (NopObserver) Error(*url.URL, error)                      {}
+func (NopObserver) CrawlFinished(ResourceGraph, time.Duration) {}
+
+// ObserverList tells every observer of the list about the crawl, in
+// order.
+type ObserverList []Observer
+
+func (list ObserverList) Enqueued(link *url.URL, external bool) {
+	for _, o := range list {
+		o.Enqueued(link, external)
+	}
+}
+
+func (list ObserverList) FetchStarted(link *url.URL, external bool) {
+	for _, o := range list {
+		o.FetchStarted(link, external)
+	}
+}
+
+func (list ObserverList) FetchDone(fetch Fetch) {
+	for _, o := range list {
+		o.FetchDone(fetch)
+	}
+}
+
+func (list ObserverList) LinkDiscovered(from, to *url.URL, isNew bool) {
+	for _, o := range list {
+		o.LinkDiscovered(from, to, isNew)
+	}
+}
+
+func (list ObserverList) LinkRejected(from, to *url.URL, reason string) {
+	for _, o := range list {
+		o.LinkRejected(from, to, reason)
+	}
+}
+
+func (list ObserverList) Error(link *url.URL, err error) {
+	for _, o := range list {
+		o.Error(link, err)
+	}
+}
+
+func (list ObserverList) CrawlFinished(g ResourceGraph, elapsed time.Duration) {
+	for _, o := range list {
+		o.CrawlFinished(g, elapsed)
+	}
+}
+
+// logObserver writes the progress of a crawl to a logger, one entry per
+// resource crawled.
+type logObserver struct {
+	logger    Logger
+	fringe    int
+	externals int
+	// header entries are written once
+	rootDone, externalDone bool
+	// the resource being crawled, summed up once its links are known
+	page *pageSummary
+}
+
+type pageSummary struct {
+	link                   string
+	found, isNew, rejected int
+}
+
+// NewLogObserver returns an Observer writing the progress of a crawl to
+// the logger.
+func NewLogObserver(logger Logger) Observer { return &logObserver{logger: logger} }
+
+func (l *logObserver) Enqueued(_ *url.URL, external bool) {
+	if external {
+		l.externals++
+	} else {
+		l.fringe++
+	}
+}
+
+func (l *logObserver) FetchStarted(link *url.URL, external bool) {
+	l.flush()
+	if external {
+		l.externalHeader()
+		return
+	}
+	if !l.rootDone {
+		l.logger.Log(LevelInfo, "crawl started", "roots", l.fringe)
+		l.rootDone = true
+	}
+	l.fringe--
+}
+
+func (l *logObserver) FetchDone(f Fetch) {
+	link := f.URL.String()
+	if f.External {
+		l.externalHeader()
+		l.externals--
+		level := LevelInfo
+		if f.Err != nil || f.Status >= 400 {
+			level = LevelWarn
+		}
+		l.logger.Log(level, "external link checked", "url", link, "status", f.Status, "left", l.externals, "err", f.Err)
+		return
+	}
+
+	switch {
+	case f.Err != nil:
+		l.logger.Log(LevelError, "fetch failed", "url", link, "err", f.Err)
+	case f.Status >= 400:
+		l.logger.Log(LevelWarn, "bad status", "url", link, "status", f.Status)
+	default:
+		l.page = &pageSummary{link: link}
+	}
+	if f.NoFollow {
+		l.logger.Log(LevelDebug, "nofollow", "url", link)
+	}
+	if f.Truncated {
+		l.logger.Log(LevelWarn, "truncated", "url", link)
+	}
+}
+
+func (l *logObserver) LinkDiscovered(_, _ *url.URL, isNew bool) {
+	if l.page == nil {
+		return
+	}
+	l.page.found++
+	if isNew {
+		l.page.isNew++
+	}
+}
+
+func (l *logObserver) LinkRejected(from, to *url.URL, reason string) {
+	l.logger.Log(LevelDebug, "link rejected", "url", to, "from", from, "reason", reason)
+	if l.page == nil {
+		return
+	}
+	l.page.found++
+	l.page.rejected++
+}
+
+func (l *logObserver) Error(link *url.URL, err error) {
+	l.logger.Log(LevelWarn, "error", "url", link, "err", err)
+}
+
+func (l *logObserver) CrawlFinished(g ResourceGraph, elapsed time.Duration) {
+	l.flush()
+	l.logger.Log(LevelInfo, "crawl done", "resources", g.ResourceCount(), "links", g.LinkCount(), "elapsed", elapsed)
+}
+
+func (l *logObserver) flush() {
+	if l.page == nil {
+		return
+	}
+	l.logger.Log(LevelInfo, "crawled", "url", l.page.link, "fringe", l.fringe, "found", l.page.found, "new", l.page.isNew, "rejected", l.page.rejected)
+	l.page = nil
+}
+
+func (l *logObserver) externalHeader() {
+	if !l.externalDone {
+		l.logger.Log(LevelInfo, "checking external links", "count", l.externals)
+		l.externalDone = true
+	}
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder writes down the events of a crawl, paths only.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Enqueued(link *url.URL, external bool) {
+	r.add("enqueued %s external=%v", link.Path, external)
+}
+func (r *recorder) FetchStarted(link *url.URL, external bool) {
+	r.add("started %s", link.Path)
+}
+func (r *recorder) FetchDone(f Fetch) {
+	r.add("done %s status=%d err=%v", f.URL.Path, f.Status, f.Err != nil)
+}
+func (r *recorder) LinkDiscovered(from, to *url.URL, isNew bool) {
+	r.add("discovered %s -> %s new=%v", from.Path, to.Path, isNew)
+}
+func (r *recorder) LinkRejected(from, to *url.URL, reason string) {
+	r.add("rejected %s -> %s: %s", from.Path, to.Path, reason)
+}
+func (r *recorder) Error(link *url.URL, err error) { r.add("error %v", err) }
+func (r *recorder) CrawlFinished(g ResourceGraph, _ time.Duration) {
+	r.add("finished %d", g.ResourceCount())
+}
+
+func (r *recorder) add(format string, args ...interface{}) {
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func TestObserverSeesTheCrawl(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a"></a><a href="/private"></a>`,
+		"/a": `<a href="/"></a><a href="/missing"></a>`,
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+		htmlPages(pages)(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		rec := &recorder{}
+		opts := DefaultOptions()
+		opts.Observer = rec
+
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		want := []string{
+			"enqueued  external=false",
+			"started ",
+			"done  status=200 err=false",
+			"enqueued /a external=false",
+			"discovered  -> /a new=true",
+			`rejected  -> /private: robots.txt: blocked by line 2 "Disallow: /private", in group for *`,
+			"started /a",
+			"done /a status=200 err=false",
+			"discovered /a ->  new=false",
+			"enqueued /missing external=false",
+			"discovered /a -> /missing new=true",
+			"started /missing",
+			"done /missing status=404 err=false",
+			"finished 3",
+		}
+		check(t, reflect.DeepEqual(rec.events, want), "want events\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(rec.events, "\n"))
+	})
+}
+
+func TestLogObserver(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogfmtLogger(&buf, LevelInfo).(*writerLogger)
+	logger.now = func() time.Time { return time.Date(2014, 5, 11, 2, 28, 4, 0, time.UTC) }
+
+	root := must(url.Parse("http://example.com/"))
+	a := must(url.Parse("http://example.com/a"))
+	other := must(url.Parse("http://other.com/"))
+
+	o := NewLogObserver(logger)
+	o.Enqueued(root, false)
+	o.FetchStarted(root, false)
+	o.FetchDone(Fetch{URL: root, Status: 200})
+	o.Enqueued(a, false)
+	o.LinkDiscovered(root, a, true)
+	o.LinkRejected(root, a, "scope")
+	o.Enqueued(other, true)
+	o.LinkDiscovered(root, other, true)
+	o.FetchStarted(a, false)
+	o.FetchDone(Fetch{URL: a, Status: 404})
+	o.FetchStarted(other, true)
+	o.FetchDone(Fetch{URL: other, Status: 200, External: true})
+	o.CrawlFinished(newDigraph(), time.Second)
+
+	want := strings.Join([]string{
+		`time=2014-05-11T02:28:04Z level=info msg="crawl started" roots=1`,
+		`time=2014-05-11T02:28:04Z level=info msg=crawled url=http://example.com/ fringe=1 found=3 new=2 rejected=1`,
+		`time=2014-05-11T02:28:04Z level=warn msg="bad status" url=http://example.com/a status=404`,
+		`time=2014-05-11T02:28:04Z level=info msg="checking external links" count=1`,
+		`time=2014-05-11T02:28:04Z level=info msg="external link checked" url=http://other.com/ status=200 left=0 err=""`,
+		`time=2014-05-11T02:28:04Z level=info msg="crawl done" resources=0 links=0 elapsed=1s`,
+	}, "\n") + "\n"
+	check(t, buf.String() == want, "want log\n%s\ngot\n%s", want, buf.String())
+}
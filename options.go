@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"net/http"
+	"time"
+)
+
+// Options tune the behavior of a Crawler. The zero value ignores every
+// optional politeness rule, start from DefaultOptions instead.
+type Options struct {
+	// MetaRobots honors the noindex and nofollow directives of the
+	// <meta name="robots"> tags, and of the meta tags named after the
+	// crawler's agent.
+	MetaRobots bool
+	// RobotsHeader honors the noindex and nofollow directives of the
+	// X-Robots-Tag response header.
+	RobotsHeader bool
+	// RelNoFollow doesn't follow the links marked rel="nofollow".
+	RelNoFollow bool
+
+	// RobotsFailure is what to do when robots.txt can't be retrieved
+	// because the server errors or can't be reached. A missing
+	// robots.txt (4xx) always allows everything.
+	RobotsFailure RobotsFailure
+	// RobotsRetries is how many more times robots.txt is requested
+	// before giving up, with RobotsRetry.
+	RobotsRetries int
+	// RobotsRetryWait is the time between retries.
+	RobotsRetryWait time.Duration
+	// RobotsMaxSize is how much of robots.txt is read, the rest is
+	// ignored. Zero reads it all.
+	RobotsMaxSize int64
+	// RobotsTTL is how long robots.txt is trusted before it's fetched
+	// again. Zero never fetches it again.
+	RobotsTTL time.Duration
+
+	// Scope decides which URLs are crawled, only the host of the
+	// crawled domain if nil.
+	Scope *Scope
+
+	// CheckExternal adds the links to other web sites to the graph, and
+	// checks that they work, without crawling them.
+	CheckExternal bool
+	// ExternalDelay is the minimum time between two requests to an
+	// external host. Longer crawl-delays in robots.txt are obeyed.
+	ExternalDelay time.Duration
+
+	// HeadLeaves only asks for the headers of the resources that never
+	// link further, like images, videos and scripts, instead of
+	// downloading them. They're known by the tag linking to them or by
+	// their extension.
+	HeadLeaves bool
+	// MaxBodySize is how much of a response body is read, the rest is
+	// ignored and the resource is marked as truncated. Zero reads it
+	// all.
+	MaxBodySize int64
+
+	// TextLinks looks for the absolute URLs written out in plain text
+	// documents, JSONLinks for the string values of JSON documents that
+	// are URLs, and ScriptLinks for the string literals of scripts that
+	// are links to their own origin; scripts aren't leaves then. Links
+	// found this way are only guesses, they're listed as Guessed by the
+	// resource linking to them.
+	TextLinks   bool
+	JSONLinks   bool
+	ScriptLinks bool
+
+	// Mirror is the directory where the body of every resource that
+	// answers 2xx is saved, in a tree following their URLs, nothing is
+	// saved if empty. Leaves are downloaded rather than probed when
+	// mirroring, for them to be saved too.
+	Mirror string
+	// MirrorRewrite rewrites the links of the HTML and CSS saved in the
+	// mirror to relative paths to the local copies, once the crawl is
+	// done, for the mirror to be browsed offline.
+	MirrorRewrite bool
+
+	// Previous is an earlier crawl of the site. The resources it saw
+	// served with an ETag or a Last-Modified date are only downloaded
+	// again if they changed, otherwise what it knows of them is kept,
+	// their links included. Every resource is downloaded if nil.
+	Previous ResourceGraph
+
+	// Traps cap the URL spaces that never end, like calendars.
+	Traps TrapLimits
+
+	// Normalizer rewrites the links found to the form the crawler knows
+	// them by, DefaultNormalizer if nil.
+	Normalizer Normalizer
+
+	// Observer is told about the progress of the crawl, a log observer
+	// writing to Logger if nil.
+	Observer Observer
+	// Logger is where the progress of the crawl is written, and the
+	// problems met along the way. Nothing is written if nil.
+	Logger Logger
+
+	// Client does the HTTP requests. If nil, a client is made with the
+	// Transport options.
+	Client *http.Client
+	// Transport tunes the connections of the client made when Client is
+	// nil: timeouts, proxy and TLS.
+	Transport TransportOptions
+	// Auth authenticates the requests of the client, and logs in before
+	// crawling, which is then done without ever following the links
+	// that look like they'd log out. The crawl is anonymous if nil.
+	Auth *Auth
+}
+
+// DefaultOptions are the options used by NewCrawler.
+func DefaultOptions() Options {
+	return Options{
+		MetaRobots:   true,
+		RobotsHeader: true,
+		RelNoFollow:  false,
+
+		RobotsFailure:   RobotsDisallowAll,
+		RobotsRetries:   3,
+		RobotsRetryWait: time.Second,
+		RobotsMaxSize:   500 << 10, // 500KiB, the minimum RFC 9309 asks for
+		RobotsTTL:       24 * time.Hour,
+
+		CheckExternal: false,
+		ExternalDelay: time.Second,
+
+		HeadLeaves:  true,
+		MaxBodySize: 10 << 20, // 10MiB
+
+		TextLinks:   true,
+		JSONLinks:   false,
+		ScriptLinks: false,
+
+		Traps: DefaultTrapLimits(),
+
+		Transport: DefaultTransportOptions(),
+	}
+}
+
+// loggerOf is the logger of the options, NopLogger if they have none.
+func loggerOf(opts Options) Logger {
+	if opts.Logger == nil {
+		return NopLogger
+	}
+	return opts.Logger
+}
+
+// clientOf is the client of the options, one made with their transport
+// options if they have none.
+func clientOf(opts Options) (*http.Client, error) {
+	if opts.Client == nil {
+		return NewClient(opts.Transport)
+	}
+	return opts.Client, nil
+}
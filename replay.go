@@ -0,0 +1,337 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Replay is an http.RoundTripper answering requests with the responses
+// recorded in WARC files or HTTP archives (HAR), without ever going to
+// the network. Given as the transport of the crawler's client, the crawl
+// is rebuilt offline, the same every time.
+//
+// A URL recorded many times is answered with its responses in the order
+// they were recorded, the last one repeating. HEAD requests are answered
+// with the headers of a GET when there's no HEAD recorded. URLs that
+// weren't recorded are answered 404, as if the site had nothing there.
+type Replay struct {
+	lock      sync.Mutex
+	responses map[string][]*recordedResponse
+}
+
+// recordedResponse is a response as it was received, its body included.
+type recordedResponse struct {
+	status string
+	code   int
+	proto  string
+	header http.Header
+	body   []byte
+}
+
+// NewReplay returns a Replay with nothing recorded, read WARC files or
+// HTTP archives into it.
+func NewReplay() *Replay {
+	return &Replay{responses: make(map[string][]*recordedResponse)}
+}
+
+// replayKey is how requests are told apart: the same URLs written with or
+// without a path are the same.
+func replayKey(method string, u *url.URL) string {
+	if u.Path == "" || u.Fragment != "" {
+		u = copyURL(u)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.Fragment = ""
+	}
+	return method + " " + u.String()
+}
+
+func (r *Replay) add(method string, u *url.URL, resp *recordedResponse) {
+	key := replayKey(method, u)
+	r.responses[key] = append(r.responses[key], resp)
+}
+
+// next returns the response recorded for a request, and moves on to the
+// next one.
+func (r *Replay) next(method string, u *url.URL) (*recordedResponse, bool) {
+	key := replayKey(method, u)
+	recorded := r.responses[key]
+	if len(recorded) == 0 {
+		return nil, false
+	}
+	if len(recorded) > 1 {
+		r.responses[key] = recorded[1:]
+	}
+	return recorded[0], true
+}
+
+func (r *Replay) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	rec, ok := r.next(req.Method, req.URL)
+	if !ok && req.Method == "HEAD" {
+		rec, ok = r.next("GET", req.URL)
+	}
+	if !ok {
+		rec = &recordedResponse{
+			status: "404 Not Found",
+			code:   http.StatusNotFound,
+			proto:  "HTTP/1.1",
+			header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			body:   []byte("not recorded\n"),
+		}
+	}
+
+	resp := &http.Response{
+		Status:        rec.status,
+		StatusCode:    rec.code,
+		Proto:         rec.proto,
+		Header:        make(http.Header),
+		ContentLength: int64(len(rec.body)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(rec.proto)
+	for k, v := range rec.header {
+		resp.Header[k] = append([]string{}, v...)
+	}
+	if req.Method == "HEAD" {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	} else {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(rec.body))
+	}
+	// recorded as it was sent, gzipped or not
+	decodeResponse(req, resp)
+	return resp, nil
+}
+
+// ReadWARC reads the responses of a WARC file, gzipped or not.
+func (r *Replay) ReadWARC(in io.Reader) error {
+	br := bufio.NewReader(in)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// the records gzipped one by one read as one stream
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	// requests tell the method of the responses they're concurrent to
+	methods := make(map[string]string)
+	type response struct {
+		id, concurrentTo, target string
+		block                    []byte
+	}
+	var responses []response
+
+	for {
+		header, block, err := readWARCRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Get("WARC-Type") {
+		case "request":
+			method := "GET"
+			if line, err := bufio.NewReader(bytes.NewReader(block)).ReadString(' '); err == nil {
+				method = strings.TrimSpace(line)
+			}
+			methods[header.Get("WARC-Record-ID")] = method
+			methods[header.Get("WARC-Concurrent-To")] = method
+		case "response":
+			if !strings.HasPrefix(header.Get("Content-Type"), "application/http") {
+				continue
+			}
+			responses = append(responses, response{
+				id:           header.Get("WARC-Record-ID"),
+				concurrentTo: header.Get("WARC-Concurrent-To"),
+				target:       strings.Trim(header.Get("WARC-Target-URI"), "<>"),
+				block:        block,
+			})
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, resp := range responses {
+		method := methods[resp.id]
+		if method == "" {
+			method = methods[resp.concurrentTo]
+		}
+		if method == "" {
+			method = "GET"
+		}
+		u, err := url.Parse(resp.target)
+		if err != nil {
+			return err
+		}
+		rec, err := parseRecordedResponse(resp.block, method)
+		if err != nil {
+			return fmt.Errorf("response record of %q, %v", resp.target, err)
+		}
+		r.add(method, u, rec)
+	}
+	return nil
+}
+
+// readWARCRecord reads the header and the block of the next record.
+func readWARCRecord(br *bufio.Reader) (textproto.MIMEHeader, []byte, error) {
+	// records are separated by blank lines
+	var version string
+	for version == "" {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, nil, io.EOF
+			}
+			return nil, nil, err
+		}
+		version = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, nil, fmt.Errorf("not a WARC record: %q", version)
+	}
+
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad Content-Length, %v", err)
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(br, block); err != nil {
+		return nil, nil, err
+	}
+	return header, block, nil
+}
+
+// parseRecordedResponse reads the HTTP response of a WARC response
+// record. Bodies cut when they were recorded are kept as they are.
+func parseRecordedResponse(block []byte, method string) (*recordedResponse, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), &http.Request{Method: method})
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	// the body is given back whole, however it was sent
+	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Del("Content-Length")
+	return &recordedResponse{
+		status: resp.Status,
+		code:   resp.StatusCode,
+		proto:  resp.Proto,
+		header: resp.Header,
+		body:   body,
+	}, nil
+}
+
+// harFile is the part of an HTTP archive that's replayed.
+//
+// see https://w3c.github.io/web-performance/specs/HAR/Overview.html
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status      int    `json:"status"`
+				StatusText  string `json:"statusText"`
+				HTTPVersion string `json:"httpVersion"`
+				Headers     []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+				RedirectURL string `json:"redirectURL"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ReadHAR reads the responses of an HTTP archive, like those saved by
+// browsers.
+func (r *Replay) ReadHAR(in io.Reader) error {
+	var har harFile
+	if err := json.NewDecoder(in).Decode(&har); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, entry := range har.Log.Entries {
+		resp := entry.Response
+		rec := &recordedResponse{
+			code:   resp.Status,
+			status: strings.TrimSpace(fmt.Sprintf("%d %s", resp.Status, resp.StatusText)),
+			proto:  resp.HTTPVersion,
+			header: make(http.Header),
+			body:   []byte(resp.Content.Text),
+		}
+		if _, _, ok := http.ParseHTTPVersion(rec.proto); !ok {
+			rec.proto = "HTTP/1.1"
+		}
+		if resp.Content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(resp.Content.Text)
+			if err != nil {
+				return fmt.Errorf("content of %q, %v", entry.Request.URL, err)
+			}
+			rec.body = body
+		}
+		for _, h := range resp.Headers {
+			rec.header.Add(h.Name, h.Value)
+		}
+		// browsers record what they decoded
+		rec.header.Del("Content-Encoding")
+		rec.header.Del("Content-Length")
+		rec.header.Del("Transfer-Encoding")
+		if rec.header.Get("Content-Type") == "" && resp.Content.MimeType != "" {
+			rec.header.Set("Content-Type", resp.Content.MimeType)
+		}
+		if rec.header.Get("Location") == "" && resp.RedirectURL != "" {
+			rec.header.Set("Location", resp.RedirectURL)
+		}
+
+		method := entry.Request.Method
+		if method == "" {
+			method = "GET"
+		}
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return err
+		}
+		r.add(method, u, rec)
+	}
+	return nil
+}
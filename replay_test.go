@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// graphSummary describes every resource of a graph, and the links it
+// refers to, in order.
+func graphSummary(g ResourceGraph) []string {
+	var summary []string
+	g.Walk(func(link string, status int, refersTo, _ []string) bool {
+		refersTo = append([]string{}, refersTo...)
+		sort.Strings(refersTo)
+		summary = append(summary, fmt.Sprintf("%s %d %v", link, status, refersTo))
+		return true
+	})
+	g.WalkRejected(func(link, reason string, _ []string) bool {
+		summary = append(summary, fmt.Sprintf("%s rejected: %s", link, reason))
+		return true
+	})
+	sort.Strings(summary)
+	return summary
+}
+
+func TestReplayRebuildsTheCrawl(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/old":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			htmlPages(map[string]string{
+				"/":  `<a href="/old"></a><a href="/private"></a><img src="/logo.png">`,
+				"/a": `<a href="/"></a><a href="/missing"></a>`,
+			})(w, r)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "replay")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	var domain *url.URL
+	var live ResourceGraph
+	withHandler(t, http.HandlerFunc(handler), func(d *url.URL) {
+		domain = d
+		w, err := NewWARCWriter(dir, "live", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		opts := DefaultOptions()
+		opts.Client = &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		live, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+		check(t, w.Close() == nil, "couldn't close the writer")
+	})
+
+	// the server is gone, the crawl is rebuilt from the archive
+	replay := NewReplay()
+	for _, filename := range warcFiles(t, dir) {
+		f, err := os.Open(filename)
+		check(t, err == nil, "couldn't open %q, %v", filename, err)
+		err = replay.ReadWARC(f)
+		f.Close()
+		check(t, err == nil, "couldn't read %q, %v", filename, err)
+	}
+
+	opts := DefaultOptions()
+	opts.Client = &http.Client{Transport: replay}
+	c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+	check(t, err == nil, "couldn't create crawler, %v", err)
+	replayed, err := c.Crawl()
+	check(t, err == nil, "couldn't crawl, %v", err)
+
+	want, got := graphSummary(live), graphSummary(replayed)
+	check(t, reflect.DeepEqual(want, got), "want the graph\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	check(t, replayed.ResourceCount() == 4, "want 4 resources, got %d", replayed.ResourceCount())
+}
+
+func TestReplayHAR(t *testing.T) {
+	f, err := os.Open("testdata/replay/example.har")
+	check(t, err == nil, "couldn't open the archive, %v", err)
+	defer f.Close()
+
+	replay := NewReplay()
+	err = replay.ReadHAR(f)
+	check(t, err == nil, "couldn't read the archive, %v", err)
+
+	opts := DefaultOptions()
+	opts.Client = &http.Client{Transport: replay}
+	c, err := NewCrawlerWithOptions(must(url.Parse("http://example.com")), testAgent, opts)
+	check(t, err == nil, "couldn't create crawler, %v", err)
+	g, err := c.Crawl()
+	check(t, err == nil, "couldn't crawl, %v", err)
+
+	want := []string{
+		"http://example.com 200 [http://example.com/logo.png http://example.com/old]",
+		"http://example.com/logo.png 200 []",
+		"http://example.com/missing 404 []",
+		"http://example.com/old 200 [http://example.com/missing]",
+		`http://example.com/private rejected: robots.txt: blocked by line 2 "Disallow: /private", in group for *`,
+	}
+	got := graphSummary(g)
+	check(t, reflect.DeepEqual(want, got), "want the graph\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+}
+
+func TestReplayAnswers(t *testing.T) {
+	f, err := os.Open("testdata/replay/example.har")
+	check(t, err == nil, "couldn't open the archive, %v", err)
+	defer f.Close()
+	replay := NewReplay()
+	check(t, replay.ReadHAR(f) == nil, "couldn't read the archive")
+	client := &http.Client{Transport: replay}
+
+	tests := []struct {
+		method, url string
+		status      int
+		body        string
+	}{
+		{"GET", "http://example.com", 200, `<a href="/old">old</a><a href="/private">private</a><img src="/logo.png">`},
+		{"HEAD", "http://example.com/logo.png", 200, ""},
+		{"GET", "http://example.com/logo.png", 200, "\x89PNG\r\n\x1a\n"},
+		{"GET", "http://example.com/old", 200, `<a href="/missing">missing</a>`},
+		{"GET", "http://example.com/nope", 404, "not recorded\n"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		resp, err := client.Do(req)
+		check(t, err == nil, "%s %s: couldn't replay, %v", tt.method, tt.url, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		check(t, resp.StatusCode == tt.status, "%s %s: want status %d, got %d", tt.method, tt.url, tt.status, resp.StatusCode)
+		check(t, string(body) == tt.body, "%s %s: want body %q, got %q", tt.method, tt.url, tt.body, body)
+	}
+}
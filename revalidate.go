@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// previousCrawl is what a previous crawl of the site knows, to only
+// download again the resources that changed since.
+type previousCrawl struct {
+	graph ResourceGraph
+	// links rejected in the previous crawl, by the resource linking to
+	// them
+	rejected map[string][]string
+}
+
+func newPreviousCrawl(g ResourceGraph) *previousCrawl {
+	p := &previousCrawl{graph: g, rejected: make(map[string][]string)}
+	g.WalkRejected(func(link, _ string, referedBy []string) bool {
+		for _, from := range referedBy {
+			p.rejected[from] = append(p.rejected[from], link)
+		}
+		return true
+	})
+	return p
+}
+
+// validated returns what the previous crawl knows of a resource, if it
+// can be asked for again only if it changed: it was served with
+// validators, and downloaded successfully.
+func (p *previousCrawl) validated(link *url.URL) (ResourceInfo, bool) {
+	if p == nil {
+		return ResourceInfo{}, false
+	}
+	info, ok := p.graph.Info(link.String())
+	if !ok || info.External || info.Status/100 != 2 {
+		return ResourceInfo{}, false
+	}
+	return info, info.ETag != "" || info.LastModified != ""
+}
+
+// setConditional asks for the resource only if it changed since it was
+// served with the validators of info.
+func setConditional(req *http.Request, info ResourceInfo) {
+	if info.ETag != "" {
+		req.Header.Set("If-None-Match", info.ETag)
+	}
+	if info.LastModified != "" {
+		req.Header.Set("If-Modified-Since", info.LastModified)
+	}
+}
+
+// revalidated is what's known of a resource that didn't change: the same
+// as in the previous crawl. The links it had are followed again, as
+// they were written the first time they were seen.
+func (p *previousCrawl) revalidated(info ResourceInfo, resp *http.Response) *fetchResult {
+	res := &fetchResult{
+		status:       info.Status,
+		revalidated:  true,
+		truncated:    info.Truncated,
+		contentHash:  info.ContentHash,
+		simhash:      info.SimHash,
+		encoding:     info.Encoding,
+		etag:         info.ETag,
+		lastModified: info.LastModified,
+	}
+	// a 304 can update the validators
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		res.etag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		res.lastModified = lastModified
+	}
+	res.robots.noIndex = info.NoIndex
+	if info.Canonical != "" {
+		res.canonical, _ = url.Parse(info.Canonical)
+	}
+
+	guessed, leaves := make(map[string]bool), make(map[string]bool)
+	for _, link := range info.Guessed {
+		guessed[link] = true
+	}
+	for _, link := range info.Leaves {
+		leaves[link] = true
+	}
+	for _, link := range append(info.RefersTo, p.rejected[info.URL]...) {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		raw := link
+		if to, ok := p.graph.Info(link); ok && len(to.Hrefs) > 0 {
+			raw = to.Hrefs[0]
+		}
+		res.followers = append(res.followers, linkRef{url: u, raw: raw, leaf: leaves[link], guessed: guessed[link]})
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// validatedSite serves pages with an ETag or a Last-Modified date, and
+// counts the pages it sent whole.
+type validatedSite struct {
+	pages      map[string]string
+	etags      map[string]string
+	modified   map[string]string
+	downloaded []string
+}
+
+func (s *validatedSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.pages[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if etag, ok := s.etags[r.URL.Path]; ok {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if modified, ok := s.modified[r.URL.Path]; ok {
+		w.Header().Set("Last-Modified", modified)
+		if r.Header.Get("If-Modified-Since") == modified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	s.downloaded = append(s.downloaded, r.URL.Path)
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, page)
+}
+
+func TestCrawlRevalidates(t *testing.T) {
+	site := &validatedSite{
+		pages: map[string]string{
+			"/":  `<link rel=canonical href="/"><a href="/a"></a><a href="./b"></a><a href="/private"></a><img src="/logo">`,
+			"/a": `<meta name=robots content=noindex><a href="/c"></a>`,
+			"/b": `<a href="/"></a>`,
+			"/c": `<p>no validators</p>`,
+		},
+		etags:    map[string]string{"/": `"v1"`, "/a": `"v1"`},
+		modified: map[string]string{"/b": "Sun, 11 May 2014 02:28:04 GMT"},
+	}
+	logo := make(map[string]int)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		case "/logo":
+			// a leaf by its element only
+			logo[r.Method]++
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		site.ServeHTTP(w, r)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		crawl := func(previous ResourceGraph) ResourceGraph {
+			opts := DefaultOptions()
+			opts.Previous = previous
+			c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+			check(t, err == nil, "couldn't create crawler, %v", err)
+			g, err := c.Crawl()
+			check(t, err == nil, "couldn't crawl, %v", err)
+			return g
+		}
+
+		full := crawl(nil)
+		check(t, len(site.downloaded) == 4, "want every page downloaded, got %v", site.downloaded)
+
+		// the previous crawl is read back from its site map
+		data, err := json.Marshal(full)
+		check(t, err == nil, "couldn't marshal the graph, %v", err)
+		previous, err := ReadGraph(bytes.NewReader(data))
+		check(t, err == nil, "couldn't read the graph back, %v", err)
+
+		// /b changes
+		site.pages["/b"] = `<a href="/"></a><a href="/d"></a>`
+		site.modified["/b"] = "Mon, 12 May 2014 02:28:04 GMT"
+		site.pages["/d"] = `<p>new</p>`
+		site.downloaded = nil
+		logo = make(map[string]int)
+
+		again := crawl(previous)
+		sort.Strings(site.downloaded)
+		want := []string{"/b", "/c", "/d"}
+		check(t, reflect.DeepEqual(site.downloaded, want), "want downloaded again %v, got %v", want, site.downloaded)
+		check(t, logo["HEAD"] == 1 && logo["GET"] == 0, "want the image of the revalidated page only probed, got %v", logo)
+
+		var revalidated []string
+		again.Walk(func(link string, _ int, _, _ []string) bool {
+			if info, _ := again.Info(link); info.Revalidated {
+				revalidated = append(revalidated, must(url.Parse(link)).Path)
+			}
+			return true
+		})
+		sort.Strings(revalidated)
+		want = []string{"", "/a"}
+		check(t, reflect.DeepEqual(revalidated, want), "want revalidated %q, got %q", want, revalidated)
+
+		// what the previous crawl knew is kept
+		root, _ := again.Info(domain.String())
+		check(t, root.ETag == `"v1"`, "want the etag kept, got %q", root.ETag)
+		check(t, root.Canonical == domain.String(), "want the canonical kept, got %q", root.Canonical)
+		check(t, root.ContentHash != "", "want the fingerprint kept")
+		a, _ := again.Info(domain.String() + "/a")
+		check(t, a.NoIndex, "want noindex kept")
+		b, _ := again.Info(domain.String() + "/b")
+		check(t, b.LastModified == "Mon, 12 May 2014 02:28:04 GMT", "want the new date, got %q", b.LastModified)
+		check(t, !b.Revalidated, "want /b downloaded again")
+
+		// the same graph as a full crawl
+		site.downloaded = nil
+		wantGraph, got := graphSummary(crawl(nil)), graphSummary(again)
+		check(t, reflect.DeepEqual(wantGraph, got), "want the graph\n%s\ngot\n%s", strings.Join(wantGraph, "\n"), strings.Join(got, "\n"))
+	})
+}
+
+func TestReadGraph(t *testing.T) {
+	g := newDigraph()
+	g.AddEdge("http://example.com", "http://example.com/a")
+	g.AddEdge("http://example.com/a", "http://example.com")
+	g.AddHref("http://example.com/a", "./a")
+	g.MarkGuessed("http://example.com/a", "http://example.com")
+	g.MarkLeaf("http://example.com", "http://example.com/a")
+	g.MarkStatus("http://example.com", 200)
+	g.MarkStatus("http://example.com/a", 200)
+	g.MarkFingerprint("http://example.com/a", "abcd", 0xfedcba9876543210)
+	g.MarkValidators("http://example.com/a", `"v1"`, "Sun, 11 May 2014 02:28:04 GMT")
+	g.MarkCanonical("http://example.com/a", "http://example.com/a")
+	g.AddRejected("http://example.com/a", "http://example.com/private", "robots.txt: blocked")
+
+	data, err := json.Marshal(g)
+	check(t, err == nil, "couldn't marshal, %v", err)
+	read, err := ReadGraph(bytes.NewReader(data))
+	check(t, err == nil, "couldn't read, %v", err)
+
+	check(t, read.ResourceCount() == 2, "want 2 resources, got %d", read.ResourceCount())
+	check(t, read.LinkCount() == 2, "want 2 links, got %d", read.LinkCount())
+	for _, link := range []string{"http://example.com", "http://example.com/a"} {
+		want, _ := g.Info(link)
+		got, _ := read.Info(link)
+		check(t, reflect.DeepEqual(want, got), "%s: want\n%#v\ngot\n%#v", link, want, got)
+	}
+	check(t, reflect.DeepEqual(graphSummary(g), graphSummary(read)), "want the same rejected links")
+
+	_, err = ReadGraph(strings.NewReader(`{"resources": [{"url": "a", "simhash": "nothex"}]}`))
+	check(t, err != nil, "want an error for a bad simhash")
+}
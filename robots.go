@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RobotsFailure tells what to do when robots.txt can't be retrieved,
+// because the server errors or can't be reached.
+type RobotsFailure int
+
+const (
+	// RobotsDisallowAll assumes the whole site is off limits.
+	RobotsDisallowAll RobotsFailure = iota
+	// RobotsRetry tries again a few times, and disallows all if it still
+	// can't retrieve robots.txt.
+	RobotsRetry
+)
+
+// robotsMaxRedirects is how many redirects are followed to find robots.txt
+//
+// see https://www.rfc-editor.org/rfc/rfc9309#section-2.3.1.2
+const robotsMaxRedirects = 5
+
+var errRobotsRedirects = errors.New("too many redirects")
+
+// robots holds the robots.txt rules of a host, and fetches them again
+// once they're too old.
+type robots struct {
+	url    *url.URL
+	agent  string
+	client *http.Client
+	opts   Options
+	now    func() time.Time
+	// observer is told when the rules can't be refreshed
+	observer Observer
+
+	data    *robotsRules
+	fetched time.Time
+}
+
+func newRobots(host *url.URL, agent string, client *http.Client, opts Options) (*robots, error) {
+	robotURL, err := host.Parse("/robots.txt")
+	if err != nil {
+		return nil, fmt.Errorf("parsing robots.txt URL, %v", err)
+	}
+
+	// same client, but following only as many redirects as the RFC says
+	robotClient := *client
+	robotClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > robotsMaxRedirects {
+			return errRobotsRedirects
+		}
+		return nil
+	}
+
+	r := &robots{
+		url:      robotURL,
+		agent:    agent,
+		client:   &robotClient,
+		opts:     opts,
+		now:      time.Now,
+		observer: NewLogObserver(loggerOf(opts)),
+	}
+	return r, r.refresh()
+}
+
+// ExplainRobots fetches the robots.txt of the URL's host, and tells
+// which of its rules allow or block the URL.
+func ExplainRobots(u *url.URL, agent string, opts Options) (RobotsVerdict, error) {
+	client, err := clientOf(opts)
+	if err != nil {
+		return RobotsVerdict{}, err
+	}
+	r, err := newRobots(u, agent, client, opts)
+	if err != nil {
+		return RobotsVerdict{}, err
+	}
+	return r.Explain(u), nil
+}
+
+// Test tells if the URL can be crawled.
+func (r *robots) Test(u *url.URL) bool {
+	return r.Explain(u).Allowed
+}
+
+// Explain tells which rule allows or blocks the URL, refreshing the rules
+// first if they're too old. Rules apply to the path and query of the URL.
+func (r *robots) Explain(u *url.URL) RobotsVerdict {
+	if r.opts.RobotsTTL > 0 && r.now().Sub(r.fetched) > r.opts.RobotsTTL {
+		if err := r.refresh(); err != nil {
+			r.observer.Error(r.url, &robotsError{host: r.url.Host, instead: "keeps its previous rules", err: err})
+		}
+	}
+	return r.data.explain(robotsTarget(u), r.agent)
+}
+
+// CrawlDelay is the time robots.txt asks to wait between requests.
+func (r *robots) CrawlDelay() time.Duration {
+	g := r.data.group(r.agent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// Sitemaps are the sitemaps reported by robots.txt.
+func (r *robots) Sitemaps() []string {
+	return r.data.sitemaps
+}
+
+// robotsTarget is the part of a URL that robots.txt rules match.
+func robotsTarget(u *url.URL) string {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" || u.ForceQuery {
+		target += "?" + u.RawQuery
+	}
+	return normalizeRobotsPath(target)
+}
+
+// refresh fetches robots.txt, retrying if the options say so. When it
+// can't be reached, previous rules are kept if there are some.
+func (r *robots) refresh() error {
+	data, err := r.fetch()
+	for try := 0; err == errRobotsUnreachable && r.opts.RobotsFailure == RobotsRetry && try < r.opts.RobotsRetries; try++ {
+		time.Sleep(r.opts.RobotsRetryWait)
+		data, err = r.fetch()
+	}
+	r.fetched = r.now()
+
+	switch {
+	case err == errRobotsUnreachable && r.data != nil:
+		return err
+	case err == errRobotsUnreachable:
+		data = disallowAllRobots("robots.txt is unreachable")
+	case err != nil:
+		return err
+	}
+
+	r.data = data
+	return nil
+}
+
+var errRobotsUnreachable = errors.New("robots.txt is unreachable")
+
+// robotsError tells that the robots.txt of a host couldn't be had, and
+// what's done without it.
+type robotsError struct {
+	host    string
+	instead string
+	err     error
+}
+
+func (e *robotsError) Error() string {
+	return fmt.Sprintf("robots.txt of %q %s, %v", e.host, e.instead, e.err)
+}
+
+// fetch retrieves robots.txt, and interprets failures the way RFC 9309
+// says to: a missing file allows all, an unreachable one is reported as
+// errRobotsUnreachable.
+//
+// see https://www.rfc-editor.org/rfc/rfc9309#section-2.3.1
+func (r *robots) fetch() (data *robotsRules, err error) {
+	req, err := http.NewRequest("GET", r.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", r.agent)
+
+	resp, err := r.client.Do(req)
+	if uerr, ok := err.(*url.Error); ok && uerr.Err == errRobotsRedirects {
+		return allowAllRobots("robots.txt redirects too many times"), nil
+	}
+	if err != nil {
+		return nil, errRobotsUnreachable
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		body, err := readRobots(resp.Body, r.opts.RobotsMaxSize)
+		if err != nil {
+			return nil, errRobotsUnreachable
+		}
+		return parseRobots(body), nil
+	case resp.StatusCode >= 500:
+		return nil, errRobotsUnreachable
+	default:
+		// 4xx, or redirects we were not allowed to follow
+		return allowAllRobots(fmt.Sprintf("robots.txt is unavailable (%d)", resp.StatusCode)), nil
+	}
+}
+
+// readRobots reads up to max bytes of robots.txt. A line cut by the
+// limit is dropped, rather than being read as a different rule.
+func readRobots(body io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(body)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) <= max {
+		return data, nil
+	}
+
+	data = data[:max]
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return data[:i+1], nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,402 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var robotsRulesTT = []struct {
+	name    string
+	robots  string
+	allowed []string
+	blocked []string
+}{
+	{
+		name:    "empty file allows all",
+		robots:  "",
+		allowed: []string{"/", "/a", "/a/b.html"},
+	},
+	{
+		name:    "disallow all",
+		robots:  "User-agent: *\nDisallow: /\n",
+		blocked: []string{"/", "/a", "/a/b.html"},
+	},
+	{
+		name:    "disallow a directory",
+		robots:  "User-agent: *\nDisallow: /private/\n",
+		allowed: []string{"/", "/private", "/public/a.html"},
+		blocked: []string{"/private/", "/private/a.html"},
+	},
+	{
+		name:    "longest allow wins over disallow",
+		robots:  "User-agent: *\nDisallow: /docs/\nAllow: /docs/public/\n",
+		allowed: []string{"/docs/public/a.html", "/other"},
+		blocked: []string{"/docs/", "/docs/private.html"},
+	},
+	{
+		name:    "longest disallow wins over allow",
+		robots:  "User-agent: *\nAllow: /docs/\nDisallow: /docs/drafts/\n",
+		allowed: []string{"/docs/a.html"},
+		blocked: []string{"/docs/drafts/a.html"},
+	},
+	{
+		name:    "wildcard",
+		robots:  "User-agent: *\nDisallow: /*.pdf\n",
+		allowed: []string{"/a.html", "/pdf/a.html"},
+		blocked: []string{"/a.pdf", "/docs/a.pdf", "/a.pdf.html"},
+	},
+	{
+		name:    "wildcard in the middle",
+		robots:  "User-agent: *\nDisallow: /users/*/settings\n",
+		allowed: []string{"/users/", "/users/bob"},
+		blocked: []string{"/users/bob/settings", "/users/bob/settings/email"},
+	},
+	{
+		name:    "end anchor",
+		robots:  "User-agent: *\nDisallow: /*.pdf$\n",
+		allowed: []string{"/a.pdf.html", "/a.html"},
+		blocked: []string{"/a.pdf", "/docs/a.pdf"},
+	},
+	{
+		name:    "end anchor on a path",
+		robots:  "User-agent: *\nDisallow: /$\n",
+		allowed: []string{"/a.html", "/docs/", "/?q=1"},
+		blocked: []string{"/"},
+	},
+	{
+		name:    "patterns match from the start of the path",
+		robots:  "User-agent: *\nDisallow: /private*/\n",
+		allowed: []string{"/public/private/", "/a/private1/"},
+		blocked: []string{"/private/", "/private1/a.html"},
+	},
+	{
+		name:    "query strings are matched",
+		robots:  "User-agent: *\nDisallow: /search?\nDisallow: /*?sessionid=\n",
+		allowed: []string{"/search", "/search/help", "/a?page=2", "/a?id=1&session=2"},
+		blocked: []string{"/search?q=go", "/search?", "/a?sessionid=42", "/a/b?sessionid="},
+	},
+	{
+		name:    "allow wins when as specific",
+		robots:  "User-agent: *\nDisallow: /page\nAllow: /page\n",
+		allowed: []string{"/page", "/page/2"},
+	},
+	{
+		name:    "percent encoding of unreserved characters is ignored",
+		robots:  "User-agent: *\nDisallow: /%7Ebob/\nDisallow: /a-%62\n",
+		allowed: []string{"/bob/"},
+		blocked: []string{"/~bob/", "/%7ebob/index.html", "/a-b", "/a-%62"},
+	},
+	{
+		name:    "percent encoding of reserved characters is kept",
+		robots:  "User-agent: *\nDisallow: /a%2fb\n",
+		allowed: []string{"/a/b"},
+		blocked: []string{"/a%2Fb", "/a%2fb"},
+	},
+	{
+		name:    "non ASCII rules match encoded paths",
+		robots:  "User-agent: *\nDisallow: /café\n",
+		allowed: []string{"/cafe"},
+		blocked: []string{"/caf%C3%A9", "/caf%c3%a9/menu"},
+	},
+	{
+		name:    "robots.txt is always allowed",
+		robots:  "User-agent: *\nDisallow: /\n",
+		allowed: []string{"/robots.txt"},
+		blocked: []string{"/robots.txt.bak"},
+	},
+	{
+		name:    "group for our agent wins over the default group",
+		robots:  "User-agent: *\nDisallow: /\n\nUser-agent: CrawlerUnderTest\nDisallow: /private\n",
+		allowed: []string{"/", "/public"},
+		blocked: []string{"/private"},
+	},
+	{
+		name:    "group for another agent is ignored",
+		robots:  "User-agent: otherbot\nDisallow: /\n",
+		allowed: []string{"/", "/a"},
+	},
+}
+
+func TestRobotsRules(t *testing.T) {
+	for _, tt := range robotsRulesTT {
+		t.Logf("==== robots rules: %s ====", tt.name)
+
+		withRobots(t, robotsFile(tt.robots), func(domain *url.URL) {
+			r, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+			check(t, err == nil, "couldn't get robots.txt, %v", err)
+
+			for _, path := range tt.allowed {
+				check(t, r.Test(must(domain.Parse(path))), "%q should be allowed", path)
+			}
+			for _, path := range tt.blocked {
+				check(t, !r.Test(must(domain.Parse(path))), "%q should be blocked", path)
+			}
+		})
+		t.Log("ok!")
+	}
+}
+
+func TestExplainRobots(t *testing.T) {
+	body := "User-agent: *\nDisallow: /\n\nUser-agent: CrawlerUnderTest\nAllow: /search/help\nDisallow: /search?\n"
+
+	tt := []struct {
+		path string
+		want string
+	}{
+		{path: "/search?q=go", want: `blocked by line 6 "Disallow: /search?", in group for crawlerundertest`},
+		{path: "/search/help?q=go", want: `allowed by line 5 "Allow: /search/help", in group for crawlerundertest`},
+		{path: "/", want: "allowed, no rule matched in group for crawlerundertest"},
+	}
+
+	withRobots(t, robotsFile(body), func(domain *url.URL) {
+		for _, tt := range tt {
+			got, err := ExplainRobots(must(domain.Parse(tt.path)), testAgent, DefaultOptions())
+			check(t, err == nil, "couldn't explain, %v", err)
+			check(t, got.String() == tt.want, "want %q, got %q", tt.want, got.String())
+		}
+	})
+
+	withRobots(t, robotsStatus(http.StatusServiceUnavailable), func(domain *url.URL) {
+		got, err := ExplainRobots(must(domain.Parse("/")), testAgent, DefaultOptions())
+		check(t, err == nil, "couldn't explain, %v", err)
+		want := "blocked, robots.txt is unreachable"
+		check(t, got.String() == want, "want %q, got %q", want, got.String())
+	})
+}
+
+var robotsFailureTT = []struct {
+	name     string
+	handler  http.HandlerFunc
+	opts     func(*Options)
+	wantAll  bool
+	wantCall int
+}{
+	{
+		name:     "not found allows all",
+		handler:  robotsStatus(http.StatusNotFound),
+		wantAll:  true,
+		wantCall: 1,
+	},
+	{
+		name:     "unauthorized allows all",
+		handler:  robotsStatus(http.StatusUnauthorized),
+		wantAll:  true,
+		wantCall: 1,
+	},
+	{
+		name:     "forbidden allows all",
+		handler:  robotsStatus(http.StatusForbidden),
+		wantAll:  true,
+		wantCall: 1,
+	},
+	{
+		name:     "server error disallows all",
+		handler:  robotsStatus(http.StatusInternalServerError),
+		wantAll:  false,
+		wantCall: 1,
+	},
+	{
+		name:     "unavailable disallows all",
+		handler:  robotsStatus(http.StatusServiceUnavailable),
+		wantAll:  false,
+		wantCall: 1,
+	},
+	{
+		name:     "server error is retried",
+		handler:  robotsStatus(http.StatusServiceUnavailable),
+		opts:     func(o *Options) { o.RobotsFailure = RobotsRetry; o.RobotsRetries = 2 },
+		wantAll:  false,
+		wantCall: 3,
+	},
+	{
+		name:     "retry until it works",
+		handler:  robotsFlaky(2, "User-agent: *\nDisallow:\n"),
+		opts:     func(o *Options) { o.RobotsFailure = RobotsRetry; o.RobotsRetries = 3 },
+		wantAll:  true,
+		wantCall: 3,
+	},
+	{
+		name:     "redirects are followed",
+		handler:  robotsRedirects(robotsMaxRedirects, "User-agent: *\nDisallow: /\n"),
+		wantAll:  false,
+		wantCall: robotsMaxRedirects + 1,
+	},
+	{
+		name:     "too many redirects allows all",
+		handler:  robotsRedirects(robotsMaxRedirects+1, "User-agent: *\nDisallow: /\n"),
+		wantAll:  true,
+		wantCall: robotsMaxRedirects + 1,
+	},
+	{
+		name:     "rules past the size cap are ignored",
+		handler:  robotsFile("User-agent: *\n" + strings.Repeat("# padding\n", 100) + "Disallow: /\n"),
+		opts:     func(o *Options) { o.RobotsMaxSize = 200 },
+		wantAll:  true,
+		wantCall: 1,
+	},
+	{
+		name:     "rules within the size cap apply",
+		handler:  robotsFile("User-agent: *\nDisallow: /\n" + strings.Repeat("# padding\n", 100)),
+		opts:     func(o *Options) { o.RobotsMaxSize = 200 },
+		wantAll:  false,
+		wantCall: 1,
+	},
+}
+
+func TestRobotsFailures(t *testing.T) {
+	for _, tt := range robotsFailureTT {
+		t.Logf("==== robots failure: %s ====", tt.name)
+
+		calls := 0
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			tt.handler(w, r)
+		}
+
+		opts := DefaultOptions()
+		opts.RobotsRetryWait = 0
+		if tt.opts != nil {
+			tt.opts(&opts)
+		}
+
+		withRobots(t, handler, func(domain *url.URL) {
+			r, err := newRobots(domain, testAgent, http.DefaultClient, opts)
+			check(t, err == nil, "couldn't get robots.txt, %v", err)
+			root := must(domain.Parse("/"))
+			check(t, r.Test(root) == tt.wantAll, "want allowed=%v, got %v", tt.wantAll, r.Test(root))
+			check(t, calls == tt.wantCall, "want %d requests, got %d", tt.wantCall, calls)
+		})
+		t.Log("ok!")
+	}
+}
+
+func TestRobotsUnreachableDisallowsAll(t *testing.T) {
+	var domain *url.URL
+	withRobots(t, robotsFile(""), func(d *url.URL) { domain = d })
+
+	// server is now closed
+	r, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+	check(t, err == nil, "unreachable robots.txt shouldn't be an error, got %v", err)
+	check(t, !r.Test(must(domain.Parse("/"))), "unreachable robots.txt should disallow all")
+}
+
+func TestRobotsSendsUserAgent(t *testing.T) {
+	var gotAgent string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		gotAgent = r.UserAgent()
+		http.NotFound(w, r)
+	}
+	withRobots(t, handler, func(domain *url.URL) {
+		_, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+		check(t, err == nil, "couldn't get robots.txt, %v", err)
+		check(t, gotAgent == testAgent, "want user agent %q, got %q", testAgent, gotAgent)
+	})
+}
+
+func TestRobotsAreRefreshed(t *testing.T) {
+	body := "User-agent: *\nDisallow: /a\n"
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		robotsFile(body)(w, r)
+	}
+
+	withRobots(t, handler, func(domain *url.URL) {
+		r, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+		check(t, err == nil, "couldn't get robots.txt, %v", err)
+
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		body = "User-agent: *\nDisallow: /b\n"
+
+		now = now.Add(time.Hour)
+		check(t, !r.Test(must(domain.Parse("/a"))), "rules shouldn't change before the TTL")
+		check(t, calls == 1, "want 1 request before the TTL, got %d", calls)
+
+		now = now.Add(24 * time.Hour)
+		check(t, r.Test(must(domain.Parse("/a"))), "old rules should be replaced after the TTL")
+		check(t, !r.Test(must(domain.Parse("/b"))), "new rules should apply after the TTL")
+		check(t, calls == 2, "want 2 requests after the TTL, got %d", calls)
+	})
+}
+
+func TestRobotsKeepsRulesWhenUnreachable(t *testing.T) {
+	failing := false
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			robotsStatus(http.StatusServiceUnavailable)(w, r)
+			return
+		}
+		robotsFile("User-agent: *\nDisallow: /a\n")(w, r)
+	}
+
+	withRobots(t, handler, func(domain *url.URL) {
+		r, err := newRobots(domain, testAgent, http.DefaultClient, DefaultOptions())
+		check(t, err == nil, "couldn't get robots.txt, %v", err)
+
+		now := time.Now()
+		r.now = func() time.Time { return now }
+		observer := &recorder{}
+		r.observer = observer
+
+		failing = true
+		now = now.Add(25 * time.Hour)
+		check(t, !r.Test(must(domain.Parse("/a"))), "previous rules should still apply")
+		check(t, r.Test(must(domain.Parse("/b"))), "previous rules should still apply, not disallow all")
+		want := fmt.Sprintf("error robots.txt of %q keeps its previous rules, robots.txt is unreachable", domain.Host)
+		check(t, len(observer.events) == 1 && observer.events[0] == want, "want the observer told %q, got %q", want, observer.events)
+	})
+}
+
+// context providers
+
+func withRobots(t *testing.T, robots http.HandlerFunc, f func(*url.URL)) {
+	withHandler(t, robots, f)
+}
+
+func robotsFile(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, body)
+	}
+}
+
+func robotsStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// fails n times before serving body
+func robotsFlaky(n int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n > 0 {
+			n--
+			robotsStatus(http.StatusServiceUnavailable)(w, r)
+			return
+		}
+		robotsFile(body)(w, r)
+	}
+}
+
+// redirects n times before serving body
+func robotsRedirects(n int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hop := 0
+		fmt.Sscanf(r.URL.Query().Get("hop"), "%d", &hop)
+		if hop < n {
+			http.Redirect(w, r, fmt.Sprintf("/robots.txt?hop=%d", hop+1), http.StatusFound)
+			return
+		}
+		robotsFile(body)(w, r)
+	}
+}
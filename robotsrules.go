@@ -0,0 +1,321 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules are the groups of rules found in a robots.txt file, parsed
+// and matched the way RFC 9309 describes.
+//
+// see https://www.rfc-editor.org/rfc/rfc9309
+type robotsRules struct {
+	groups   []*robotsGroup
+	sitemaps []string
+	// when there's no file to read, verdict explains why everything is
+	// allowed or disallowed
+	verdict *RobotsVerdict
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []*robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow bool
+	// path is normalized, but otherwise as written in robots.txt
+	path    string
+	line    int
+	pattern *regexp.Regexp
+}
+
+func (r *robotsRule) String() string {
+	if r.allow {
+		return "Allow: " + r.path
+	}
+	return "Disallow: " + r.path
+}
+
+// RobotsVerdict explains why robots.txt allows or blocks a URL.
+type RobotsVerdict struct {
+	Allowed bool
+	// Group lists the user agents of the group that applied, empty when
+	// no group was meant for the crawler.
+	Group []string
+	// Rule is the rule that decided, empty when no rule matched.
+	Rule string
+	// Line is the line of Rule in robots.txt.
+	Line int
+	// Reason explains the verdict when no rule did, like when robots.txt
+	// can't be retrieved.
+	Reason string
+}
+
+func (v RobotsVerdict) String() string {
+	verdict := "blocked"
+	if v.Allowed {
+		verdict = "allowed"
+	}
+	switch {
+	case v.Reason != "":
+		return fmt.Sprintf("%s, %s", verdict, v.Reason)
+	case v.Rule != "":
+		return fmt.Sprintf("%s by line %d %q, in group for %s", verdict, v.Line, v.Rule, strings.Join(v.Group, ", "))
+	case len(v.Group) != 0:
+		return fmt.Sprintf("%s, no rule matched in group for %s", verdict, strings.Join(v.Group, ", "))
+	default:
+		return verdict + ", no group for this agent"
+	}
+}
+
+func allowAllRobots(reason string) *robotsRules {
+	return &robotsRules{verdict: &RobotsVerdict{Allowed: true, Reason: reason}}
+}
+
+func disallowAllRobots(reason string) *robotsRules {
+	return &robotsRules{verdict: &RobotsVerdict{Allowed: false, Reason: reason}}
+}
+
+// parseRobots reads the rules of a robots.txt file. Lines that can't be
+// understood are skipped, as the RFC asks.
+func parseRobots(body []byte) *robotsRules {
+	rules := &robotsRules{}
+
+	var (
+		group *robotsGroup
+		// consecutive user-agent lines start the same group
+		inAgents bool
+	)
+
+	for i, text := range strings.Split(string(body), "\n") {
+		line := i + 1
+		key, value, ok := robotsLine(text)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				rules.groups = append(rules.groups, group)
+			}
+			inAgents = true
+			group.agents = append(group.agents, agentToken(value))
+			continue
+
+		case "sitemap":
+			// not part of any group
+			rules.sitemaps = append(rules.sitemaps, value)
+			continue
+		}
+
+		inAgents = false
+		if group == nil {
+			// rules before any user-agent apply to nobody
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			if value == "" {
+				// an empty rule matches nothing
+				continue
+			}
+			group.rules = append(group.rules, newRobotsRule(key == "allow", value, line))
+		case "crawl-delay":
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+				group.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+	return rules
+}
+
+// robotsLine splits a robots.txt line in its lowercase key and its value,
+// dropping comments.
+func robotsLine(line string) (key, value string, ok bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	value = strings.TrimSpace(line[i+1:])
+
+	// common typos, tolerated by most crawlers
+	switch key {
+	case "useragent", "user agent":
+		key = "user-agent"
+	case "dissallow", "dissalow", "disalow", "diasllow", "disallaw":
+		key = "disallow"
+	case "site-map":
+		key = "sitemap"
+	}
+	return key, value, true
+}
+
+func newRobotsRule(allow bool, path string, line int) *robotsRule {
+	if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "*") {
+		path = "/" + path
+	}
+	path = normalizeRobotsPath(path)
+
+	// * matches any sequence of characters, a trailing $ anchors the end
+	pattern := strings.TrimSuffix(path, "$")
+	expr := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, `.*`, -1)
+	if strings.HasSuffix(path, "$") {
+		expr += "$"
+	}
+
+	return &robotsRule{
+		allow:   allow,
+		path:    path,
+		line:    line,
+		pattern: regexp.MustCompile(expr),
+	}
+}
+
+// group finds the groups for the agent, merged, or those for "*" if none
+// names the agent.
+func (r *robotsRules) group(agent string) *robotsGroup {
+	agent = agentToken(agent)
+
+	var mine, wildcard *robotsGroup
+	merge := func(into **robotsGroup, g *robotsGroup, name string) {
+		if *into == nil {
+			*into = &robotsGroup{}
+		}
+		(*into).agents = append((*into).agents, name)
+		(*into).rules = append((*into).rules, g.rules...)
+		if g.crawlDelay > (*into).crawlDelay {
+			(*into).crawlDelay = g.crawlDelay
+		}
+	}
+
+	for _, g := range r.groups {
+		switch {
+		case g.names(agent):
+			merge(&mine, g, agent)
+		case g.names("*"):
+			merge(&wildcard, g, "*")
+		}
+	}
+
+	if mine != nil {
+		return mine
+	}
+	return wildcard
+}
+
+func (g *robotsGroup) names(agent string) bool {
+	for _, a := range g.agents {
+		if a == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// explain tells if target, a normalized path and query, can be crawled
+// by the agent. The most specific rule wins, and allow wins over
+// disallow when they're as specific.
+func (r *robotsRules) explain(target, agent string) RobotsVerdict {
+	if r.verdict != nil {
+		return *r.verdict
+	}
+	if target == "/robots.txt" {
+		return RobotsVerdict{Allowed: true, Reason: "robots.txt is always allowed"}
+	}
+
+	g := r.group(agent)
+	if g == nil {
+		return RobotsVerdict{Allowed: true}
+	}
+
+	var best *robotsRule
+	for _, rule := range g.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		switch {
+		case best == nil,
+			len(rule.path) > len(best.path),
+			len(rule.path) == len(best.path) && rule.allow && !best.allow:
+			best = rule
+		}
+	}
+
+	v := RobotsVerdict{Allowed: true, Group: g.agents}
+	if best != nil {
+		v.Allowed = best.allow
+		v.Rule = best.String()
+		v.Line = best.line
+	}
+	return v
+}
+
+// normalizeRobotsPath makes paths comparable the way RFC 9309 says:
+// unreserved characters are decoded, other escapes use uppercase hex,
+// and octets that aren't printable ASCII are encoded.
+//
+//	"/%7efoo/caf\xc3\xa9%2f" => "/~foo/caf%C3%A9%2F"
+//
+// see https://www.rfc-editor.org/rfc/rfc9309#section-2.2.2
+func normalizeRobotsPath(p string) string {
+	const hex = "0123456789ABCDEF"
+
+	var buf bytes.Buffer
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '%' && i+2 < len(p) && isHex(p[i+1]) && isHex(p[i+2]):
+			v := unhex(p[i+1])<<4 | unhex(p[i+2])
+			if isUnreserved(v) {
+				buf.WriteByte(v)
+			} else {
+				buf.WriteByte('%')
+				buf.WriteByte(hex[v>>4])
+				buf.WriteByte(hex[v&0xf])
+			}
+			i += 2
+		case c <= ' ' || c >= 0x7f:
+			buf.WriteByte('%')
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func isUnreserved(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+var normalizeRobotsPathTT = []struct {
+	name string
+	path string
+	want string
+}{
+	{name: "plain path", path: "/a/b.html", want: "/a/b.html"},
+	{name: "unreserved escapes are decoded", path: "/%7ebob/%41-%5F", want: "/~bob/A-_"},
+	{name: "reserved escapes use uppercase", path: "/a%2fb?c%3dd", want: "/a%2Fb?c%3Dd"},
+	{name: "non ASCII is encoded", path: "/café", want: "/caf%C3%A9"},
+	{name: "spaces are encoded", path: "/a b", want: "/a%20b"},
+	{name: "broken escapes are kept", path: "/100%/%zz", want: "/100%/%zz"},
+	{name: "wildcards are kept", path: "/*.pdf$", want: "/*.pdf$"},
+}
+
+func TestNormalizeRobotsPath(t *testing.T) {
+	for _, tt := range normalizeRobotsPathTT {
+		t.Logf("==== normalize robots path: %s ====", tt.name)
+		got := normalizeRobotsPath(tt.path)
+		check(t, got == tt.want, "want %q, got %q", tt.want, got)
+		t.Log("ok!")
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	body := `# comment
+Disallow: /before-any-agent
+Sitemap: http://example.com/a.xml
+
+User-agent: a
+User-Agent: B # comment
+Disallow: /ab
+crawl-delay: 1.5
+
+User-agent: *
+Allow: /public
+Disallow: /
+Sitemap: http://example.com/b.xml
+not a rule
+Disallow:
+
+user-agent: a
+Disallow: /more
+`
+	rules := parseRobots([]byte(body))
+
+	check(t, len(rules.sitemaps) == 2, "want 2 sitemaps, got %q", rules.sitemaps)
+	check(t, len(rules.groups) == 3, "want 3 groups, got %d", len(rules.groups))
+
+	a := rules.group("a/1.0")
+	check(t, len(a.rules) == 2, "want rules of both groups for a, got %d", len(a.rules))
+	check(t, a.crawlDelay == 1500*time.Millisecond, "want crawl delay of 1.5s, got %v", a.crawlDelay)
+
+	b := rules.group("b")
+	check(t, len(b.rules) == 1, "want 1 rule for b, got %d", len(b.rules))
+	check(t, b.rules[0].line == 7, "want rule on line 7, got %d", b.rules[0].line)
+
+	other := rules.group("other")
+	check(t, len(other.rules) == 2, "want 2 rules for the default group, got %d", len(other.rules))
+
+	noDefault := parseRobots([]byte("User-agent: a\nDisallow: /\n"))
+	check(t, noDefault.group("other") == nil, "want no group when none applies")
+	check(t, noDefault.explain("/", "other").Allowed, "want everything allowed when no group applies")
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Scope decides which URLs belong to a crawl. A URL is in scope when its
+// scheme and host are allowed, it matches no exclusion, and it matches
+// an inclusion if any are given.
+type Scope struct {
+	// Hosts are allowed as is, without their subdomains. A host with a
+	// port only allows that port.
+	Hosts []string
+	// Domains are allowed along with all their subdomains.
+	Domains []string
+
+	// Schemes are the allowed schemes, http and https if empty.
+	Schemes []string
+	// SchemeEquivalent treats the http and https versions of a URL as
+	// the same resource.
+	SchemeEquivalent bool
+
+	// IncludePrefixes and Include restrict the crawl to the paths
+	// starting with one of the prefixes, or to the URLs matching one of
+	// the patterns. Everything is included when both are empty.
+	IncludePrefixes []string
+	Include         []*regexp.Regexp
+	// ExcludePrefixes and Exclude reject the paths starting with one of
+	// the prefixes, and the URLs matching one of the patterns.
+	ExcludePrefixes []string
+	Exclude         []*regexp.Regexp
+}
+
+// HostScope is the scope of a single host, which is the default scope of
+// a crawl.
+func HostScope(u *url.URL) *Scope {
+	return &Scope{Hosts: []string{u.Host}}
+}
+
+// DomainScope is the scope of the registrable domain of a URL, with all
+// its subdomains and both http and https.
+func DomainScope(u *url.URL) *Scope {
+	return &Scope{
+		Domains:          []string{RegistrableDomain(u.Hostname())},
+		SchemeEquivalent: true,
+	}
+}
+
+// Allows tells if a URL is in scope. When it's not, rule names the rule
+// that rejected it.
+func (s *Scope) Allows(u *url.URL) (ok bool, rule string) {
+	if !s.allowsScheme(u.Scheme) {
+		return false, fmt.Sprintf("scheme %q", u.Scheme)
+	}
+	if !s.allowsHost(u) {
+		return false, fmt.Sprintf("host %q", u.Host)
+	}
+
+	for _, prefix := range s.ExcludePrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return false, fmt.Sprintf("excluded prefix %q", prefix)
+		}
+	}
+	for _, re := range s.Exclude {
+		if re.MatchString(u.String()) {
+			return false, fmt.Sprintf("excluded pattern %q", re.String())
+		}
+	}
+
+	if len(s.IncludePrefixes) == 0 && len(s.Include) == 0 {
+		return true, ""
+	}
+	for _, prefix := range s.IncludePrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return true, ""
+		}
+	}
+	for _, re := range s.Include {
+		if re.MatchString(u.String()) {
+			return true, ""
+		}
+	}
+	return false, "not included"
+}
+
+// External tells if a URL is on a web site outside of the scope, as
+// opposed to being out of scope because of its path.
+func (s *Scope) External(u *url.URL) bool {
+	return isHTTP(u.Scheme) && !s.allowsHost(u)
+}
+
+// Equivalent rewrites a URL in scope to the form the crawl knows it by,
+// using the scheme of root when schemes are equivalent.
+func (s *Scope) Equivalent(root, u *url.URL) *url.URL {
+	if !s.SchemeEquivalent || u.Scheme == root.Scheme || !isHTTP(u.Scheme) || !isHTTP(root.Scheme) {
+		return u
+	}
+	eq := *u
+	eq.Scheme = root.Scheme
+	return &eq
+}
+
+func (s *Scope) allowsScheme(scheme string) bool {
+	if len(s.Schemes) == 0 {
+		return isHTTP(scheme)
+	}
+	for _, allowed := range s.Schemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) allowsHost(u *url.URL) bool {
+	hostname := strings.ToLower(u.Hostname())
+	for _, host := range s.Hosts {
+		host = strings.ToLower(host)
+		if strings.Contains(host, ":") && !strings.HasSuffix(host, "]") {
+			// with a port
+			if host == strings.ToLower(u.Host) {
+				return true
+			}
+		} else if strings.Trim(host, "[]") == hostname {
+			return true
+		}
+	}
+	for _, domain := range s.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTTP(scheme string) bool {
+	return scheme == "http" || scheme == "https"
+}
+
+// RegistrableDomain is the part of a host name that was registered, its
+// public suffix plus one label, following the Public Suffix List. Private
+// suffixes count, sites under github.io are registered apart. Hosts that
+// are public suffixes themselves, or IP addresses, are returned as is.
+//
+//	"www.blog.example.co.uk" => "example.co.uk"
+//	"alice.github.io"        => "alice.github.io"
+func RegistrableDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+var scopeTT = []struct {
+	name     string
+	scope    *Scope
+	accepted []string
+	rejected map[string]string
+}{
+	{
+		name:     "single host",
+		scope:    &Scope{Hosts: []string{"example.com"}},
+		accepted: []string{"http://example.com/", "https://EXAMPLE.com/a", "http://example.com:8080/"},
+		rejected: map[string]string{
+			"http://www.example.com/": `host "www.example.com"`,
+			"http://other.com/":       `host "other.com"`,
+			"ftp://example.com/":      `scheme "ftp"`,
+			"mailto:bob@example.com":  `scheme "mailto"`,
+		},
+	},
+	{
+		name:     "host with a port",
+		scope:    &Scope{Hosts: []string{"127.0.0.1:8080"}},
+		accepted: []string{"http://127.0.0.1:8080/a"},
+		rejected: map[string]string{
+			"http://127.0.0.1:9090/a": `host "127.0.0.1:9090"`,
+			"http://127.0.0.1/a":      `host "127.0.0.1"`,
+		},
+	},
+	{
+		name:     "many hosts",
+		scope:    &Scope{Hosts: []string{"example.com", "cdn.example.org"}},
+		accepted: []string{"http://example.com/", "http://cdn.example.org/a.png"},
+		rejected: map[string]string{"http://example.org/": `host "example.org"`},
+	},
+	{
+		name:     "domain and its subdomains",
+		scope:    &Scope{Domains: []string{"example.com"}},
+		accepted: []string{"http://example.com/", "http://www.example.com/", "https://a.b.example.com/"},
+		rejected: map[string]string{
+			"http://notexample.com/":      `host "notexample.com"`,
+			"http://example.com.evil.io/": `host "example.com.evil.io"`,
+		},
+	},
+	{
+		name:     "domain under a private suffix",
+		scope:    DomainScope(must(url.Parse("http://alice.github.io/"))),
+		accepted: []string{"http://alice.github.io/", "https://docs.alice.github.io/"},
+		rejected: map[string]string{
+			"http://bob.github.io/": `host "bob.github.io"`,
+			"http://github.io/":     `host "github.io"`,
+		},
+	},
+	{
+		name:     "only some schemes",
+		scope:    &Scope{Hosts: []string{"example.com"}, Schemes: []string{"https"}},
+		accepted: []string{"https://example.com/"},
+		rejected: map[string]string{"http://example.com/": `scheme "http"`},
+	},
+	{
+		name: "prefixes",
+		scope: &Scope{
+			Hosts:           []string{"example.com"},
+			IncludePrefixes: []string{"/docs/", "/blog/"},
+			ExcludePrefixes: []string{"/docs/old/"},
+		},
+		accepted: []string{"http://example.com/docs/a", "http://example.com/blog/"},
+		rejected: map[string]string{
+			"http://example.com/":           "not included",
+			"http://example.com/shop/":      "not included",
+			"http://example.com/docs/old/a": `excluded prefix "/docs/old/"`,
+		},
+	},
+	{
+		name: "patterns",
+		scope: &Scope{
+			Hosts:   []string{"example.com"},
+			Include: []*regexp.Regexp{regexp.MustCompile(`\.html$`)},
+			Exclude: []*regexp.Regexp{regexp.MustCompile(`[?&]print=`)},
+		},
+		accepted: []string{"http://example.com/a.html", "http://example.com/b/c.html"},
+		rejected: map[string]string{
+			"http://example.com/a.pdf":         "not included",
+			"http://example.com/a.html?print=": `excluded pattern "[?&]print="`,
+		},
+	},
+}
+
+func TestScopeAllows(t *testing.T) {
+	for _, tt := range scopeTT {
+		t.Logf("==== scope: %s ====", tt.name)
+		for _, link := range tt.accepted {
+			ok, rule := tt.scope.Allows(must(url.Parse(link)))
+			check(t, ok, "%q should be in scope, but was rejected by %q", link, rule)
+			check(t, rule == "", "accepted %q shouldn't have a rule, got %q", link, rule)
+		}
+		for link, want := range tt.rejected {
+			ok, rule := tt.scope.Allows(must(url.Parse(link)))
+			check(t, !ok, "%q should be out of scope", link)
+			check(t, rule == want, "%q should be rejected by %q, got %q", link, want, rule)
+		}
+		t.Log("ok!")
+	}
+}
+
+func TestScopeEquivalent(t *testing.T) {
+	root := must(url.Parse("https://example.com/"))
+
+	same := &Scope{}
+	u := must(url.Parse("http://example.com/a"))
+	check(t, same.Equivalent(root, u) == u, "schemes should be kept by default")
+
+	eq := &Scope{SchemeEquivalent: true}
+	got := eq.Equivalent(root, u).String()
+	check(t, got == "https://example.com/a", "want scheme of root, got %q", got)
+	check(t, u.String() == "http://example.com/a", "original URL shouldn't change, got %q", u)
+}
+
+var registrableDomainTT = []struct {
+	host string
+	want string
+}{
+	{host: "example.com", want: "example.com"},
+	{host: "www.example.com", want: "example.com"},
+	{host: "a.b.example.com.", want: "example.com"},
+	{host: "WWW.Example.COM", want: "example.com"},
+	{host: "www.example.co.uk", want: "example.co.uk"},
+	{host: "example.co.uk", want: "example.co.uk"},
+	{host: "co.uk", want: "co.uk"},
+	{host: "shop.example.com.br", want: "example.com.br"},
+	{host: "www.dept.gov.uk", want: "dept.gov.uk"},
+	{host: "alice.github.io", want: "alice.github.io"},
+	{host: "docs.alice.github.io", want: "alice.github.io"},
+	{host: "myapp.herokuapp.com", want: "myapp.herokuapp.com"},
+	{host: "github.io", want: "github.io"},
+	{host: "localhost", want: "localhost"},
+	{host: "127.0.0.1", want: "127.0.0.1"},
+	{host: "::1", want: "::1"},
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	for _, tt := range registrableDomainTT {
+		got := RegistrableDomain(tt.host)
+		check(t, got == tt.want, "want registrable domain of %q to be %q, got %q", tt.host, tt.want, got)
+	}
+}
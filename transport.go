@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions tune the connections of the crawler's client.
+type TransportOptions struct {
+	// ConnectTimeout is how long connecting to a server can take.
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout is how long the TLS handshake can take.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is how long the server can take to answer,
+	// once the request is sent, until the headers of its response.
+	ResponseHeaderTimeout time.Duration
+	// Timeout is how long a whole request can take, redirects and
+	// reading the body included. Zero means no limit, for every timeout.
+	Timeout time.Duration
+
+	// Proxy is the URL of the proxy every request goes through. The
+	// proxy of the environment is used if nil, from HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY.
+	Proxy *url.URL
+	// NoProxy connects directly to the servers, whatever the environment
+	// says.
+	NoProxy bool
+
+	// CAFiles are PEM bundles of the certificate authorities to trust,
+	// along with those of the system, for the servers with certificates
+	// of their own.
+	CAFiles []string
+	// ClientCert and ClientKey are the PEM files of the certificate the
+	// crawler identifies itself with, to the servers asking for one. The
+	// key is read from ClientCert if ClientKey is empty.
+	ClientCert, ClientKey string
+	// InsecureSkipVerify accepts any certificate, self-signed ones
+	// included. Only for test servers.
+	InsecureSkipVerify bool
+
+	// HTTP2 negotiates HTTP/2 with the servers supporting it, over TLS.
+	HTTP2 bool
+}
+
+// DefaultTransportOptions are the options of the client the crawler
+// uses when it isn't given one.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		ConnectTimeout:        30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		Timeout:               2 * time.Minute,
+		HTTP2:                 true,
+	}
+}
+
+// NewTransport creates a transport connecting to servers with opts. The
+// whole request Timeout is left to the client.
+func NewTransport(opts TransportOptions) (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if len(opts.CAFiles) != 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, filename := range opts.CAFiles {
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificate in %q", filename)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCert != "" {
+		keyFile := opts.ClientKey
+		if keyFile == "" {
+			keyFile = opts.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate, %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if opts.ClientKey != "" {
+		return nil, fmt.Errorf("client key without a certificate")
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch {
+	case opts.NoProxy:
+		proxy = nil
+	case opts.Proxy != nil:
+		proxy = http.ProxyURL(opts.Proxy)
+	}
+
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		ForceAttemptHTTP2:     opts.HTTP2,
+	}
+	if !opts.HTTP2 {
+		// a non-nil empty map turns HTTP/2 off
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t, nil
+}
+
+// NewClient creates a client whose requests are bounded by the timeouts
+// of opts, over a transport made by NewTransport.
+func NewClient(opts TransportOptions) (*http.Client, error) {
+	t, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t, Timeout: opts.Timeout}, nil
+}
@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes blocks of PEM to a file of dir.
+func writePEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	filename := filepath.Join(dir, name)
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	err := ioutil.WriteFile(filename, data, 0600)
+	check(t, err == nil, "couldn't write %q, %v", filename, err)
+	return filename
+}
+
+// clientCertificate creates a self-signed client certificate, and writes
+// it and its key to dir.
+func clientCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check(t, err == nil, "couldn't generate a key, %v", err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "crawler"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	check(t, err == nil, "couldn't create a certificate, %v", err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	check(t, err == nil, "couldn't marshal the key, %v", err)
+	return writePEM(t, dir, "client.crt", &pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		writePEM(t, dir, "client.key", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestTransportTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport")
+	check(t, err == nil, "couldn't create a directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s, %d client certificates", r.Proto, len(r.TLS.PeerCertificates))
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	ca := writePEM(t, dir, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	cert, key := clientCertificate(t, dir)
+	both := writePEM(t, dir, "both.pem", readPEM(t, cert)[0], readPEM(t, key)[0])
+
+	tests := []struct {
+		name string
+		opts TransportOptions
+		want string
+		err  string
+	}{
+		{"untrusted", TransportOptions{HTTP2: true}, "", "certificate"},
+		{"ca", TransportOptions{CAFiles: []string{ca}, HTTP2: true}, "HTTP/2.0, 0 client certificates", ""},
+		{"insecure", TransportOptions{InsecureSkipVerify: true, HTTP2: true}, "HTTP/2.0, 0 client certificates", ""},
+		{"http/1.1", TransportOptions{CAFiles: []string{ca}}, "HTTP/1.1, 0 client certificates", ""},
+		{"client certificate", TransportOptions{CAFiles: []string{ca}, ClientCert: cert, ClientKey: key}, "HTTP/1.1, 1 client certificates", ""},
+		{"client certificate and key", TransportOptions{CAFiles: []string{ca}, ClientCert: both}, "HTTP/1.1, 1 client certificates", ""},
+	}
+	for _, tt := range tests {
+		client, err := NewClient(tt.opts)
+		check(t, err == nil, "%s: couldn't create the client, %v", tt.name, err)
+		resp, err := client.Get(server.URL)
+		if tt.err != "" {
+			check(t, err != nil && strings.Contains(err.Error(), tt.err), "%s: want error %q, got %v", tt.name, tt.err, err)
+			continue
+		}
+		check(t, err == nil, "%s: couldn't get, %v", tt.name, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		check(t, string(body) == tt.want, "%s: want %q, got %q", tt.name, tt.want, body)
+	}
+}
+
+func readPEM(t *testing.T, filename string) []*pem.Block {
+	data, err := ioutil.ReadFile(filename)
+	check(t, err == nil, "couldn't read %q, %v", filename, err)
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return blocks
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+func TestTransportBadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport")
+	check(t, err == nil, "couldn't create a directory, %v", err)
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty.pem")
+	check(t, ioutil.WriteFile(empty, nil, 0600) == nil, "couldn't write the file")
+
+	tests := []struct {
+		opts TransportOptions
+		err  string
+	}{
+		{TransportOptions{CAFiles: []string{filepath.Join(dir, "missing.pem")}}, "no such file"},
+		{TransportOptions{CAFiles: []string{empty}}, "no certificate"},
+		{TransportOptions{ClientCert: empty}, "loading client certificate"},
+		{TransportOptions{ClientKey: empty}, "key without a certificate"},
+	}
+	for _, tt := range tests {
+		_, err := NewTransport(tt.opts)
+		check(t, err != nil && strings.Contains(err.Error(), tt.err), "%+v: want error %q, got %v", tt.opts, tt.err, err)
+
+		// the crawler reports it
+		opts := DefaultOptions()
+		opts.Transport = tt.opts
+		_, err = NewCrawlerWithOptions(must(url.Parse("http://example.com")), testAgent, opts)
+		check(t, err != nil && strings.Contains(err.Error(), tt.err), "%+v: want crawler error %q, got %v", tt.opts, tt.err, err)
+	}
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-body" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		// let the handlers go before the server closes
+		defer close(release)
+		tests := []struct {
+			path string
+			opts TransportOptions
+		}{
+			{"/slow-headers", TransportOptions{ResponseHeaderTimeout: 50 * time.Millisecond}},
+			{"/slow-headers", TransportOptions{Timeout: 50 * time.Millisecond}},
+			{"/slow-body", TransportOptions{Timeout: 50 * time.Millisecond}},
+		}
+		for _, tt := range tests {
+			client, err := NewClient(tt.opts)
+			check(t, err == nil, "couldn't create the client, %v", err)
+			start := time.Now()
+			resp, err := client.Get(domain.String() + tt.path)
+			if err == nil {
+				_, err = ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			check(t, err != nil, "%s %+v: want a timeout", tt.path, tt.opts)
+			check(t, time.Since(start) < 2*time.Second, "%s %+v: want the request cut short, took %v", tt.path, tt.opts, time.Since(start))
+		}
+	})
+}
+
+func TestTransportProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+	proxyURL := must(url.Parse(proxy.URL))
+
+	client, err := NewClient(TransportOptions{Proxy: proxyURL})
+	check(t, err == nil, "couldn't create the client, %v", err)
+	resp, err := client.Get("http://example.invalid/page")
+	check(t, err == nil, "couldn't get through the proxy, %v", err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	check(t, string(body) == "proxied http://example.invalid/page", "want the request proxied, got %q", body)
+
+	transport, err := NewTransport(TransportOptions{Proxy: proxyURL, NoProxy: true})
+	check(t, err == nil, "couldn't create the transport, %v", err)
+	check(t, transport.Proxy == nil, "want no proxy")
+}
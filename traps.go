@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrapLimits cap the URL spaces that never end, like calendars, paging
+// or paths that repeat themselves. A limit of zero is no limit.
+type TrapLimits struct {
+	// MaxSegmentRepeats is how many times a segment can appear in a
+	// path, to stop at relative links resolving to /a/b/a/b/a/b.
+	MaxSegmentRepeats int
+	// MaxPathLength is the longest path allowed, in bytes.
+	MaxPathLength int
+	// MaxQueryVariants is how many queries of a path are crawled, like
+	// those paging through a list.
+	MaxQueryVariants int
+	// MaxPathVariants is how many paths can share a template. The
+	// template of a path has its numbers replaced, so that the pages of
+	// a calendar share one, but so do those of a catalog.
+	//
+	//	"/calendar/2014/05" => "/calendar/#/#"
+	MaxPathVariants int
+	// MaxPagesPerDirectory is how many pages are crawled in a directory.
+	MaxPagesPerDirectory int
+}
+
+// DefaultTrapLimits are loose enough for most sites.
+func DefaultTrapLimits() TrapLimits {
+	return TrapLimits{
+		MaxSegmentRepeats:    2,
+		MaxPathLength:        1024,
+		MaxQueryVariants:     500,
+		MaxPagesPerDirectory: 5000,
+	}
+}
+
+// trapDetector counts the URLs admitted in the crawl, to prune those
+// past the limits.
+type trapDetector struct {
+	limits TrapLimits
+	// admitted URLs and paths, and how many were admitted by path, by
+	// template and by directory
+	admitted  *stringSet
+	paths     map[string]int
+	templates map[string]int
+	dirs      map[string]int
+}
+
+func newTrapDetector(limits TrapLimits) *trapDetector {
+	return &trapDetector{
+		limits:    limits,
+		admitted:  newStringSet(),
+		paths:     make(map[string]int),
+		templates: make(map[string]int),
+		dirs:      make(map[string]int),
+	}
+}
+
+// admit tells if u can be crawled, and counts it if so. When it can't,
+// heuristic tells which limit it would break.
+func (t *trapDetector) admit(u *url.URL) (ok bool, heuristic string) {
+	if t.admitted.Contains(u.String()) {
+		return true, ""
+	}
+
+	if max := t.limits.MaxPathLength; max > 0 && len(u.EscapedPath()) > max {
+		return false, fmt.Sprintf("path longer than %d bytes", max)
+	}
+	if max := t.limits.MaxSegmentRepeats; max > 0 {
+		if segment, n := mostRepeatedSegment(u.Path); n > max {
+			return false, fmt.Sprintf("segment %q repeated %d times", segment, n)
+		}
+	}
+
+	p := u.Host + u.Path
+	if max := t.limits.MaxQueryVariants; max > 0 && t.paths[p] >= max {
+		return false, fmt.Sprintf("more than %d variants of %q", max, p)
+	}
+	// only a path not seen yet is another variant of its template
+	template := u.Host + pathTemplate(u.Path)
+	newPath := t.paths[p] == 0
+	if max := t.limits.MaxPathVariants; max > 0 && newPath && t.templates[template] >= max {
+		return false, fmt.Sprintf("more than %d paths like %q", max, template)
+	}
+	dir := u.Host + path.Dir(u.Path)
+	if max := t.limits.MaxPagesPerDirectory; max > 0 && t.dirs[dir] >= max {
+		return false, fmt.Sprintf("more than %d pages in %q", max, dir)
+	}
+
+	t.admitted.Add(u.String())
+	t.paths[p]++
+	if newPath {
+		t.templates[template]++
+	}
+	t.dirs[dir]++
+	return true, ""
+}
+
+// mostRepeatedSegment finds the segment of the path that appears the most
+// times.
+func mostRepeatedSegment(p string) (segment string, n int) {
+	counts := make(map[string]int)
+	for _, s := range strings.Split(p, "/") {
+		if s == "" {
+			continue
+		}
+		counts[s]++
+		if counts[s] > n {
+			segment, n = s, counts[s]
+		}
+	}
+	return
+}
+
+// pathTemplate replaces the runs of digits of a path with #.
+//
+//	"/calendar/2014/05/day-12" => "/calendar/#/#/day-#"
+func pathTemplate(p string) string {
+	var buf []byte
+	for i := 0; i < len(p); i++ {
+		if '0' <= p[i] && p[i] <= '9' {
+			if len(buf) == 0 || buf[len(buf)-1] != '#' {
+				buf = append(buf, '#')
+			}
+			continue
+		}
+		buf = append(buf, p[i])
+	}
+	return string(buf)
+}
@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tt := []struct{ path, want string }{
+		{"/", "/"},
+		{"/calendar/2014/05/day-12", "/calendar/#/#/day-#"},
+		{"/posts/hello", "/posts/hello"},
+		{"/v2.1/docs", "/v#.#/docs"},
+	}
+	for _, tt := range tt {
+		got := pathTemplate(tt.path)
+		check(t, got == tt.want, "%q: want %q, got %q", tt.path, tt.want, got)
+	}
+}
+
+func TestTrapDetector(t *testing.T) {
+	tt := []struct {
+		name   string
+		limits TrapLimits
+		links  []string
+		// want the heuristic of each link, empty when it's admitted
+		want []string
+	}{
+		{
+			name:   "no limits",
+			limits: TrapLimits{},
+			links:  []string{"/a/a/a/a/a", "/b?page=1", "/b?page=2"},
+			want:   []string{"", "", ""},
+		},
+		{
+			name:   "repeated segments",
+			limits: TrapLimits{MaxSegmentRepeats: 2},
+			links:  []string{"/a/b/a/b", "/a/b/a/b/a/b", "/a/b/a/b/c"},
+			want:   []string{"", `segment "a" repeated 3 times`, ""},
+		},
+		{
+			name:   "path length",
+			limits: TrapLimits{MaxPathLength: 8},
+			links:  []string{"/1234567", "/12345678"},
+			want:   []string{"", "path longer than 8 bytes"},
+		},
+		{
+			name:   "query variants",
+			limits: TrapLimits{MaxQueryVariants: 2},
+			links:  []string{"/list?page=1", "/list?page=2", "/list?page=1", "/list?page=3", "/other?page=3"},
+			want:   []string{"", "", "", `more than 2 variants of "example.com/list"`, ""},
+		},
+		{
+			name:   "numbered paths aren't query variants",
+			limits: TrapLimits{MaxQueryVariants: 2},
+			links:  []string{"/product/1", "/product/2", "/product/3", "/product/3?color=red"},
+			want:   []string{"", "", "", ""},
+		},
+		{
+			name:   "calendar",
+			limits: TrapLimits{MaxPathVariants: 2},
+			links:  []string{"/cal/2014/05", "/cal/2014/06", "/cal/2014/06?view=week", "/cal/2014/07", "/cal/next"},
+			want:   []string{"", "", "", `more than 2 paths like "example.com/cal/#/#"`, ""},
+		},
+		{
+			name:   "directory budget",
+			limits: TrapLimits{MaxPagesPerDirectory: 2},
+			links:  []string{"/docs/a", "/docs/b", "/docs/c", "/docs/sub/c"},
+			want:   []string{"", "", `more than 2 pages in "example.com/docs"`, ""},
+		},
+	}
+
+	for _, tt := range tt {
+		traps := newTrapDetector(tt.limits)
+		for i, link := range tt.links {
+			u := must(url.Parse("http://example.com" + link))
+			ok, got := traps.admit(u)
+			check(t, ok == (tt.want[i] == ""), "%s: want %q admitted=%v, got %v (%s)", tt.name, link, tt.want[i] == "", ok, got)
+			check(t, got == tt.want[i], "%s: want %q pruned by %q, got %q", tt.name, link, tt.want[i], got)
+		}
+	}
+}
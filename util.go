@@ -2,6 +2,7 @@ package crawler
 
 import (
 	"net/url"
+	"strings"
 )
 
 // Set of string
@@ -52,39 +53,65 @@ func (q *urlQueue) Remove() *url.URL {
 type resourceLocator struct {
 	element string
 	attr    string
+	// split breaks the attribute value into the URLs it holds, when the
+	// attribute can hold more than one. nil means the value is a URL.
+	split func(string) []string
+	// baseAttr names an attribute of the same element that the URLs
+	// resolve against, like applet[codebase].
+	baseAttr string
+	// leaf resources are media or scripts, which never link further
+	leaf bool
 }
 
 func (r *resourceLocator) cssSelector() string {
 	return r.element + "[" + r.attr + "]"
 }
 
+func (r *resourceLocator) values(val string) []string {
+	if r.split == nil {
+		return []string{val}
+	}
+	return r.split(val)
+}
+
 var htmlResources = []resourceLocator{
-	{"a", "href"},
-	{"area", "href"},
-	{"base", "href"},
-	{"link", "href"},
-
-	{"audio", "src"},
-	{"embed", "src"},
-	{"iframe", "src"},
-	{"img", "src"},
-	{"input", "src"},
-	{"script", "src"},
-	{"source", "src"},
-	{"track", "src"},
-	{"video", "src"},
-
-	{"blockquote", "cite"},
-	{"del", "cite"},
-	{"ins", "cite"},
-	{"q", "cite"},
-
-	{"code", "applet"},
-	{"codebase", "applet"},
-
-	{"object", "data"},
-
-	{"html", "manifest"},
-
-	{"video", "poster"},
+	{element: "a", attr: "href"},
+	{element: "area", attr: "href"},
+	{element: "link", attr: "href"},
+	{element: "link", attr: "imagesrcset", split: parseSrcset, leaf: true},
+
+	{element: "audio", attr: "src", leaf: true},
+	{element: "embed", attr: "src", leaf: true},
+	{element: "iframe", attr: "src"},
+	{element: "img", attr: "src", leaf: true},
+	{element: "img", attr: "srcset", split: parseSrcset, leaf: true},
+	{element: "input", attr: "src", leaf: true},
+	{element: "script", attr: "src", leaf: true},
+	{element: "source", attr: "src", leaf: true},
+	{element: "source", attr: "srcset", split: parseSrcset, leaf: true},
+	{element: "track", attr: "src", leaf: true},
+	{element: "video", attr: "src", leaf: true},
+
+	{element: "blockquote", attr: "cite"},
+	{element: "del", attr: "cite"},
+	{element: "ins", attr: "cite"},
+	{element: "q", attr: "cite"},
+
+	// codebase isn't a resource of its own, it's the directory the
+	// other attributes are relative to
+	{element: "applet", attr: "code", baseAttr: "codebase"},
+	{element: "applet", attr: "archive", split: splitComma, baseAttr: "codebase"},
+
+	{element: "object", attr: "data", baseAttr: "codebase"},
+	{element: "object", attr: "archive", split: strings.Fields, baseAttr: "codebase"},
+
+	{element: "html", attr: "manifest"},
+
+	{element: "video", attr: "poster", leaf: true},
+
+	// SVG, the parser strips the xlink namespace so href
+	// matches both xlink:href and plain href
+	{element: "image", attr: "href", leaf: true},
+	{element: "use", attr: "href"},
+	{element: "script", attr: "href", leaf: true},
 }
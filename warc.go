@@ -0,0 +1,528 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WARCField is a named field of a WARC record header, or of a warcinfo or
+// metadata record.
+type WARCField struct {
+	Name, Value string
+}
+
+// WARCWriter writes WARC/1.1 records to the files of a directory. Every
+// record is gzipped on its own, and a new file is started when the
+// current one would grow past the size limit. Every file starts with a
+// warcinfo record.
+//
+// see https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/
+type WARCWriter struct {
+	lock    sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	info    []WARCField
+	now     func() time.Time
+
+	file   *os.File
+	size   int64
+	serial int
+}
+
+// NewWARCWriter writes the files to dir, named after prefix. Past maxSize
+// bytes a new file is started, zero puts everything in one file. The
+// info fields, like the agent and the options of the crawler, are
+// written in the warcinfo record of every file.
+func NewWARCWriter(dir, prefix string, maxSize int64, info []WARCField) (*WARCWriter, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &WARCWriter{dir: dir, prefix: prefix, maxSize: maxSize, info: info, now: time.Now}, nil
+}
+
+// Close closes the current file.
+func (w *WARCWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// warcRecord is a record to be written, its block excluded from its
+// header fields.
+type warcRecord struct {
+	header []WARCField
+	block  []byte
+}
+
+// write writes the records together, in the same file.
+func (w *WARCWriter) write(records ...warcRecord) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var buf bytes.Buffer
+	for _, rec := range records {
+		if err := gzipRecord(&buf, rec); err != nil {
+			return err
+		}
+	}
+
+	if w.file == nil || (w.maxSize > 0 && w.size > 0 && w.size+int64(buf.Len()) > w.maxSize) {
+		if err := w.rollOver(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// rollOver closes the current file and starts the next one, with its
+// warcinfo record.
+func (w *WARCWriter) rollOver() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, w.now().UTC().Format("20060102150405"), w.serial)
+	file, err := os.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return err
+	}
+	w.file, w.size = file, 0
+	w.serial++
+
+	info := warcRecord{
+		header: []WARCField{
+			{"WARC-Type", "warcinfo"},
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", warcDate(w.now())},
+			{"WARC-Filename", name},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: warcFields(append([]WARCField{
+			{"software", "github.com/aybabtme/crawler"},
+			{"format", "WARC File Format 1.1"},
+			{"conformsTo", "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"},
+		}, w.info...)),
+	}
+	var buf bytes.Buffer
+	if err := gzipRecord(&buf, info); err != nil {
+		return err
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// gzipRecord writes a record as a gzip member of its own, with its
+// length and block digest.
+func gzipRecord(w io.Writer, rec warcRecord) error {
+	gz := gzip.NewWriter(w)
+	_, _ = io.WriteString(gz, "WARC/1.1\r\n")
+	for _, f := range rec.header {
+		fmt.Fprintf(gz, "%s: %s\r\n", f.Name, f.Value)
+	}
+	fmt.Fprintf(gz, "WARC-Block-Digest: %s\r\n", warcDigest(rec.block))
+	fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(rec.block))
+	_, _ = gz.Write(rec.block)
+	_, _ = io.WriteString(gz, "\r\n\r\n")
+	return gz.Close()
+}
+
+// warcFields formats fields as an application/warc-fields block.
+func warcFields(fields []WARCField) []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", f.Name, f.Value)
+	}
+	return buf.Bytes()
+}
+
+// warcDate is the format of WARC dates, UTC with microseconds.
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+}
+
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newRecordID is a random (version 4) UUID URN.
+func newRecordID() string {
+	var b [16]byte
+	_, _ = io.ReadFull(rand.Reader, b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcRecorder writes every exchange going through it to WARC records: a
+// request, a response and a metadata record.
+type warcRecorder struct {
+	next    http.RoundTripper
+	w       *WARCWriter
+	maxBody int64
+	now     func() time.Time
+}
+
+// NewWARCRecorder returns a RoundTripper that sends the requests with
+// next, http.DefaultTransport if nil, and records them and their
+// responses with w, as they went on the wire: bodies are asked gzipped,
+// as http.Transport does, recorded as they came and given back decoded.
+// Bodies are recorded as they're read, up to maxBody bytes, zero records
+// them whole, and the records are written when they're closed.
+//
+// Given as the transport of the crawler's client, it records everything
+// the crawler fetches, robots.txt and every redirect included.
+func NewWARCRecorder(next http.RoundTripper, w *WARCWriter, maxBody int64) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &warcRecorder{next: next, w: w, maxBody: maxBody, now: time.Now}
+}
+
+func (r *warcRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	// next reads the body of the request, it's recorded from a copy
+	reqBody, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	out := req
+	if req.GetBody == nil && reqBody != nil {
+		out = cloneRequest(req)
+		out.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	// the body is recorded as it was sent: asked gzipped, as the
+	// transport would, and decoded after it's recorded
+	if transportGzips(req) {
+		if out == req {
+			out = cloneRequest(req)
+		}
+		out.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	start := r.now()
+	resp, err := r.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		recorder:   r,
+		req:        out,
+		reqBody:    reqBody,
+		resp:       resp,
+		header:     cloneHeader(resp.Header),
+		length:     resp.ContentLength,
+		start:      start,
+	}
+	decodeResponse(req, resp)
+	return resp, nil
+}
+
+// recordingBody is the body of a response, recorded as it's read. The
+// records are written when it's closed, with as much of the body as was
+// read.
+type recordingBody struct {
+	io.ReadCloser
+	recorder *warcRecorder
+	req      *http.Request
+	reqBody  []byte
+	resp     *http.Response
+	// the header and length of the response as it was received
+	header http.Header
+	length int64
+	start  time.Time
+
+	payload   bytes.Buffer
+	read      int64
+	eof       bool
+	truncated bool
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	kept := p[:n]
+	if max := b.recorder.maxBody; max > 0 && int64(b.payload.Len()+n) > max {
+		kept = kept[:max-int64(b.payload.Len())]
+		b.truncated = true
+	}
+	b.payload.Write(kept)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		truncated := ""
+		switch {
+		case b.truncated:
+			truncated = "length"
+		case !b.eof && b.read != b.length && b.req.Method != "HEAD":
+			// closed before the end
+			truncated = "unspecified"
+		}
+		elapsed := b.recorder.now().Sub(b.start)
+		if rerr := b.recorder.record(b.req, b.reqBody, b.resp, b.header, b.payload.Bytes(), truncated, b.start, elapsed); rerr != nil && err == nil {
+			err = fmt.Errorf("recording to WARC, %v", rerr)
+		}
+	})
+	return err
+}
+
+// transportGzips tells if http.Transport asks for a gzipped body, and
+// decodes it, for a request.
+func transportGzips(req *http.Request) bool {
+	return req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD"
+}
+
+// decodeResponse decodes a gzipped response, as http.Transport does, for
+// a request that didn't ask for an encoding.
+func decodeResponse(req *http.Request, resp *http.Response) {
+	if !transportGzips(req) || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+	resp.Header = cloneHeader(resp.Header)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	resp.Body = &gzipBody{ReadCloser: resp.Body}
+}
+
+// gzipBody is a gzipped body, decoded from its first read.
+type gzipBody struct {
+	io.ReadCloser
+	zr  *gzip.Reader
+	err error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.ReadCloser)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (r *warcRecorder) record(req *http.Request, reqBody []byte, resp *http.Response, header http.Header, payload []byte, truncated string, start time.Time, elapsed time.Duration) error {
+	recorded, reqBody := redactRequest(req, reqBody)
+	target := recorded.URL.String()
+	date := warcDate(start)
+
+	var reqBlock bytes.Buffer
+	recorded.Body = nil
+	if reqBody != nil {
+		recorded.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	if err := recorded.Write(&reqBlock); err != nil {
+		return err
+	}
+
+	var respBlock bytes.Buffer
+	fmt.Fprintf(&respBlock, "%s %s\r\n", resp.Proto, resp.Status)
+	if err := redactResponse(header).Write(&respBlock); err != nil {
+		return err
+	}
+	respBlock.WriteString("\r\n")
+	respBlock.Write(payload)
+
+	respID := newRecordID()
+	response := warcRecord{
+		header: []WARCField{
+			{"WARC-Type", "response"},
+			{"WARC-Record-ID", respID},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", target},
+			{"Content-Type", "application/http;msgtype=response"},
+			{"WARC-Payload-Digest", warcDigest(payload)},
+		},
+		block: respBlock.Bytes(),
+	}
+	if truncated != "" {
+		response.header = append(response.header, WARCField{"WARC-Truncated", truncated})
+	}
+
+	request := warcRecord{
+		header: []WARCField{
+			{"WARC-Type", "request"},
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", target},
+			{"WARC-Concurrent-To", respID},
+			{"Content-Type", "application/http;msgtype=request"},
+		},
+		block: reqBlock.Bytes(),
+	}
+
+	fields := []WARCField{{"fetchTimeMs", strconv.FormatInt(int64(elapsed/time.Millisecond), 10)}}
+	if location := header.Get("Location"); location != "" {
+		fields = append(fields, WARCField{"redirect", location})
+	}
+	metadata := warcRecord{
+		header: []WARCField{
+			{"WARC-Type", "metadata"},
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", target},
+			{"WARC-Concurrent-To", respID},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: warcFields(fields),
+	}
+
+	return r.w.write(response, request, metadata)
+}
+
+// secretHeaders are never written to the records, whoever sets them.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// secretResponseHeaders set the cookies sent back as secrets, they're
+// never written to the records either.
+var secretResponseHeaders = []string{"Set-Cookie", "Set-Cookie2"}
+
+// redacted replaces the secrets in the records.
+const redacted = "redacted"
+
+// secretsKey is the context key of the secrets of a request.
+type secretsKey struct{}
+
+// requestSecrets name the headers, and the form fields of the query or
+// the body, that hold secrets in a request, for them to be kept out of
+// the records.
+type requestSecrets struct {
+	headers, fields []string
+}
+
+// withSecrets is req with more of its headers and fields marked secret.
+func withSecrets(req *http.Request, secrets requestSecrets) *http.Request {
+	known := secretsOf(req)
+	known.headers = append(append([]string(nil), known.headers...), secrets.headers...)
+	known.fields = append(append([]string(nil), known.fields...), secrets.fields...)
+	return req.WithContext(context.WithValue(req.Context(), secretsKey{}, known))
+}
+
+func secretsOf(req *http.Request) requestSecrets {
+	secrets, _ := req.Context().Value(secretsKey{}).(requestSecrets)
+	return secrets
+}
+
+// redactRequest is a copy of a request and its body, their secrets
+// replaced.
+func redactRequest(req *http.Request, body []byte) (*http.Request, []byte) {
+	secrets := secretsOf(req)
+	recorded := cloneRequest(req)
+	for _, name := range append(secretHeaders, secrets.headers...) {
+		if _, ok := recorded.Header[http.CanonicalHeaderKey(name)]; ok {
+			recorded.Header.Set(name, redacted)
+		}
+	}
+	if len(secrets.fields) == 0 {
+		return recorded, body
+	}
+
+	if query := recorded.URL.Query(); redactFields(query, secrets.fields) {
+		u := *recorded.URL
+		u.RawQuery = query.Encode()
+		recorded.URL = &u
+	}
+	mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if body != nil && mediatype == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(string(body)); err == nil && redactFields(form, secrets.fields) {
+			body = []byte(form.Encode())
+			recorded.ContentLength = int64(len(body))
+		}
+	}
+	return recorded, body
+}
+
+// redactResponse is a copy of the header of a response, its secrets
+// replaced.
+func redactResponse(header http.Header) http.Header {
+	recorded := cloneHeader(header)
+	for _, name := range secretResponseHeaders {
+		for i := range recorded[name] {
+			recorded[name][i] = redacted
+		}
+	}
+	return recorded
+}
+
+// redactFields replaces the values of the fields, and tells if there
+// were any.
+func redactFields(values url.Values, fields []string) bool {
+	found := false
+	for _, name := range fields {
+		if vs, ok := values[name]; ok {
+			for i := range vs {
+				vs[i] = redacted
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// requestBody is a copy of the body of a request, nil if it has none.
+// The copy is read from GetBody if the request has it, otherwise the body
+// itself is read, and must be replaced before the request is sent.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body := req.Body
+	if req.GetBody != nil {
+		var err error
+		if body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for k, v := range h {
+		clone[k] = append([]string{}, v...)
+	}
+	return clone
+}
+
+func cloneRequest(req *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = cloneHeader(req.Header)
+	return clone
+}
@@ -0,0 +1,365 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readWARCFile reads the records of a gzipped WARC file, checking that
+// every record is a gzip member of its own.
+func readWARCFile(t *testing.T, filename string) []warcRecord {
+	f, err := os.Open(filename)
+	check(t, err == nil, "couldn't open %q, %v", filename, err)
+	defer f.Close()
+
+	var records []warcRecord
+	br := bufio.NewReader(f)
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return records
+		}
+		gz, err := gzip.NewReader(br)
+		check(t, err == nil, "couldn't read gzip member, %v", err)
+		gz.Multistream(false)
+		data, err := ioutil.ReadAll(gz)
+		check(t, err == nil, "couldn't read gzip member, %v", err)
+		records = append(records, parseWARCRecord(t, data))
+	}
+}
+
+func parseWARCRecord(t *testing.T, data []byte) warcRecord {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	check(t, end > 0, "no end to the record header in %q", data)
+	lines := strings.Split(string(data[:end]), "\r\n")
+	check(t, lines[0] == "WARC/1.1", "want a WARC/1.1 record, got %q", lines[0])
+
+	var rec warcRecord
+	for _, line := range lines[1:] {
+		i := strings.Index(line, ": ")
+		check(t, i > 0, "bad header line %q", line)
+		rec.header = append(rec.header, WARCField{line[:i], line[i+2:]})
+	}
+	length, err := strconv.Atoi(warcHeader(rec, "Content-Length"))
+	check(t, err == nil, "bad Content-Length, %v", err)
+	rest := data[end+4:]
+	check(t, len(rest) == length+4, "want a block of %d bytes and the end of the record, got %d bytes", length, len(rest))
+	check(t, string(rest[length:]) == "\r\n\r\n", "want the record to end with two CRLF, got %q", rest[length:])
+	rec.block = rest[:length]
+	check(t, warcHeader(rec, "WARC-Block-Digest") == warcDigest(rec.block), "wrong block digest")
+	return rec
+}
+
+func warcHeader(rec warcRecord, name string) string {
+	for _, f := range rec.header {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func warcFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	check(t, err == nil, "couldn't list WARC files, %v", err)
+	return files
+}
+
+func TestWARCRecorder(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "hello")
+	}
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "test", 0, []WARCField{{"http-header-user-agent", testAgent}})
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		client := &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+		resp, err := client.Get(domain.String() + "/old")
+		check(t, err == nil, "couldn't get, %v", err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		check(t, string(body) == "hello", "want the body given back, got %q", body)
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		files := warcFiles(t, dir)
+		check(t, len(files) == 1, "want 1 file, got %v", files)
+		check(t, strings.HasPrefix(filepath.Base(files[0]), "test-"), "want the file named after the prefix, got %q", files[0])
+
+		records := readWARCFile(t, files[0])
+		var types []string
+		for _, rec := range records {
+			types = append(types, warcHeader(rec, "WARC-Type")+" "+warcHeader(rec, "WARC-Target-URI"))
+		}
+		oldURL, newURL := domain.String()+"/old", domain.String()+"/new"
+		want := []string{
+			"warcinfo ",
+			"response " + oldURL, "request " + oldURL, "metadata " + oldURL,
+			"response " + newURL, "request " + newURL, "metadata " + newURL,
+		}
+		check(t, reflect.DeepEqual(types, want), "want records\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(types, "\n"))
+
+		info := string(records[0].block)
+		check(t, strings.Contains(info, "http-header-user-agent: "+testAgent+"\r\n"), "want the agent in warcinfo, got %q", info)
+		check(t, warcHeader(records[0], "WARC-Filename") == filepath.Base(files[0]), "want the file name in warcinfo")
+
+		redirect := records[1]
+		check(t, strings.HasPrefix(string(redirect.block), "HTTP/1.1 301 Moved Permanently\r\n"), "want the status line, got %q", redirect.block)
+		check(t, strings.Contains(string(records[3].block), "redirect: /new\r\n"), "want the redirect in the metadata, got %q", records[3].block)
+
+		respID := warcHeader(records[4], "WARC-Record-ID")
+		check(t, warcHeader(records[5], "WARC-Concurrent-To") == respID, "want the request concurrent to the response")
+		check(t, warcHeader(records[6], "WARC-Concurrent-To") == respID, "want the metadata concurrent to the response")
+		check(t, strings.HasSuffix(string(records[4].block), "\r\n\r\nhello"), "want the payload, got %q", records[4].block)
+		check(t, warcHeader(records[4], "WARC-Payload-Digest") == warcDigest([]byte("hello")), "wrong payload digest")
+		check(t, strings.HasPrefix(string(records[5].block), "GET /new HTTP/1.1\r\n"), "want the request line, got %q", records[5].block)
+		check(t, strings.Contains(string(records[6].block), "fetchTimeMs: "), "want the fetch time, got %q", records[6].block)
+	})
+}
+
+func TestWARCRecorderTruncates(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "abcdef") }
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "test", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		client := &http.Client{Transport: NewWARCRecorder(nil, w, 3)}
+		resp, err := client.Get(domain.String())
+		check(t, err == nil, "couldn't get, %v", err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		check(t, string(body) == "abcdef", "want the whole body given back, got %q", body)
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		records := readWARCFile(t, warcFiles(t, dir)[0])
+		check(t, warcHeader(records[1], "WARC-Truncated") == "length", "want the response marked truncated")
+		check(t, strings.HasSuffix(string(records[1].block), "\r\n\r\nabc"), "want the cut payload, got %q", records[1].block)
+	})
+}
+
+func TestWARCRecorderKeepsEncoding(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	fmt.Fprint(gz, "hello hello hello")
+	check(t, gz.Close() == nil, "couldn't gzip")
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		check(t, strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"), "want gzip asked for, got %q", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped.Bytes())
+	}
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "test", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		client := &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+		resp, err := client.Get(domain.String())
+		check(t, err == nil, "couldn't get, %v", err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		check(t, string(body) == "hello hello hello", "want the body given back decoded, got %q", body)
+		check(t, resp.Header.Get("Content-Encoding") == "", "want no encoding left, got %q", resp.Header.Get("Content-Encoding"))
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		file := warcFiles(t, dir)[0]
+		response := readWARCFile(t, file)[1]
+		check(t, strings.Contains(string(response.block), "\r\nContent-Encoding: gzip\r\n"), "want the encoding recorded, got %q", response.block)
+		check(t, bytes.HasSuffix(response.block, gzipped.Bytes()), "want the gzipped payload recorded, got %q", response.block)
+		check(t, warcHeader(response, "WARC-Payload-Digest") == warcDigest(gzipped.Bytes()), "wrong payload digest")
+
+		// replayed decoded too
+		f, err := os.Open(file)
+		check(t, err == nil, "couldn't open %q, %v", file, err)
+		defer f.Close()
+		replay := NewReplay()
+		check(t, replay.ReadWARC(f) == nil, "couldn't read %q", file)
+		resp, err = (&http.Client{Transport: replay}).Get(domain.String())
+		check(t, err == nil, "couldn't replay, %v", err)
+		body, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		check(t, string(body) == "hello hello hello", "want the replayed body decoded, got %q", body)
+	})
+}
+
+func TestWARCRecorderDoesntReadAhead(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+		w.(http.Flusher).Flush()
+		// the rest never comes
+		<-release
+	}
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		defer close(release)
+		w, err := NewWARCWriter(dir, "test", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		got := make(chan error)
+		var resp *http.Response
+		go func() {
+			var err error
+			resp, err = (&http.Client{Transport: NewWARCRecorder(nil, w, 0)}).Get(domain.String())
+			got <- err
+		}()
+		select {
+		case err := <-got:
+			check(t, err == nil, "couldn't get, %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("want the response before its body is read")
+		}
+		body := make([]byte, 5)
+		_, err = io.ReadFull(resp.Body, body)
+		check(t, err == nil, "couldn't read, %v", err)
+		_ = resp.Body.Close()
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		response := readWARCFile(t, warcFiles(t, dir)[0])[1]
+		check(t, warcHeader(response, "WARC-Truncated") == "unspecified", "want the response marked truncated, got %q", warcHeader(response, "WARC-Truncated"))
+		check(t, strings.HasSuffix(string(response.block), "\r\n\r\nhello"), "want what was read recorded, got %q", response.block)
+	})
+}
+
+func TestWARCRecorderPOST(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "got %s", body)
+	}
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "test", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+		client := &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+
+		// with GetBody, and without, from a reader net/http doesn't know
+		bodies := []io.Reader{strings.NewReader("a=1&b=2"), struct{ io.Reader }{strings.NewReader("a=1&b=2")}}
+		for _, body := range bodies {
+			req, err := http.NewRequest("POST", domain.String()+"/login", body)
+			check(t, err == nil, "couldn't create the request, %v", err)
+			req.ContentLength = 7
+			resp, err := client.Do(req)
+			check(t, err == nil, "couldn't post, %v", err)
+			got, _ := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			check(t, string(got) == "got a=1&b=2", "want the body sent, got %q", got)
+		}
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		records := readWARCFile(t, warcFiles(t, dir)[0])
+		for _, i := range []int{2, 5} {
+			request := string(records[i].block)
+			check(t, strings.HasPrefix(request, "POST /login HTTP/1.1\r\n"), "want the request line, got %q", request)
+			check(t, strings.HasSuffix(request, "\r\n\r\na=1&b=2"), "want the request body recorded, got %q", request)
+		}
+	})
+}
+
+func TestRedactRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/login?user=bob&password=secret&next=%2F", nil)
+	req.Header.Set("Cookie", "session=s1")
+	req.Header.Set("X-Env", "staging")
+	req = withSecrets(req, requestSecrets{fields: []string{"password"}})
+
+	recorded, _ := redactRequest(req, nil)
+	check(t, recorded.URL.Query().Get("password") == "redacted", "want the password redacted, got %q", recorded.URL)
+	check(t, recorded.URL.Query().Get("next") == "/", "want the other fields kept, got %q", recorded.URL)
+	check(t, recorded.Header.Get("Cookie") == "redacted", "want the cookies redacted")
+	check(t, recorded.Header.Get("X-Env") == "staging", "want the other headers kept")
+	check(t, req.URL.Query().Get("password") == "secret" && req.Header.Get("Cookie") == "session=s1", "want the request left alone")
+}
+
+func TestWARCWriterRollsOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWARCWriter(dir, "test", 1, nil)
+	check(t, err == nil, "couldn't create the writer, %v", err)
+	for i := 0; i < 3; i++ {
+		err := w.write(warcRecord{header: []WARCField{{"WARC-Type", "resource"}}, block: []byte("data")})
+		check(t, err == nil, "couldn't write, %v", err)
+	}
+	check(t, w.Close() == nil, "couldn't close the writer")
+
+	files := warcFiles(t, dir)
+	check(t, len(files) == 3, "want a file per record, got %v", files)
+	for _, file := range files {
+		records := readWARCFile(t, file)
+		check(t, len(records) == 2, "want 2 records in %q, got %d", file, len(records))
+		check(t, warcHeader(records[0], "WARC-Type") == "warcinfo", "want %q to start with warcinfo", file)
+	}
+}
+
+func TestCrawlRecordsWARC(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a"></a>`,
+		"/a": `<p>A</p>`,
+	}
+
+	dir, err := ioutil.TempDir("", "warc")
+	check(t, err == nil, "couldn't create the WARC directory, %v", err)
+	defer os.RemoveAll(dir)
+
+	withHandler(t, htmlPages(pages), func(domain *url.URL) {
+		w, err := NewWARCWriter(dir, "crawl", 0, nil)
+		check(t, err == nil, "couldn't create the writer, %v", err)
+
+		opts := DefaultOptions()
+		opts.Client = &http.Client{Transport: NewWARCRecorder(nil, w, 0)}
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		_, err = c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+		check(t, w.Close() == nil, "couldn't close the writer")
+
+		var responses []string
+		for _, rec := range readWARCFile(t, warcFiles(t, dir)[0]) {
+			if warcHeader(rec, "WARC-Type") == "response" {
+				u := must(url.Parse(warcHeader(rec, "WARC-Target-URI")))
+				responses = append(responses, u.Path)
+			}
+		}
+		want := []string{"/robots.txt", "", "/a"}
+		check(t, reflect.DeepEqual(responses, want), "want responses %q, got %q", want, responses)
+	})
+}
@@ -0,0 +1,337 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.net/html"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// namespaces of the XML vocabularies whose links are known
+const (
+	xmlNS          = "http://www.w3.org/XML/1998/namespace"
+	atomNS         = "http://www.w3.org/2005/Atom"
+	rss1NS         = "http://purl.org/rss/1.0/"
+	rssContentNS   = "http://purl.org/rss/1.0/modules/content/"
+	mediaRSSNS     = "http://search.yahoo.com/mrss/"
+	sitemapNS      = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapImageNS = "http://www.google.com/schemas/sitemap-image/1.1"
+	sitemapVideoNS = "http://www.google.com/schemas/sitemap-video/1.1"
+	xhtmlNS        = "http://www.w3.org/1999/xhtml"
+	svgNS          = "http://www.w3.org/2000/svg"
+	xlinkNS        = "http://www.w3.org/1999/xlink"
+)
+
+// xmlExtractor finds the links of XML documents: RSS and Atom feeds,
+// sitemaps, and the XHTML and SVG elements of any document. The HTML
+// escaped in feeds is handed to the HTML extractor.
+type xmlExtractor struct {
+	html *htmlExtractor
+}
+
+// xmlDocument is what an XML document tells about itself.
+type xmlDocument struct {
+	links []linkRef
+	// words are those of the character data, to fingerprint the document
+	words []string
+	// encoding is the character encoding the document was decoded from
+	encoding string
+}
+
+// xmlElement is an element being read, with what it takes to find the
+// links it holds.
+type xmlElement struct {
+	name xml.Name
+	// base is what the links of the element resolve against, changed by
+	// xml:base attributes
+	base *url.URL
+	// text is the character data of the element, for the elements whose
+	// text is a link or escaped HTML
+	text *bytes.Buffer
+	// textLink is set when the text of the element is a link, htmlText
+	// when it's escaped HTML
+	textLink, htmlText bool
+	leaf               bool
+}
+
+// xmlTextLink tells if the text of an element is a link, and to a leaf.
+// RSS 2.0 elements have no namespace, they're only known in <rss>
+// documents.
+func xmlTextLink(name, parent xml.Name, attrs []xml.Attr, rss bool) (link, leaf bool) {
+	switch name.Space {
+	case "", rss1NS:
+		if name.Space == "" && !rss {
+			return false, false
+		}
+		switch name.Local {
+		case "link", "comments":
+			return true, false
+		case "guid":
+			// guids are permalinks, unless told otherwise
+			return !strings.EqualFold(xmlAttr(attrs, "", "isPermaLink"), "false"), false
+		case "url":
+			return parent.Local == "image", true
+		}
+	case atomNS:
+		switch name.Local {
+		case "uri":
+			return true, false
+		case "icon", "logo":
+			return true, true
+		}
+	case sitemapNS:
+		return name.Local == "loc", false
+	case sitemapImageNS:
+		return name.Local == "loc", true
+	case sitemapVideoNS:
+		switch name.Local {
+		case "thumbnail_loc", "content_loc":
+			return true, true
+		case "player_loc":
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// xmlHTMLText tells if the text of an element is escaped HTML.
+func xmlHTMLText(name xml.Name, attrs []xml.Attr, rss bool) bool {
+	switch name.Space {
+	case "", rss1NS:
+		return name.Local == "description" && (rss || name.Space == rss1NS)
+	case rssContentNS:
+		return name.Local == "encoded"
+	case atomNS:
+		switch name.Local {
+		case "content", "summary":
+			return xmlAttr(attrs, "", "type") == "html"
+		}
+	}
+	return false
+}
+
+// xmlAttrLinks calls add with the links in the attributes of an element.
+func (x *xmlExtractor) xmlAttrLinks(name xml.Name, attrs []xml.Attr, rss bool, add func(link string, leaf bool)) {
+	switch name.Space {
+	case "":
+		if !rss {
+			return
+		}
+		switch name.Local {
+		case "enclosure":
+			add(xmlAttr(attrs, "", "url"), true)
+		case "source":
+			add(xmlAttr(attrs, "", "url"), false)
+		}
+	case atomNS:
+		switch name.Local {
+		case "link":
+			add(xmlAttr(attrs, "", "href"), xmlAttr(attrs, "", "rel") == "enclosure")
+		case "content":
+			add(xmlAttr(attrs, "", "src"), false)
+		case "generator":
+			add(xmlAttr(attrs, "", "uri"), false)
+		}
+	case mediaRSSNS:
+		switch name.Local {
+		case "content", "thumbnail":
+			add(xmlAttr(attrs, "", "url"), true)
+		case "player":
+			add(xmlAttr(attrs, "", "url"), false)
+		}
+	case xhtmlNS, svgNS:
+		if x.html.relNoFollow && hasRelValue(xmlAttr(attrs, "", "rel"), "nofollow") {
+			return
+		}
+		for _, res := range x.html.resources {
+			if res.element != name.Local || res.baseAttr != "" {
+				continue
+			}
+			for _, attr := range attrs {
+				if attr.Name.Local != res.attr || (attr.Name.Space != "" && attr.Name.Space != xlinkNS) {
+					continue
+				}
+				for _, link := range res.values(attr.Value) {
+					add(link, res.leaf)
+				}
+			}
+		}
+	}
+}
+
+// extract finds the links of an XML document. What was found before a
+// syntax error is returned along with it.
+func (x *xmlExtractor) extract(from *url.URL, r io.Reader, contentType string) (doc xmlDocument, err error) {
+	d, encoding := newXMLDecoder(r, contentType)
+	defer func() {
+		// the decoder only asks for a charset reader if the document
+		// declares an encoding other than UTF-8
+		if doc.encoding = *encoding; doc.encoding == "" {
+			doc.encoding = "utf-8"
+		}
+	}()
+
+	var stack []*xmlElement
+	base := func() *url.URL {
+		if len(stack) == 0 {
+			return from
+		}
+		return stack[len(stack)-1].base
+	}
+	add := func(base *url.URL, link string, leaf bool) {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			return
+		}
+		u, err := cleanFromURLString(base, link, x.html.normalizer)
+		if err == nil {
+			doc.links = append(doc.links, linkRef{url: u, raw: link, leaf: leaf})
+		}
+	}
+	rss := false
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				rss = tok.Name.Space == "" && tok.Name.Local == "rss"
+			}
+			var parent xml.Name
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1].name
+			}
+			el := &xmlElement{name: tok.Name, base: base()}
+			if b := xmlAttr(tok.Attr, xmlNS, "base"); b != "" {
+				if u, err := el.base.Parse(strings.TrimSpace(b)); err == nil {
+					el.base = u
+				}
+			}
+			el.textLink, el.leaf = xmlTextLink(tok.Name, parent, tok.Attr, rss)
+			el.htmlText = xmlHTMLText(tok.Name, tok.Attr, rss)
+			if el.textLink || el.htmlText {
+				el.text = new(bytes.Buffer)
+			}
+			x.xmlAttrLinks(tok.Name, tok.Attr, rss, func(link string, leaf bool) {
+				add(el.base, link, leaf)
+			})
+			stack = append(stack, el)
+
+		case xml.CharData:
+			doc.words = append(doc.words, strings.FieldsFunc(strings.ToLower(string(tok)), isWordSeparator)...)
+			if len(stack) > 0 && stack[len(stack)-1].text != nil {
+				stack[len(stack)-1].text.Write(tok)
+			}
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			el := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch {
+			case el.textLink:
+				add(el.base, el.text.String(), el.leaf)
+			case el.htmlText:
+				node, err := html.Parse(el.text)
+				if err == nil {
+					doc.links = append(doc.links, x.html.extract(el.base, node).links...)
+				}
+			}
+
+		case xml.ProcInst:
+			if tok.Target == "xml-stylesheet" {
+				add(base(), procInstAttr(string(tok.Inst), "href"), false)
+			}
+		}
+	}
+}
+
+// newXMLDecoder reads XML leniently, like feeds in the wild need. The
+// encoding is told by the byte order mark of the document, the charset
+// of its Content-Type, or its XML declaration, in that order, its name is
+// known once the document is read.
+func newXMLDecoder(r io.Reader, contentType string) (*xml.Decoder, *string) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	start, _ := br.Peek(sniffLen)
+
+	name := ""
+	var in io.Reader = br
+	for _, bom := range boms {
+		if bytes.HasPrefix(start, bom.bom) {
+			_, _ = br.Discard(len(bom.bom))
+			name = bom.encoding
+			break
+		}
+	}
+	if name == "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			name = lookupEncoding(params["charset"])
+		}
+	}
+	if name != "" {
+		in = decoded(br, name)
+	}
+
+	d := xml.NewDecoder(in)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if name != "" {
+			// already decoded
+			return input, nil
+		}
+		// unknown encodings are read as UTF-8
+		if name = lookupEncoding(label); name == "" {
+			name = "utf-8"
+		}
+		return decoded(input, name), nil
+	}
+	return d, &name
+}
+
+// xmlAttr is the value of an attribute, empty if missing.
+func xmlAttr(attrs []xml.Attr, space, local string) string {
+	for _, attr := range attrs {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// procInstAttr is the value of a pseudo-attribute of a processing
+// instruction, like the href of <?xml-stylesheet href="feed.xsl"?>.
+func procInstAttr(inst, name string) string {
+	for _, field := range strings.Fields(inst) {
+		if !strings.HasPrefix(field, name+"=") {
+			continue
+		}
+		value := field[len(name)+1:]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			return value[1 : len(value)-1]
+		}
+	}
+	return ""
+}
+
+// isXMLType tells if documents of the media type are parsed as XML.
+func isXMLType(mediatype string) bool {
+	switch mediatype {
+	case "text/xml", "application/xml":
+		return true
+	}
+	// atom, rss, svg, xhtml and the like
+	return strings.HasSuffix(mediatype, "+xml")
+}
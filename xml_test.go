@@ -0,0 +1,294 @@
+package crawler
+
+import (
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var extractXMLTT = []struct {
+	name string
+	body string
+	// want are the links found, leaves marked with a star
+	want []string
+}{
+	{
+		name: "rss 2.0",
+		body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+  <link>http://example.com/</link>
+  <image><url>/logo.png</url><link>http://example.com/</link></image>
+  <item>
+    <link> /posts/1 </link>
+    <guid>http://example.com/p?id=1</guid>
+    <comments>/posts/1#comments</comments>
+    <enclosure url="/episode.mp3" type="audio/mpeg"/>
+    <source url="http://other.com/feed.xml">Other</source>
+    <description>&lt;p&gt;See &lt;a href="/related"&gt;this&lt;/a&gt;&lt;/p&gt;</description>
+    <media:thumbnail url="/thumb.jpg"/>
+  </item>
+  <item>
+    <guid isPermaLink="false">tag:example.com,2014:2</guid>
+    <content:encoded><![CDATA[<img src="/figure.png">]]></content:encoded>
+  </item>
+</channel>
+</rss>`,
+		want: []string{
+			"http://example.com",
+			"http://example.com/logo.png*",
+			"http://example.com",
+			"http://example.com/posts/1",
+			"http://example.com/posts/1#comments",
+			"http://example.com/p?id=1",
+			"http://example.com/episode.mp3*",
+			"http://other.com/feed.xml",
+			"http://example.com/related",
+			"http://example.com/thumb.jpg*",
+			"http://example.com/figure.png*",
+		},
+	},
+	{
+		name: "rss 1.0",
+		body: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel><link>http://example.com/</link></channel>
+<item><link>http://example.com/one</link><description>&lt;a href="/two"&gt;two&lt;/a&gt;</description></item>
+</rdf:RDF>`,
+		want: []string{
+			"http://example.com",
+			"http://example.com/one",
+			"http://example.com/two",
+		},
+	},
+	{
+		name: "atom",
+		body: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:base="http://example.com/blog/">
+  <link rel="self" href="atom.xml"/>
+  <link rel="alternate" href="./"/>
+  <icon>favicon.ico</icon>
+  <logo>/logo.svg</logo>
+  <generator uri="http://generator.org/">Generator</generator>
+  <author><name>Me</name><uri>/about</uri></author>
+  <entry xml:base="2014/">
+    <link href="post"/>
+    <link rel="enclosure" href="talk.mp4"/>
+    <summary type="html">&lt;a href="other"&gt;other&lt;/a&gt;</summary>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><a href="inline">inline</a><img src="inline.png"/></div></content>
+  </entry>
+  <entry>
+    <content src="/external" type="text/html"/>
+    <summary>&lt;a href="/not-html"&gt;text&lt;/a&gt;</summary>
+  </entry>
+</feed>`,
+		want: []string{
+			"http://example.com/blog/atom.xml",
+			"http://example.com/blog",
+			"http://example.com/blog/favicon.ico*",
+			"http://example.com/logo.svg*",
+			"http://generator.org",
+			"http://example.com/about",
+			"http://example.com/blog/2014/post",
+			"http://example.com/blog/2014/talk.mp4*",
+			"http://example.com/blog/2014/other",
+			"http://example.com/blog/2014/inline",
+			"http://example.com/blog/2014/inline.png*",
+			"http://example.com/external",
+		},
+	},
+	{
+		name: "sitemap",
+		body: `<?xml version="1.0" encoding="UTF-8"?>
+<?xml-stylesheet type="text/xsl" href="/sitemap.xsl"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+  xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+  xmlns:video="http://www.google.com/schemas/sitemap-video/1.1"
+  xmlns:xhtml="http://www.w3.org/1999/xhtml">
+  <url>
+    <loc>http://example.com/a</loc>
+    <xhtml:link rel="alternate" hreflang="fr" href="http://example.com/fr/a"/>
+    <image:image><image:loc>http://example.com/a.jpg</image:loc></image:image>
+    <video:video>
+      <video:thumbnail_loc>http://example.com/a-thumb.jpg</video:thumbnail_loc>
+      <video:player_loc>http://example.com/player?v=a</video:player_loc>
+    </video:video>
+  </url>
+  <url><loc>
+    http://example.com/b?x=1&amp;y=2
+  </loc></url>
+</urlset>`,
+		want: []string{
+			"http://example.com/sitemap.xsl",
+			"http://example.com/a",
+			"http://example.com/fr/a",
+			"http://example.com/a.jpg*",
+			"http://example.com/a-thumb.jpg*",
+			"http://example.com/player?v=a",
+			"http://example.com/b?x=1&y=2",
+		},
+	},
+	{
+		name: "sitemap index",
+		body: `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`,
+		want: []string{"http://example.com/sitemap-1.xml"},
+	},
+	{
+		name: "xhtml",
+		body: `<?xml version="1.0"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><link rel="stylesheet" href="/style.css"/><script src="/app.js"></script></head>
+<body>
+  <a href="/a">a</a>
+  <a href="/b" rel="nofollow">b</a>
+  <img src="/c.png" srcset="/c-2x.png 2x"/>
+  &nbsp;&copy;
+  <svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+    <a xlink:href="/d"><image href="/e.png"/></a>
+  </svg>
+</body>
+</html>`,
+		want: []string{
+			"http://example.com/style.css",
+			"http://example.com/app.js*",
+			"http://example.com/a",
+			"http://example.com/b",
+			"http://example.com/c.png*",
+			"http://example.com/c-2x.png*",
+			"http://example.com/d",
+			"http://example.com/e.png*",
+		},
+	},
+	{
+		name: "unknown vocabulary",
+		body: `<catalog><link>http://example.com/a</link><item url="/b"/><a href="/c"/></catalog>`,
+	},
+}
+
+func TestExtractXML(t *testing.T) {
+	page := must(url.Parse("http://example.com/feed.xml"))
+	for _, tt := range extractXMLTT {
+		x := &xmlExtractor{html: &htmlExtractor{resources: htmlResources}}
+		doc, err := x.extract(page, strings.NewReader(tt.body), "application/xml")
+		check(t, err == nil, "%s: couldn't parse, %v", tt.name, err)
+
+		var got []string
+		for _, l := range doc.links {
+			link := l.url.String()
+			if l.leaf {
+				link += "*"
+			}
+			got = append(got, link)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		check(t, reflect.DeepEqual(want, got), "%s: want links\n%q\ngot\n%q", tt.name, want, got)
+	}
+}
+
+func TestExtractXMLNoFollow(t *testing.T) {
+	page := must(url.Parse("http://example.com/"))
+	x := &xmlExtractor{html: &htmlExtractor{resources: htmlResources, relNoFollow: true}}
+	body := `<html xmlns="http://www.w3.org/1999/xhtml"><a href="/a"/><a href="/b" rel="external nofollow"/></html>`
+	doc, err := x.extract(page, strings.NewReader(body), "")
+	check(t, err == nil, "couldn't parse, %v", err)
+	check(t, len(doc.links) == 1 && doc.links[0].url.Path == "/a", "want only /a, got %v", doc.links)
+}
+
+func TestExtractXMLEncoding(t *testing.T) {
+	latin := string(encode(charmap.ISO8859_1, "<rss><channel><link>/café</link></channel></rss>"))
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		encoding    string
+		want        string
+	}{
+		{"undeclared", "<rss><channel><link>/café</link></channel></rss>", "", "utf-8", "/caf%C3%A9"},
+		{"declared utf-8", `<?xml version="1.0" encoding="UTF-8"?><rss><channel><link>/café</link></channel></rss>`, "", "utf-8", "/caf%C3%A9"},
+		{"declaration", `<?xml version="1.0" encoding="ISO-8859-1"?>` + latin, "", "windows-1252", "/caf%C3%A9"},
+		{"content-type", latin, "text/xml; charset=latin1", "windows-1252", "/caf%C3%A9"},
+		{"content-type over declaration", `<?xml version="1.0" encoding="utf-8"?>` + latin, "text/xml; charset=latin1", "windows-1252", "/caf%C3%A9"},
+		{"unknown declaration", `<?xml version="1.0" encoding="klingon"?><rss><channel><link>/café</link></channel></rss>`, "", "utf-8", "/caf%C3%A9"},
+	}
+	page := must(url.Parse("http://example.com/"))
+	for _, tt := range tests {
+		x := &xmlExtractor{html: &htmlExtractor{resources: htmlResources}}
+		doc, err := x.extract(page, strings.NewReader(tt.body), tt.contentType)
+		check(t, err == nil, "%s: couldn't parse, %v", tt.name, err)
+		check(t, doc.encoding == tt.encoding, "%s: want encoding %q, got %q", tt.name, tt.encoding, doc.encoding)
+		check(t, len(doc.links) == 1 && doc.links[0].url.EscapedPath() == tt.want, "%s: want link %q, got %v", tt.name, tt.want, doc.links)
+	}
+}
+
+func TestExtractMalformedXML(t *testing.T) {
+	page := must(url.Parse("http://example.com/"))
+	x := &xmlExtractor{html: &htmlExtractor{resources: htmlResources}}
+	body := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>/a</loc></url><url><loc>/b</loc></url><`
+	doc, err := x.extract(page, strings.NewReader(body), "")
+	check(t, err != nil, "want a syntax error")
+	check(t, len(doc.links) == 2, "want the links before the error, got %v", doc.links)
+}
+
+func TestCrawlFeedsAndSitemaps(t *testing.T) {
+	pages := map[string]struct{ contentType, body string }{
+		"/": {"text/html", `<link rel="alternate" type="application/rss+xml" href="/feed.rss"><a href="/atom.xml"></a>`},
+		"/feed.rss": {"application/rss+xml", `<rss><channel><item><link>/post</link>
+			<description>&lt;a href="/linked"&gt;&lt;/a&gt;</description></item></channel></rss>`},
+		"/atom.xml": {"application/atom+xml", `<feed xmlns="http://www.w3.org/2005/Atom"><link href="/pages.xml"/></feed>`},
+		"/pages.xml": {"application/xml", `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc>/from-sitemap</loc></url><url><loc>/broken</loc></url><`},
+		"/post":         {"text/html", `<p>post</p>`},
+		"/linked":       {"text/html", `<p>linked</p>`},
+		"/from-sitemap": {"text/html", `<p>from the sitemap</p>`},
+		"/broken":       {"text/html", `<p>after a syntax error</p>`},
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", page.contentType)
+		fmt.Fprint(w, page.body)
+	}
+
+	withHandler(t, http.HandlerFunc(handler), func(domain *url.URL) {
+		rec := &recorder{}
+		opts := DefaultOptions()
+		opts.Observer = rec
+		c, err := NewCrawlerWithOptions(domain, testAgent, opts)
+		check(t, err == nil, "couldn't create crawler, %v", err)
+		g, err := c.Crawl()
+		check(t, err == nil, "couldn't crawl, %v", err)
+
+		var got []string
+		g.Walk(func(link string, status int, _, _ []string) bool {
+			path := must(url.Parse(link)).Path
+			check(t, status == 200, "%s: want a 200, got %d", path, status)
+			got = append(got, path)
+			return true
+		})
+		sort.Strings(got)
+		want := []string{"", "/atom.xml", "/broken", "/feed.rss", "/from-sitemap", "/linked", "/pages.xml", "/post"}
+		check(t, reflect.DeepEqual(want, got), "want resources %q, got %q", want, got)
+
+		errors := 0
+		for _, event := range rec.events {
+			if strings.HasPrefix(event, "error parsing XML") {
+				errors++
+			}
+		}
+		check(t, errors == 1, "want the malformed sitemap reported once, got %q", rec.events)
+
+		info, _ := g.Info(domain.String() + "/feed.rss")
+		check(t, info.ContentHash != "" && info.Encoding == "utf-8", "want the feed fingerprinted, got %+v", info)
+	})
+}